@@ -0,0 +1,122 @@
+package gogator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prchop/gogator/internal/database"
+)
+
+// MiddlewareAdmin is MiddlewareLoggedIn for commands that change what
+// every user sees, which only admins may run.
+func MiddlewareAdmin(hl handlerLoggedIn) handler {
+	return MiddlewareLoggedIn(func(s *state, c command, u database.User) error {
+		if !u.IsAdmin {
+			return fmt.Errorf("only admins can run %q: %w", c.name, errUnauthorized)
+		}
+		return hl(s, c, u)
+	})
+}
+
+// middlewareAdminSetup is MiddlewareAdmin, except that "admin password"
+// runs without logging in while no admin has a password, which is the
+// case of an install upgraded from before passwords existed. Nobody can
+// log in then, so whoever runs gogator against its database sets the
+// first password of an admin.
+func middlewareAdminSetup(hl handlerLoggedIn) handler {
+	admin := MiddlewareAdmin(hl)
+	return func(s *state, c command) error {
+		if c.args[0] != "password" {
+			return admin(s, c)
+		}
+		n, err := s.db.CountAdminsWithPassword(context.Background())
+		if err != nil {
+			return fmt.Errorf("couldn't count admins: %w", err)
+		}
+		if n > 0 {
+			return admin(s, c)
+		}
+		return hl(s, c, database.User{})
+	}
+}
+
+var adminActions = []string{"grant", "revoke", "password"}
+
+// handlerAdmin grants or revokes the admin role, or sets the password of
+// a user.
+func handlerAdmin(s *state, cmd command, admin database.User) error {
+	ctx := context.Background()
+	action, name := cmd.args[0], cmd.args[1]
+	switch action {
+	case "grant", "revoke", "password":
+	default:
+		return usageErrorf(cmd.name, "unknown action %q, expected one of: %s",
+			action, strings.Join(adminActions, ", "))
+	}
+
+	user, err := getUser(ctx, s, name)
+	if err != nil {
+		return err
+	}
+	if action == "password" {
+		return setUserPassword(ctx, s, cmd, admin, user)
+	}
+
+	isAdmin := action == "grant"
+	if user.IsAdmin == isAdmin {
+		s.out.noticef("Nothing to do, %q is already %s.\n", name, roleName(isAdmin))
+		return nil
+	}
+
+	if !isAdmin {
+		if err := checkNotLastAdmin(ctx, s, user); err != nil {
+			return err
+		}
+	}
+
+	err = s.db.SetUserAdmin(ctx, database.SetUserAdminParams{
+		ID:        user.ID,
+		IsAdmin:   isAdmin,
+		UpdatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't set role: %w", err)
+	}
+	s.out.noticef("User %q is now %s.\n", name, roleName(isAdmin))
+	return nil
+}
+
+// setUserPassword sets the password of user for an admin, the first one
+// of users registered before passwords existed or one they forgot, and
+// logs out every session of the user. Without a logged in admin, while
+// setting up, only the password of an admin can be set.
+func setUserPassword(ctx context.Context, s *state, cmd command, admin, user database.User) error {
+	if admin.ID == uuid.Nil && !user.IsAdmin {
+		return fmt.Errorf("no admin has a password yet, set the password of "+
+			"an admin first: %w", errUnauthorized)
+	}
+	if err := setPassword(ctx, s, cmd.name, user); err != nil {
+		return err
+	}
+	if err := s.db.DeleteUserSessions(ctx, user.ID); err != nil {
+		return fmt.Errorf("couldn't log out sessions: %w", err)
+	}
+	s.out.noticef("Password of %q set, their sessions were logged out.\n", user.Name)
+	return nil
+}
+
+func roleName(admin bool) string {
+	if admin {
+		return "an admin"
+	}
+	return "a regular user"
+}
+
+// rowCounts lists how many rows of each table a destructive command
+// would delete, which is what it prints with --dry-run.
+func rowCounts() *listing {
+	return newListing("table", "rows")
+}
@@ -0,0 +1,576 @@
+package gogator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prchop/gogator/internal/config"
+	"github.com/prchop/gogator/internal/database"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// aggMaxFetches bounds the fetches agg runs at once, when feeds are
+// slower to fetch than the interval.
+const aggMaxFetches = 4
+
+// aggregator is the scheduler of agg. Every interval it fetches the
+// least recently attempted feed, and it keeps the state of every feed
+// it knows for "gogator status" and SIGUSR1.
+type aggregator struct {
+	s        *state
+	interval time.Duration
+	drain    time.Duration
+	started  time.Time
+
+	// ctx is canceled when the in-flight fetches don't finish within
+	// drain after a stop signal.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	feeds    map[uuid.UUID]*aggFeedStatus
+	fetches  int64
+	failures int64
+}
+
+// aggStatus is the state of agg served on its socket.
+type aggStatus struct {
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+	Uptime    string    `json:"uptime"`
+	Interval  string    `json:"interval"`
+	Fetches   int64     `json:"fetches"`
+	Failures  int64     `json:"failures"`
+	// DueFeeds is the depth of the queue of agg, the feeds not attempted
+	// for a round. It is missing when it couldn't be counted.
+	DueFeeds *int64          `json:"due_feeds,omitempty"`
+	Feeds    []aggFeedStatus `json:"feeds"`
+}
+
+type aggFeedStatus struct {
+	ID            uuid.UUID  `json:"id"`
+	Name          string     `json:"name"`
+	URL           string     `json:"url"`
+	Fetching      bool       `json:"fetching"`
+	LastAttemptAt *time.Time `json:"last_attempt_at"`
+	LastSuccessAt *time.Time `json:"last_success_at"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+func handlerAggregate(s *state, cmd command) error {
+	reqtime := cmd.args[0]
+	td, err := time.ParseDuration(reqtime)
+	if err != nil || td <= 0 {
+		return usageErrorf(cmd.name,
+			"couldn't parse the time duration %q, expected e.g. 1s, 1m, 1h",
+			reqtime)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a := &aggregator{
+		s:        s,
+		interval: td,
+		drain:    cmd.flagDuration("drain"),
+		started:  time.Now().UTC(),
+		ctx:      ctx,
+		cancel:   cancel,
+		feeds:    make(map[uuid.UUID]*aggFeedStatus),
+	}
+	if err := a.loadFeeds(); err != nil {
+		return err
+	}
+
+	ln, err := listenStatus(cmd.flagString("socket"))
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	go a.serveStatus(ln)
+
+	if addr := cmd.flagString("metrics-addr"); addr != "" {
+		srv := serveMetrics(addr)
+		defer srv.Close()
+	}
+
+	return a.run()
+}
+
+// serveMetrics serves the metrics of agg at /metrics on addr.
+func serveMetrics(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		err := srv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("couldn't serve metrics", "err", err)
+		}
+	}()
+	slog.Info("serving metrics", "url", "http://"+addr+"/metrics")
+	return srv
+}
+
+func (a *aggregator) run() error {
+	a.s.out.noticef("Collecting feeds every %s\n", a.interval.String())
+
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP,
+		syscall.SIGUSR1)
+	defer signal.Stop(sigch)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	gcTicker := time.NewTicker(feedGCInterval)
+	defer gcTicker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.fetchNext()
+		case <-gcTicker.C:
+			collectFeedsInBackground(a.s)
+		case sig := <-sigch:
+			switch sig {
+			case syscall.SIGHUP:
+				a.reload()
+			case syscall.SIGUSR1:
+				a.dump()
+			default:
+				a.shutdown(sigch)
+				return nil
+			}
+		}
+	}
+}
+
+// fetchNext starts fetching the least recently attempted feed, unless
+// too many fetches are already running.
+func (a *aggregator) fetchNext() {
+	fetching := a.fetching()
+	if len(fetching) >= aggMaxFetches {
+		slog.Warn("fetches still running, skipping a turn", "fetching", len(fetching))
+		return
+	}
+
+	// The span of the turn is the parent of the fetch, which outlives it.
+	ctx, span := tracer.Start(a.ctx, "fetch next")
+	defer span.End()
+
+	feed, err := a.nextFeed(ctx, fetching)
+	if errors.Is(err, sql.ErrNoRows) {
+		aggLag.Set(0)
+		return
+	}
+	if err != nil {
+		slog.Error("couldn't get feed", "err", err)
+		return
+	}
+	aggLag.Set(a.lag(feed).Seconds())
+
+	a.start(feed)
+	a.wg.Go(func() {
+		logger := fetchLogger(feed)
+		ctx := trace.ContextWithSpan(withLogger(a.ctx, logger), span)
+		ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		defer cancel()
+
+		logger.Debug("fetching feed", "feed_name", feed.Name)
+		found, created, err := collectFeed(ctx, a.s, feed)
+		a.finish(feed.ID, err)
+		if err != nil {
+			// Rate limits and server errors usually pass, so they are
+			// only warnings.
+			level := slog.LevelError
+			var se *statusError
+			var be *backedOffError
+			if errors.As(err, &se) && se.Temporary() || errors.As(err, &be) {
+				level = slog.LevelWarn
+			}
+			logger.Log(ctx, level, "couldn't fetch feed", "err", err)
+			return
+		}
+		logger.Info("feed collected", "feed_name", feed.Name,
+			"posts", created, "found", found)
+	})
+}
+
+// nextFeed picks the feed to fetch among those not being fetched,
+// skipping the feeds of the hosts that backed off past the timeout of a
+// fetch, which would only hold a fetch waiting for them. Having no feed
+// to fetch isn't a failure.
+func (a *aggregator) nextFeed(ctx context.Context, fetching []uuid.UUID,
+) (feed database.Feed, err error) {
+	ctx, span := tracer.Start(ctx, "GetNextFeedToFetch",
+		trace.WithAttributes(attribute.Int("feeds.fetching", len(fetching))))
+	defer func() {
+		if errors.Is(err, sql.ErrNoRows) {
+			span.End()
+		} else {
+			endSpan(span, err)
+		}
+	}()
+
+	skip := slices.Clone(fetching)
+	deadline := time.Now().Add(fetchTimeout)
+	for {
+		feed, err := a.s.db.GetNextFeedToFetch(ctx, skip)
+		if err != nil || !a.s.fetcher.backedOff(feed.Url, deadline) {
+			span.SetAttributes(attribute.Int("feeds.backed_off", len(skip)-len(fetching)))
+			return feed, err
+		}
+		skip = append(skip, feed.ID)
+	}
+}
+
+// round is how long agg takes to attempt every feed of its feed set, one
+// per interval. A feed is due once a round has passed since its last
+// attempt.
+func (a *aggregator) round() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.interval * time.Duration(max(len(a.feeds), 1))
+}
+
+// lag returns how overdue feed is, which is how far behind agg is when
+// it is the least recently attempted feed.
+func (a *aggregator) lag(feed database.Feed) time.Duration {
+	last := feed.CreatedAt
+	if feed.LastAttemptedAt.Valid {
+		last = feed.LastAttemptedAt.Time
+	}
+	return max(time.Since(last)-a.round(), 0)
+}
+
+// fetching returns the ids of the feeds being fetched.
+func (a *aggregator) fetching() []uuid.UUID {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ids := []uuid.UUID{}
+	for id, f := range a.feeds {
+		if f.Fetching {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (a *aggregator) start(feed database.Feed) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, ok := a.feeds[feed.ID]
+	if !ok {
+		// Added since the feed set was loaded.
+		f = newAggFeedStatus(feed)
+		a.feeds[feed.ID] = f
+		aggFeeds.Set(float64(len(a.feeds)))
+	}
+	now := time.Now().UTC()
+	f.Fetching = true
+	f.LastAttemptAt = &now
+}
+
+func (a *aggregator) finish(id uuid.UUID, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.fetches++
+	f := a.feeds[id]
+	f.Fetching = false
+	if err != nil {
+		a.failures++
+		f.LastError = err.Error()
+		return
+	}
+	now := time.Now().UTC()
+	f.LastSuccessAt = &now
+	f.LastError = ""
+}
+
+func newAggFeedStatus(feed database.Feed) *aggFeedStatus {
+	f := &aggFeedStatus{ID: feed.ID}
+	f.update(feed)
+	if feed.LastAttemptedAt.Valid {
+		f.LastAttemptAt = &feed.LastAttemptedAt.Time
+	}
+	if feed.LastFetchedAt.Valid {
+		f.LastSuccessAt = &feed.LastFetchedAt.Time
+	}
+	return f
+}
+
+func (f *aggFeedStatus) update(feed database.Feed) {
+	f.Name = feed.Name
+	f.URL = feed.Url
+}
+
+// loadFeeds loads the feed set from the database, keeping the state of
+// the feeds already known. Feeds no one follows are left out.
+func (a *aggregator) loadFeeds() error {
+	feeds, err := a.s.db.GetFeeds(a.ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get feeds: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	loaded := make(map[uuid.UUID]*aggFeedStatus, len(feeds))
+	for _, feed := range feeds {
+		if feed.OrphanedAt.Valid {
+			continue
+		}
+		f, ok := a.feeds[feed.ID]
+		if ok {
+			f.update(feed)
+		} else {
+			f = newAggFeedStatus(feed)
+		}
+		loaded[feed.ID] = f
+	}
+	// Feeds removed while being fetched stay until the fetch ends.
+	for id, f := range a.feeds {
+		if _, ok := loaded[id]; !ok && f.Fetching {
+			loaded[id] = f
+		}
+	}
+	a.feeds = loaded
+	aggFeeds.Set(float64(len(a.feeds)))
+	return nil
+}
+
+// reload rereads the config file and the feed set, on SIGHUP.
+func (a *aggregator) reload() {
+	cfg, err := config.Read()
+	if err != nil {
+		slog.Error("couldn't reload config", "err", err)
+	} else {
+		if cfg.DBURL != a.s.cfg.DBURL {
+			slog.Warn("db_url changed, restart agg to use it")
+			cfg.DBURL = a.s.cfg.DBURL
+		}
+		if cfg.TraceExporter != a.s.cfg.TraceExporter ||
+			cfg.TraceEndpoint != a.s.cfg.TraceEndpoint {
+			slog.Warn("tracing settings changed, restart agg to use them")
+		}
+		*a.s.cfg = cfg
+		if err := a.s.applyLogConfig(); err != nil {
+			slog.Error("couldn't reload logging", "err", err)
+		}
+		if err := a.s.fetcher.configure(&cfg); err != nil {
+			slog.Error("couldn't reload politeness", "err", err)
+		}
+	}
+
+	if err := a.loadFeeds(); err != nil {
+		slog.Error("couldn't reload feeds", "err", err)
+		return
+	}
+	a.mu.Lock()
+	n := len(a.feeds)
+	a.mu.Unlock()
+	slog.Info("reloaded config and feeds", "feeds", n)
+}
+
+// shutdown stops agg, waiting up to the drain timeout for the fetches
+// in flight. They are canceled after the timeout or on a second signal.
+func (a *aggregator) shutdown(sigch <-chan os.Signal) {
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+
+	if n := len(a.fetching()); n > 0 {
+		slog.Info("waiting for fetches to finish", "fetching", n, "timeout", a.drain)
+	}
+	timeout := time.NewTimer(a.drain)
+	defer timeout.Stop()
+	for stop := false; !stop; {
+		select {
+		case <-done:
+			stop = true
+		case <-timeout.C:
+			slog.Warn("fetches didn't finish in time, canceling them", "timeout", a.drain)
+			a.cancel()
+		case sig := <-sigch:
+			if sig == syscall.SIGINT || sig == syscall.SIGTERM {
+				slog.Warn("canceling fetches")
+				a.cancel()
+			}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	slog.Info("scraping ended", "fetches", a.fetches)
+}
+
+// status returns a snapshot of the state of agg.
+func (a *aggregator) status() aggStatus {
+	due, err := a.s.db.CountDueFeeds(a.ctx, time.Now().UTC().Add(-a.round()))
+	if err != nil {
+		slog.Error("couldn't count due feeds", "err", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st := aggStatus{
+		PID:       os.Getpid(),
+		StartedAt: a.started,
+		Uptime:    time.Since(a.started).Round(time.Second).String(),
+		Interval:  a.interval.String(),
+		Fetches:   a.fetches,
+		Failures:  a.failures,
+	}
+	if err == nil {
+		st.DueFeeds = &due
+	}
+	for _, f := range a.feeds {
+		st.Feeds = append(st.Feeds, *f)
+	}
+	slices.SortFunc(st.Feeds, func(x, y aggFeedStatus) int {
+		return strings.Compare(x.Name, y.Name)
+	})
+	return st
+}
+
+// dump logs the state of agg, a line per feed, on SIGUSR1.
+func (a *aggregator) dump() {
+	st := a.status()
+	attrs := []any{"started_at", st.StartedAt, "uptime", st.Uptime,
+		"fetches", st.Fetches, "failures", st.Failures, "feeds", len(st.Feeds)}
+	if st.DueFeeds != nil {
+		attrs = append(attrs, "due_feeds", *st.DueFeeds)
+	}
+	slog.Info("scheduler state", attrs...)
+	for _, f := range st.Feeds {
+		attrs := []any{"feed_id", f.ID, "feed_url", f.URL, "feed_name", f.Name,
+			"fetching", f.Fetching}
+		if f.LastAttemptAt != nil {
+			attrs = append(attrs, "last_attempt_at", *f.LastAttemptAt)
+		}
+		if f.LastSuccessAt != nil {
+			attrs = append(attrs, "last_success_at", *f.LastSuccessAt)
+		}
+		if f.LastError != "" {
+			attrs = append(attrs, "last_error", f.LastError)
+		}
+		slog.Info("feed state", attrs...)
+	}
+}
+
+// defaultSocketPath is where agg serves its status, in the user's
+// runtime directory when there is one.
+func defaultSocketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, fmt.Sprintf("gogator-%d.sock", os.Getuid()))
+}
+
+// listenStatus listens on the status socket. A socket left behind by an
+// agg that didn't exit cleanly is replaced, one still served isn't.
+func listenStatus(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("agg is already running, its socket is %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("couldn't remove stale socket: %w", err)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("couldn't restrict socket: %w", err)
+	}
+	return ln, nil
+}
+
+// serveStatus writes the status as JSON to every connection. Clients
+// that hang up early, such as another agg checking whether one is
+// running, are ignored.
+func (a *aggregator) serveStatus(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		json.NewEncoder(conn).Encode(a.status())
+		conn.Close()
+	}
+}
+
+func handlerStatus(s *state, cmd command) error {
+	path := cmd.flagString("socket")
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return fmt.Errorf("agg isn't running, there's no socket at %s", path)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var st aggStatus
+	if err := json.NewDecoder(conn).Decode(&st); err != nil {
+		return fmt.Errorf("couldn't read status: %w", err)
+	}
+
+	due := "unknown"
+	if st.DueFeeds != nil {
+		due = strconv.FormatInt(*st.DueFeeds, 10)
+	}
+	s.out.noticef("agg (pid %d) running since %s (up %s), fetching every %s: "+
+		"%d fetches, %d failures, %s feeds due.\n",
+		st.PID, st.StartedAt.Local().Format(time.DateTime), st.Uptime, st.Interval,
+		st.Fetches, st.Failures, due)
+	l := newListing("id", "name", "url", "fetching", "last_attempt_at",
+		"last_success_at", "last_error")
+	for _, f := range st.Feeds {
+		var lastErr any
+		if f.LastError != "" {
+			lastErr = f.LastError
+		}
+		l.add(f.ID, f.Name, f.URL, f.Fetching, optTime(f.LastAttemptAt),
+			optTime(f.LastSuccessAt), lastErr)
+	}
+	return s.out.render(l)
+}
+
+func optTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
@@ -0,0 +1,704 @@
+package gogator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/prchop/gogator/internal/database"
+)
+
+// apiPrefix is the mount point of the versioned JSON API.
+const apiPrefix = "/api/v1"
+
+const (
+	apiDefaultLimit = 20
+	apiMaxLimit     = 500
+	// apiMaxBody caps the size of request bodies.
+	apiMaxBody = 1 << 20
+)
+
+// apiError is an error with the HTTP status to report it with.
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e *apiError) Error() string {
+	return e.msg
+}
+
+func apiErrorf(status int, format string, a ...any) error {
+	return &apiError{status: status, msg: fmt.Sprintf(format, a...)}
+}
+
+// apiHandler serves an API route for an authenticated user. The
+// returned value is encoded as JSON, a nil value sends no content.
+type apiHandler func(r *http.Request, user database.User) (any, error)
+
+type apiParam struct {
+	name string
+	in   string
+	typ  string
+	desc string
+}
+
+// apiRoute describes a route of the API. The same description is used
+// to serve it and to generate the OpenAPI document.
+type apiRoute struct {
+	method  string
+	path    string
+	summary string
+	params  []apiParam
+	// body and resp are zero values of the request and response types.
+	body   any
+	resp   any
+	status int
+	handle apiHandler
+}
+
+// apiStore is the part of the database used by the API handlers.
+type apiStore interface {
+	tokenStore
+	postStore
+	postStateStore
+	GetAllUsers(ctx context.Context) ([]database.User, error)
+	GetFeeds(ctx context.Context) ([]database.Feed, error)
+	GetFeedByID(ctx context.Context, id uuid.UUID) (database.Feed, error)
+	CreateFeed(ctx context.Context, arg database.CreateFeedParams) (database.Feed, error)
+	GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetFeedFollowsForUserRow, error)
+	CreateFeedFollow(ctx context.Context, arg database.CreateFeedFollowParams) (database.CreateFeedFollowRow, error)
+	DeleteFeedFollow(ctx context.Context, arg database.DeleteFeedFollowParams) error
+	GetPostByID(ctx context.Context, id uuid.UUID) (database.Post, error)
+	GetPostStates(ctx context.Context, arg database.GetPostStatesParams) ([]database.GetPostStatesRow, error)
+}
+
+type apiServer struct {
+	s      *state
+	db     apiStore
+	routes []apiRoute
+}
+
+// newAPIHandler returns the handler of the JSON API, ready to be
+// mounted on apiPrefix or served by httptest.
+func newAPIHandler(s *state) http.Handler {
+	return newAPIServer(s, s.db).handler()
+}
+
+func newAPIServer(s *state, db apiStore) *apiServer {
+	a := &apiServer{s: s, db: db}
+	a.routes = a.apiRoutes()
+	return a
+}
+
+func (a *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range a.routes {
+		mux.Handle(rt.method+" "+apiPrefix+rt.path, a.wrap(rt))
+	}
+	mux.HandleFunc("GET "+apiPrefix+"/openapi.json", a.handleOpenAPI)
+	mux.HandleFunc(apiPrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, apiErrorf(http.StatusNotFound, "no such route"))
+	})
+	return mux
+}
+
+// API representations of the database rows.
+type (
+	apiUser struct {
+		ID        uuid.UUID `json:"id"`
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"created_at"`
+		IsAdmin   bool      `json:"is_admin"`
+	}
+
+	apiFeed struct {
+		ID              uuid.UUID  `json:"id"`
+		CreatedAt       time.Time  `json:"created_at"`
+		UpdatedAt       time.Time  `json:"updated_at"`
+		Name            string     `json:"name"`
+		URL             string     `json:"url"`
+		User            string     `json:"user,omitempty"`
+		LastFetchedAt   *time.Time `json:"last_fetched_at"`
+		LastAttemptedAt *time.Time `json:"last_attempted_at"`
+	}
+
+	apiFollow struct {
+		ID        uuid.UUID `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		FeedID    uuid.UUID `json:"feed_id"`
+		FeedName  string    `json:"feed_name"`
+		FeedURL   string    `json:"feed_url"`
+	}
+
+	apiPost struct {
+		ID          uuid.UUID  `json:"id"`
+		CreatedAt   time.Time  `json:"created_at"`
+		Title       string     `json:"title"`
+		URL         string     `json:"url"`
+		Description *string    `json:"description"`
+		PublishedAt *time.Time `json:"published_at"`
+		FeedID      uuid.UUID  `json:"feed_id"`
+		Read        bool       `json:"read"`
+		Starred     bool       `json:"starred"`
+		Cursor      string     `json:"cursor"`
+	}
+
+	apiPostPage struct {
+		Posts []apiPost `json:"posts"`
+		// Next and Prev are the URLs of the neighbouring pages.
+		Next *string `json:"next"`
+		Prev *string `json:"prev"`
+	}
+
+	apiFetchResult struct {
+		FeedID     uuid.UUID `json:"feed_id"`
+		PostsFound int       `json:"posts_found"`
+		PostsNew   int       `json:"posts_new"`
+	}
+
+	apiNewFeed struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	}
+
+	apiNewFollow struct {
+		URL string `json:"url"`
+	}
+
+	apiErrorBody struct {
+		Error string `json:"error"`
+	}
+)
+
+func (a *apiServer) apiRoutes() []apiRoute {
+	postFilters := []apiParam{
+		{"limit", "query", "integer", "maximum number of posts (default 20, max 500)"},
+		{"before", "query", "string", "only posts before this cursor"},
+		{"after", "query", "string", "only posts after this cursor"},
+		{"feed", "query", "string", "only posts of this feed (url or name)"},
+		{"since", "query", "string", "only posts published within this duration (e.g. 24h, 7d)"},
+		{"order", "query", "string", "newest (default) or oldest"},
+		{"unread", "query", "boolean", "only posts the user hasn't read"},
+		{"starred", "query", "boolean", "only posts the user has starred"},
+	}
+
+	return []apiRoute{
+		{method: "GET", path: "/me", summary: "Get the authenticated user",
+			resp: apiUser{}, handle: a.handleMe},
+		{method: "GET", path: "/users", summary: "List users",
+			resp: []apiUser{}, handle: a.handleUsers},
+		{method: "GET", path: "/feeds", summary: "List feeds",
+			resp: []apiFeed{}, handle: a.handleFeeds},
+		{method: "POST", path: "/feeds", summary: "Add a feed and follow it",
+			body: apiNewFeed{}, resp: apiFeed{}, status: http.StatusCreated,
+			handle: a.handleCreateFeed},
+		{method: "POST", path: "/feeds/{id}/fetch", summary: "Fetch a feed now",
+			resp: apiFetchResult{}, handle: a.handleFetchFeed},
+		{method: "GET", path: "/follows", summary: "List the feeds the user follows",
+			resp: []apiFollow{}, handle: a.handleFollows},
+		{method: "POST", path: "/follows", summary: "Follow a feed",
+			body: apiNewFollow{}, resp: apiFollow{}, status: http.StatusCreated,
+			handle: a.handleFollow},
+		{method: "DELETE", path: "/follows/{feed_id}", summary: "Unfollow a feed",
+			handle: a.handleUnfollow},
+		{method: "GET", path: "/posts", summary: "List posts",
+			params: postFilters, resp: apiPostPage{}, handle: a.handlePosts},
+		{method: "GET", path: "/posts/{id}", summary: "Get a post",
+			resp: apiPost{}, handle: a.handlePost},
+		{method: "PUT", path: "/posts/{id}/read", summary: "Mark a post read",
+			handle: a.handleSetRead(true)},
+		{method: "DELETE", path: "/posts/{id}/read", summary: "Mark a post unread",
+			handle: a.handleSetRead(false)},
+		{method: "PUT", path: "/posts/{id}/star", summary: "Star a post",
+			handle: a.handleSetStar(true)},
+		{method: "DELETE", path: "/posts/{id}/star", summary: "Unstar a post",
+			handle: a.handleSetStar(false)},
+	}
+}
+
+func (a *apiServer) wrap(rt apiRoute) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := scopeWrite
+		if rt.method == http.MethodGet {
+			scope = scopeRead
+		}
+		user, err := a.authenticate(r, scope)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		v, err := rt.handle(r, user)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		if v == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		status := rt.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		writeJSON(w, status, v)
+	})
+}
+
+// authenticate returns the owner of the bearer token of the request,
+// which must grant scope.
+func (a *apiServer) authenticate(r *http.Request, scope string) (database.User, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return database.User{}, apiErrorf(http.StatusUnauthorized,
+			"missing bearer token")
+	}
+
+	user, tokenScope, err := authenticateToken(r.Context(), a.db, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, apiErrorf(http.StatusUnauthorized,
+			"invalid or expired bearer token")
+	}
+	if err == nil && !scopeAllows(tokenScope, scope) {
+		return database.User{}, apiErrorf(http.StatusForbidden,
+			"the bearer token is read only")
+	}
+	return user, err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		slog.Error("couldn't write response", "err", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	msg := "internal server error"
+
+	var (
+		ae *apiError
+		ue *usageError
+	)
+	switch {
+	case errors.As(err, &ae):
+		status, msg = ae.status, ae.msg
+	case errors.As(err, &ue):
+		status, msg = http.StatusBadRequest, ue.msg
+	case errors.Is(err, errNotFound), errors.Is(err, sql.ErrNoRows):
+		status, msg = http.StatusNotFound, "not found"
+	case errors.Is(err, errUnauthorized):
+		status, msg = http.StatusUnauthorized, err.Error()
+	case isUniqueViolation(err):
+		status, msg = http.StatusConflict, "already exists"
+	default:
+		slog.Error("api request failed", "err", err)
+	}
+	writeJSON(w, status, apiErrorBody{Error: msg})
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation,
+// e.g. when adding a feed that already exists.
+func isUniqueViolation(err error) bool {
+	var pe *pq.Error
+	return errors.As(err, &pe) && pe.Code == "23505"
+}
+
+// decodeBody decodes the JSON request body into v.
+func decodeBody(r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, apiMaxBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return apiErrorf(http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	return nil
+}
+
+func pathUUID(r *http.Request, name string) (uuid.UUID, error) {
+	id, err := uuid.Parse(r.PathValue(name))
+	if err != nil {
+		return uuid.Nil, apiErrorf(http.StatusBadRequest, "invalid %s %q",
+			name, r.PathValue(name))
+	}
+	return id, nil
+}
+
+func queryBool(q url.Values, name string) (bool, error) {
+	v := q.Get(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, apiErrorf(http.StatusBadRequest, "invalid %s %q", name, v)
+	}
+	return b, nil
+}
+
+func toAPIUser(u database.User) apiUser {
+	return apiUser{ID: u.ID, Name: u.Name, CreatedAt: u.CreatedAt, IsAdmin: u.IsAdmin}
+}
+
+func toAPIFeed(f database.Feed, user string) apiFeed {
+	af := apiFeed{
+		ID:        f.ID,
+		CreatedAt: f.CreatedAt,
+		UpdatedAt: f.UpdatedAt,
+		Name:      f.Name,
+		URL:       f.Url,
+		User:      user,
+	}
+	if f.LastFetchedAt.Valid {
+		af.LastFetchedAt = &f.LastFetchedAt.Time
+	}
+	if f.LastAttemptedAt.Valid {
+		af.LastAttemptedAt = &f.LastAttemptedAt.Time
+	}
+	return af
+}
+
+func toAPIPost(p database.Post, read, starred bool) apiPost {
+	ap := apiPost{
+		ID:      p.ID,
+		Title:   p.Title,
+		URL:     p.Url,
+		FeedID:  p.FeedID,
+		Read:    read,
+		Starred: starred,
+		Cursor:  postCursor(p).String(),
+	}
+	ap.CreatedAt = p.CreatedAt
+	if p.Description.Valid {
+		ap.Description = &p.Description.String
+	}
+	if p.PublishedAt.Valid {
+		ap.PublishedAt = &p.PublishedAt.Time
+	}
+	return ap
+}
+
+func (a *apiServer) handleMe(r *http.Request, user database.User) (any, error) {
+	return toAPIUser(user), nil
+}
+
+func (a *apiServer) handleUsers(r *http.Request, _ database.User) (any, error) {
+	users, err := a.db.GetAllUsers(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]apiUser, 0, len(users))
+	for _, u := range users {
+		out = append(out, toAPIUser(u))
+	}
+	return out, nil
+}
+
+func (a *apiServer) handleFeeds(r *http.Request, _ database.User) (any, error) {
+	ctx := r.Context()
+	feeds, err := a.db.GetFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names, err := a.userNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]apiFeed, 0, len(feeds))
+	for _, f := range feeds {
+		out = append(out, toAPIFeed(f, names[f.UserID.UUID]))
+	}
+	return out, nil
+}
+
+func (a *apiServer) userNames(ctx context.Context) (map[uuid.UUID]string, error) {
+	users, err := a.db.GetAllUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[uuid.UUID]string, len(users))
+	for _, u := range users {
+		names[u.ID] = u.Name
+	}
+	return names, nil
+}
+
+func (a *apiServer) handleCreateFeed(r *http.Request, user database.User) (any, error) {
+	var body apiNewFeed
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+	if body.Name == "" || body.URL == "" {
+		return nil, apiErrorf(http.StatusBadRequest, "name and url are required")
+	}
+
+	ctx := r.Context()
+	feed, err := a.db.CreateFeed(ctx, database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		Name:      body.Name,
+		Url:       body.URL,
+		UserID:    uuid.NullUUID{UUID: user.ID, Valid: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = a.db.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toAPIFeed(feed, user.Name), nil
+}
+
+func (a *apiServer) handleFetchFeed(r *http.Request, _ database.User) (any, error) {
+	id, err := pathUUID(r, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := r.Context()
+	feed, err := a.db.GetFeedByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	found, created, err := collectFeed(ctx, a.s, feed)
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadGateway, "couldn't fetch feed: %v", err)
+	}
+	return apiFetchResult{FeedID: feed.ID, PostsFound: found, PostsNew: created}, nil
+}
+
+func (a *apiServer) handleFollows(r *http.Request, user database.User) (any, error) {
+	follows, err := a.db.GetFeedFollowsForUser(r.Context(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]apiFollow, 0, len(follows))
+	for _, ff := range follows {
+		out = append(out, apiFollow{
+			ID:        ff.ID,
+			CreatedAt: ff.CreatedAt,
+			FeedID:    ff.FeedID,
+			FeedName:  ff.FeedName,
+			FeedURL:   ff.FeedUrl,
+		})
+	}
+	return out, nil
+}
+
+func (a *apiServer) handleFollow(r *http.Request, user database.User) (any, error) {
+	var body apiNewFollow
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+
+	ctx := r.Context()
+	feed, err := a.db.GetFeedByUrl(ctx, body.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	ff, err := a.db.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return apiFollow{
+		ID:        ff.ID,
+		CreatedAt: ff.CreatedAt,
+		FeedID:    ff.FeedID,
+		FeedName:  ff.FeedName,
+		FeedURL:   feed.Url,
+	}, nil
+}
+
+func (a *apiServer) handleUnfollow(r *http.Request, user database.User) (any, error) {
+	id, err := pathUUID(r, "feed_id")
+	if err != nil {
+		return nil, err
+	}
+	return nil, a.db.DeleteFeedFollow(r.Context(),
+		database.DeleteFeedFollowParams{UserID: user.ID, FeedID: id})
+}
+
+func (a *apiServer) handlePosts(r *http.Request, user database.User) (any, error) {
+	q := r.URL.Query()
+	f := postFilter{
+		limit:  apiDefaultLimit,
+		before: q.Get("before"),
+		after:  q.Get("after"),
+		feed:   q.Get("feed"),
+		since:  q.Get("since"),
+		order:  q.Get("order"),
+		userID: user.ID,
+	}
+	if f.order == "" {
+		f.order = "newest"
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n > apiMaxLimit {
+			return nil, apiErrorf(http.StatusBadRequest,
+				"invalid limit %q, expected at most %d", v, apiMaxLimit)
+		}
+		f.limit = n
+	}
+
+	var err error
+	if f.unread, err = queryBool(q, "unread"); err != nil {
+		return nil, err
+	}
+	if f.starred, err = queryBool(q, "starred"); err != nil {
+		return nil, err
+	}
+	if _, err := f.params(); err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, "%v", err)
+	}
+
+	ctx := r.Context()
+	posts, err := queryPosts(ctx, a.db, f)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := a.withStates(ctx, user, posts)
+	if err != nil {
+		return nil, err
+	}
+
+	page := apiPostPage{Posts: out}
+	if len(posts) > 0 {
+		next, prev := pageCursors(posts)
+		forward, backward := "before", "after"
+		if f.order == "oldest" {
+			forward, backward = backward, forward
+		}
+		page.Next = pageURL(r.URL, forward, next)
+		page.Prev = pageURL(r.URL, backward, prev)
+	}
+	return page, nil
+}
+
+// pageURL returns u with its cursor replaced by the given one.
+func pageURL(u *url.URL, param, cursor string) *string {
+	q := u.Query()
+	q.Del("before")
+	q.Del("after")
+	q.Set(param, cursor)
+	s := u.Path + "?" + q.Encode()
+	return &s
+}
+
+// withStates attaches the user's read and starred state to posts.
+func (a *apiServer) withStates(ctx context.Context, user database.User,
+	posts []database.Post,
+) ([]apiPost, error) {
+	ids := make([]uuid.UUID, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+
+	states, err := a.db.GetPostStates(ctx, database.GetPostStatesParams{
+		UserID:  user.ID,
+		PostIds: ids,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uuid.UUID]database.GetPostStatesRow, len(states))
+	for _, st := range states {
+		byID[st.ID] = st
+	}
+
+	out := make([]apiPost, 0, len(posts))
+	for _, p := range posts {
+		st := byID[p.ID]
+		out = append(out, toAPIPost(p, st.Read, st.Starred))
+	}
+	return out, nil
+}
+
+func (a *apiServer) handlePost(r *http.Request, user database.User) (any, error) {
+	id, err := pathUUID(r, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := r.Context()
+	post, err := a.db.GetPostByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := a.withStates(ctx, user, []database.Post{post})
+	if err != nil {
+		return nil, err
+	}
+	return out[0], nil
+}
+
+func (a *apiServer) handleSetRead(read bool) apiHandler {
+	return func(r *http.Request, user database.User) (any, error) {
+		id, err := pathUUID(r, "id")
+		if err != nil {
+			return nil, err
+		}
+
+		ctx := r.Context()
+		if _, err := a.db.GetPostByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, setPostRead(ctx, a.db, user.ID, id, read)
+	}
+}
+
+func (a *apiServer) handleSetStar(star bool) apiHandler {
+	return func(r *http.Request, user database.User) (any, error) {
+		id, err := pathUUID(r, "id")
+		if err != nil {
+			return nil, err
+		}
+
+		ctx := r.Context()
+		if _, err := a.db.GetPostByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, setPostStarred(ctx, a.db, user.ID, id, star)
+	}
+}
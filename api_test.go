@@ -0,0 +1,668 @@
+package gogator
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prchop/gogator/internal/config"
+	"github.com/prchop/gogator/internal/database"
+)
+
+// memStore is an apiStore keeping its users, feeds, follows and posts
+// in memory, so the API can be tested without Postgres.
+type memStore struct {
+	mu    sync.Mutex
+	users []database.User
+	// tokens maps the hashes of the API tokens of the first user to
+	// their scope.
+	tokens  map[string]string
+	feeds   []database.Feed
+	follows []database.FeedFollow
+	posts   []database.Post
+	read    map[postKey]bool
+	starred map[postKey]bool
+}
+
+type postKey struct {
+	user, post uuid.UUID
+}
+
+func (m *memStore) GetAPIToken(_ context.Context, arg database.GetAPITokenParams,
+) (database.GetAPITokenRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	scope, ok := m.tokens[arg.TokenHash]
+	if !ok {
+		return database.GetAPITokenRow{}, sql.ErrNoRows
+	}
+	return database.GetAPITokenRow{
+		User: m.users[0],
+		ApiToken: database.ApiToken{ID: uuid.New(), UserID: m.users[0].ID,
+			TokenHash: arg.TokenHash, Scope: scope},
+	}, nil
+}
+
+func (m *memStore) TouchAPIToken(context.Context, database.TouchAPITokenParams) error {
+	return nil
+}
+
+func (m *memStore) GetUserBySession(context.Context, database.GetUserBySessionParams,
+) (database.User, error) {
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *memStore) GetAllUsers(context.Context) ([]database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.users), nil
+}
+
+func (m *memStore) GetFeeds(context.Context) ([]database.Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.feeds), nil
+}
+
+func (m *memStore) feed(match func(database.Feed) bool) (database.Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := slices.IndexFunc(m.feeds, match); i >= 0 {
+		return m.feeds[i], nil
+	}
+	return database.Feed{}, sql.ErrNoRows
+}
+
+func (m *memStore) GetFeedByID(_ context.Context, id uuid.UUID) (database.Feed, error) {
+	return m.feed(func(f database.Feed) bool { return f.ID == id })
+}
+
+func (m *memStore) GetFeedByUrl(_ context.Context, url string) (database.Feed, error) {
+	return m.feed(func(f database.Feed) bool { return f.Url == url })
+}
+
+func (m *memStore) GetFeedsByName(_ context.Context, name string) ([]database.Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var feeds []database.Feed
+	for _, f := range m.feeds {
+		if f.Name == name {
+			feeds = append(feeds, f)
+		}
+	}
+	return feeds, nil
+}
+
+func (m *memStore) CreateFeed(_ context.Context, arg database.CreateFeedParams,
+) (database.Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := database.Feed{ID: arg.ID, CreatedAt: arg.CreatedAt, UpdatedAt: arg.UpdatedAt,
+		Name: arg.Name, Url: arg.Url, UserID: arg.UserID}
+	m.feeds = append(m.feeds, f)
+	return f, nil
+}
+
+func (m *memStore) GetFeedFollowsForUser(_ context.Context, userID uuid.UUID,
+) ([]database.GetFeedFollowsForUserRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rows []database.GetFeedFollowsForUserRow
+	for _, ff := range m.follows {
+		if ff.UserID != userID {
+			continue
+		}
+		i := slices.IndexFunc(m.feeds, func(f database.Feed) bool { return f.ID == ff.FeedID })
+		rows = append(rows, database.GetFeedFollowsForUserRow{ID: ff.ID,
+			CreatedAt: ff.CreatedAt, UserID: ff.UserID, FeedID: ff.FeedID,
+			FeedName: m.feeds[i].Name, FeedUrl: m.feeds[i].Url})
+	}
+	return rows, nil
+}
+
+func (m *memStore) CreateFeedFollow(_ context.Context, arg database.CreateFeedFollowParams,
+) (database.CreateFeedFollowRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.feeds, func(f database.Feed) bool { return f.ID == arg.FeedID })
+	if i < 0 {
+		return database.CreateFeedFollowRow{}, sql.ErrNoRows
+	}
+	m.follows = append(m.follows, database.FeedFollow(arg))
+	return database.CreateFeedFollowRow{ID: arg.ID, CreatedAt: arg.CreatedAt,
+		UserID: arg.UserID, FeedID: arg.FeedID, FeedName: m.feeds[i].Name}, nil
+}
+
+func (m *memStore) DeleteFeedFollow(_ context.Context, arg database.DeleteFeedFollowParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.follows = slices.DeleteFunc(m.follows, func(ff database.FeedFollow) bool {
+		return ff.UserID == arg.UserID && ff.FeedID == arg.FeedID
+	})
+	return nil
+}
+
+func (m *memStore) GetPostByID(_ context.Context, id uuid.UUID) (database.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := slices.IndexFunc(m.posts, func(p database.Post) bool { return p.ID == id }); i >= 0 {
+		return m.posts[i], nil
+	}
+	return database.Post{}, sql.ErrNoRows
+}
+
+// comparePosts orders posts the way the queries page them.
+func comparePosts(a, b cursor) int {
+	return cmp.Or(a.time.Compare(b.time), bytes.Compare(a.id[:], b.id[:]))
+}
+
+// listPosts selects posts like GetPostsNewest and GetPostsOldest.
+func (m *memStore) listPosts(arg database.GetPostsNewestParams, newest bool) []database.Post {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var posts []database.Post
+	for _, p := range m.posts {
+		c := postCursor(p)
+		key := postKey{arg.UserID.UUID, p.ID}
+		switch {
+		case arg.FeedID.Valid && p.FeedID != arg.FeedID.UUID,
+			arg.Since.Valid && c.time.Before(arg.Since.Time),
+			arg.BeforeTime.Valid && comparePosts(c, cursor{arg.BeforeTime.Time, arg.BeforeID.UUID}) >= 0,
+			arg.AfterTime.Valid && comparePosts(c, cursor{arg.AfterTime.Time, arg.AfterID.UUID}) <= 0,
+			arg.UnreadOnly && m.read[key],
+			arg.StarredOnly && !m.starred[key]:
+			continue
+		}
+		posts = append(posts, p)
+	}
+	slices.SortFunc(posts, func(a, b database.Post) int {
+		if newest {
+			a, b = b, a
+		}
+		return comparePosts(postCursor(a), postCursor(b))
+	})
+	return posts[:min(len(posts), int(arg.Limit))]
+}
+
+func (m *memStore) GetPostsNewest(_ context.Context, arg database.GetPostsNewestParams,
+) ([]database.Post, error) {
+	return m.listPosts(arg, true), nil
+}
+
+func (m *memStore) GetPostsOldest(_ context.Context, arg database.GetPostsOldestParams,
+) ([]database.Post, error) {
+	return m.listPosts(database.GetPostsNewestParams(arg), false), nil
+}
+
+func (m *memStore) GetPostStates(_ context.Context, arg database.GetPostStatesParams,
+) ([]database.GetPostStatesRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rows []database.GetPostStatesRow
+	for _, id := range arg.PostIds {
+		key := postKey{arg.UserID, id}
+		rows = append(rows, database.GetPostStatesRow{ID: id,
+			Read: m.read[key], Starred: m.starred[key]})
+	}
+	return rows, nil
+}
+
+func (m *memStore) setState(states map[postKey]bool, user, post uuid.UUID, value bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	states[postKey{user, post}] = value
+	return nil
+}
+
+func (m *memStore) MarkPostRead(_ context.Context, arg database.MarkPostReadParams) error {
+	return m.setState(m.read, arg.UserID, arg.PostID, true)
+}
+
+func (m *memStore) MarkPostUnread(_ context.Context, arg database.MarkPostUnreadParams) error {
+	return m.setState(m.read, arg.UserID, arg.PostID, false)
+}
+
+func (m *memStore) StarPost(_ context.Context, arg database.StarPostParams) error {
+	return m.setState(m.starred, arg.UserID, arg.PostID, true)
+}
+
+func (m *memStore) UnstarPost(_ context.Context, arg database.UnstarPostParams) error {
+	return m.setState(m.starred, arg.UserID, arg.PostID, false)
+}
+
+// Tokens of the API tests, by scope.
+const (
+	testWriteToken = "write-token"
+	testReadToken  = "read-token"
+)
+
+var (
+	testUser = database.User{
+		ID:        uuid.MustParse("00000000-0000-0000-0000-0000000000a1"),
+		CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Name:      "alice",
+	}
+	testFeed = database.Feed{
+		ID:        uuid.MustParse("00000000-0000-0000-0000-0000000000f1"),
+		CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Name:      "Go Blog",
+		Url:       "https://go.dev/blog/feed.atom",
+	}
+	testOtherFeed = database.Feed{
+		ID:        uuid.MustParse("00000000-0000-0000-0000-0000000000f2"),
+		CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Name:      "Other Blog",
+		Url:       "https://example.com/feed.xml",
+	}
+)
+
+// testPosts returns n posts of feed published a day apart, newest
+// first, ending at the given time. Times are stored with microsecond
+// precision, like Postgres does.
+func testPosts(feed database.Feed, n int, newest time.Time) []database.Post {
+	posts := make([]database.Post, n)
+	for i := range posts {
+		at := newest.UTC().Truncate(time.Microsecond).AddDate(0, 0, -i)
+		posts[i] = database.Post{
+			ID:          uuid.New(),
+			CreatedAt:   at,
+			UpdatedAt:   at,
+			Title:       fmt.Sprintf("%s %d", feed.Name, i+1),
+			Url:         fmt.Sprintf("%s/%d", feed.Url, i+1),
+			PublishedAt: sql.NullTime{Time: at, Valid: true},
+			FeedID:      feed.ID,
+		}
+	}
+	return posts
+}
+
+// newTestServer serves the API over a memStore holding testUser, its
+// tokens, testFeed and testOtherFeed, and posts.
+func newTestServer(t *testing.T, posts []database.Post) (*httptest.Server, *memStore) {
+	t.Helper()
+	db := &memStore{
+		users: []database.User{testUser},
+		tokens: map[string]string{
+			hashToken(testWriteToken): scopeWrite,
+			hashToken(testReadToken):  scopeRead,
+		},
+		feeds:   []database.Feed{testFeed, testOtherFeed},
+		posts:   posts,
+		read:    map[postKey]bool{},
+		starred: map[postKey]bool{},
+	}
+	s := &state{cfg: &config.Settings{}}
+	srv := httptest.NewServer(newAPIServer(s, db).handler())
+	t.Cleanup(srv.Close)
+	return srv, db
+}
+
+// request sends a request with token, unless empty, and body encoded as
+// JSON, unless nil. It decodes the JSON response into v, unless nil.
+func request(t *testing.T, srv *httptest.Server, method, path, token string, body, v any) int {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if v != nil && res.StatusCode < 300 {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: couldn't decode response: %v", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+// titles returns the titles of the posts of page.
+func titles(page apiPostPage) []string {
+	out := make([]string, len(page.Posts))
+	for i, p := range page.Posts {
+		out[i] = p.Title
+	}
+	return out
+}
+
+func TestAPIAuth(t *testing.T) {
+	posts := testPosts(testFeed, 1, time.Now())
+	srv, _ := newTestServer(t, posts)
+	readPath := apiPrefix + "/posts/" + posts[0].ID.String() + "/read"
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		header string
+		want   int
+	}{
+		{name: "missing token", method: "GET", path: apiPrefix + "/me",
+			want: http.StatusUnauthorized},
+		{name: "not a bearer token", method: "GET", path: apiPrefix + "/me",
+			header: "Basic YWxpY2U6c2VjcmV0", want: http.StatusUnauthorized},
+		{name: "bad token", method: "GET", path: apiPrefix + "/me",
+			token: "nope", want: http.StatusUnauthorized},
+		{name: "write token", method: "GET", path: apiPrefix + "/me",
+			token: testWriteToken, want: http.StatusOK},
+		{name: "read-only token reads", method: "GET", path: apiPrefix + "/me",
+			token: testReadToken, want: http.StatusOK},
+		{name: "read-only token writes", method: "PUT", path: readPath,
+			token: testReadToken, want: http.StatusForbidden},
+		{name: "write token writes", method: "PUT", path: readPath,
+			token: testWriteToken, want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.token != "":
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			case tt.header != "":
+				req.Header.Set("Authorization", tt.header)
+			}
+			res, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tt.want {
+				t.Fatalf("got status %d, want %d", res.StatusCode, tt.want)
+			}
+
+			if tt.want >= 400 {
+				var body apiErrorBody
+				if err := json.NewDecoder(res.Body).Decode(&body); err != nil || body.Error == "" {
+					t.Errorf("got error body %+v, %v, want a message", body, err)
+				}
+			}
+		})
+	}
+
+	var me apiUser
+	request(t, srv, "GET", apiPrefix+"/me", testReadToken, nil, &me)
+	if me.ID != testUser.ID || me.Name != testUser.Name {
+		t.Errorf("got user %+v, want %s", me, testUser.Name)
+	}
+}
+
+func TestAPIPostsPagination(t *testing.T) {
+	srv, _ := newTestServer(t, testPosts(testFeed, 5, time.Now()))
+
+	// get returns the page at path, which may be a next or prev link.
+	get := func(path string) apiPostPage {
+		t.Helper()
+		var page apiPostPage
+		if code := request(t, srv, "GET", path, testReadToken, nil, &page); code != http.StatusOK {
+			t.Fatalf("GET %s: got status %d, want 200", path, code)
+		}
+		return page
+	}
+
+	first := get(apiPrefix + "/posts?limit=2")
+	if got, want := titles(first), []string{"Go Blog 1", "Go Blog 2"}; !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if first.Next == nil || first.Prev == nil {
+		t.Fatalf("got next %v and prev %v, want both", first.Next, first.Prev)
+	}
+
+	// The next page starts after the last post, with the same filters.
+	next, err := url.Parse(*first.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := next.Query().Get("before"), first.Posts[1].Cursor; got != want {
+		t.Errorf("got next before=%q, want %q", got, want)
+	}
+	if got := next.Query().Get("limit"); got != "2" {
+		t.Errorf("got next limit=%q, want 2", got)
+	}
+
+	second := get(*first.Next)
+	if got, want := titles(second), []string{"Go Blog 3", "Go Blog 4"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := titles(get(*second.Next)), []string{"Go Blog 5"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := titles(get(*second.Prev)), []string{"Go Blog 1", "Go Blog 2"}; !slices.Equal(got, want) {
+		t.Errorf("paging back: got %q, want %q", got, want)
+	}
+
+	// The oldest order pages the other way.
+	oldest := get(apiPrefix + "/posts?order=oldest&limit=2")
+	if got, want := titles(oldest), []string{"Go Blog 5", "Go Blog 4"}; !slices.Equal(got, want) {
+		t.Errorf("oldest: got %q, want %q", got, want)
+	}
+	if got, want := titles(get(*oldest.Next)), []string{"Go Blog 3", "Go Blog 2"}; !slices.Equal(got, want) {
+		t.Errorf("oldest next: got %q, want %q", got, want)
+	}
+	if got := titles(get(*oldest.Prev)); len(got) != 0 {
+		t.Errorf("oldest prev: got %q, want no posts", got)
+	}
+}
+
+func TestAPIPostsFilters(t *testing.T) {
+	now := time.Now()
+	posts := append(testPosts(testFeed, 3, now), testPosts(testOtherFeed, 3, now.Add(-time.Hour))...)
+	srv, _ := newTestServer(t, posts)
+
+	// Go Blog 2 is read and Other Blog 1 starred.
+	for _, path := range []string{
+		"/posts/" + posts[1].ID.String() + "/read",
+		"/posts/" + posts[3].ID.String() + "/star",
+	} {
+		if code := request(t, srv, "PUT", apiPrefix+path, testWriteToken, nil, nil); code != http.StatusNoContent {
+			t.Fatalf("PUT %s: got status %d, want 204", path, code)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+		// titles are the titles of the posts listed, newest first.
+		titles []string
+	}{
+		{name: "no filters", query: "", want: http.StatusOK, titles: []string{
+			"Go Blog 1", "Other Blog 1", "Go Blog 2", "Other Blog 2", "Go Blog 3", "Other Blog 3"}},
+		{name: "limit", query: "limit=3", want: http.StatusOK, titles: []string{
+			"Go Blog 1", "Other Blog 1", "Go Blog 2"}},
+		{name: "feed by name", query: "feed=" + url.QueryEscape(testFeed.Name),
+			want: http.StatusOK, titles: []string{"Go Blog 1", "Go Blog 2", "Go Blog 3"}},
+		{name: "feed by url", query: "feed=" + url.QueryEscape(testOtherFeed.Url),
+			want: http.StatusOK, titles: []string{"Other Blog 1", "Other Blog 2", "Other Blog 3"}},
+		{name: "since", query: "since=36h", want: http.StatusOK, titles: []string{
+			"Go Blog 1", "Other Blog 1", "Go Blog 2", "Other Blog 2"}},
+		{name: "since days", query: "since=1d", want: http.StatusOK, titles: []string{
+			"Go Blog 1", "Other Blog 1"}},
+		{name: "unread", query: "unread=true&feed=" + url.QueryEscape(testFeed.Name),
+			want: http.StatusOK, titles: []string{"Go Blog 1", "Go Blog 3"}},
+		{name: "starred", query: "starred=1", want: http.StatusOK,
+			titles: []string{"Other Blog 1"}},
+		{name: "unknown feed", query: "feed=nope", want: http.StatusNotFound},
+		{name: "limit too large", query: "limit=501", want: http.StatusBadRequest},
+		{name: "limit not a number", query: "limit=ten", want: http.StatusBadRequest},
+		{name: "zero limit", query: "limit=0", want: http.StatusBadRequest},
+		{name: "bad since", query: "since=yesterday", want: http.StatusBadRequest},
+		{name: "bad order", query: "order=random", want: http.StatusBadRequest},
+		{name: "bad cursor", query: "before=nope", want: http.StatusBadRequest},
+		{name: "bad boolean", query: "unread=maybe", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var page apiPostPage
+			code := request(t, srv, "GET", apiPrefix+"/posts?"+tt.query, testReadToken, nil, &page)
+			if code != tt.want {
+				t.Fatalf("got status %d, want %d", code, tt.want)
+			}
+			if got := titles(page); tt.want == http.StatusOK && !slices.Equal(got, tt.titles) {
+				t.Errorf("got %q, want %q", got, tt.titles)
+			}
+		})
+	}
+}
+
+func TestAPIPostStates(t *testing.T) {
+	posts := testPosts(testFeed, 2, time.Now())
+	srv, _ := newTestServer(t, posts)
+	path := apiPrefix + "/posts/" + posts[0].ID.String()
+
+	steps := []struct {
+		method, path string
+		read, star   bool
+	}{
+		{"PUT", path + "/read", true, false},
+		{"PUT", path + "/star", true, true},
+		{"DELETE", path + "/read", false, true},
+		{"DELETE", path + "/star", false, false},
+	}
+	for _, st := range steps {
+		if code := request(t, srv, st.method, st.path, testWriteToken, nil, nil); code != http.StatusNoContent {
+			t.Fatalf("%s %s: got status %d, want 204", st.method, st.path, code)
+		}
+
+		var post apiPost
+		request(t, srv, "GET", path, testReadToken, nil, &post)
+		if post.Read != st.read || post.Starred != st.star {
+			t.Errorf("after %s %s: got read %v, starred %v, want %v, %v",
+				st.method, st.path, post.Read, post.Starred, st.read, st.star)
+		}
+
+		var page apiPostPage
+		request(t, srv, "GET", apiPrefix+"/posts", testReadToken, nil, &page)
+		if p := page.Posts[1]; p.Read || p.Starred {
+			t.Errorf("after %s %s: the other post is read %v, starred %v",
+				st.method, st.path, p.Read, p.Starred)
+		}
+	}
+
+	missing := apiPrefix + "/posts/" + uuid.NewString() + "/read"
+	if code := request(t, srv, "PUT", missing, testWriteToken, nil, nil); code != http.StatusNotFound {
+		t.Errorf("got status %d for a missing post, want 404", code)
+	}
+	if code := request(t, srv, "PUT", apiPrefix+"/posts/nope/read", testWriteToken, nil, nil); code != http.StatusBadRequest {
+		t.Errorf("got status %d for an invalid id, want 400", code)
+	}
+}
+
+func TestAPIFollows(t *testing.T) {
+	srv, _ := newTestServer(t, nil)
+
+	var follow apiFollow
+	code := request(t, srv, "POST", apiPrefix+"/follows", testWriteToken,
+		apiNewFollow{URL: testFeed.Url}, &follow)
+	if code != http.StatusCreated {
+		t.Fatalf("got status %d, want 201", code)
+	}
+	if follow.FeedID != testFeed.ID || follow.FeedName != testFeed.Name || follow.FeedURL != testFeed.Url {
+		t.Errorf("got %+v, want a follow of %s", follow, testFeed.Name)
+	}
+
+	var feed apiFeed
+	code = request(t, srv, "POST", apiPrefix+"/feeds", testWriteToken,
+		apiNewFeed{Name: "New Blog", URL: "https://example.org/feed"}, &feed)
+	if code != http.StatusCreated {
+		t.Fatalf("got status %d, want 201", code)
+	}
+	if feed.Name != "New Blog" || feed.User != testUser.Name {
+		t.Errorf("got %+v, want New Blog added by %s", feed, testUser.Name)
+	}
+
+	// Adding a feed follows it.
+	var follows []apiFollow
+	request(t, srv, "GET", apiPrefix+"/follows", testReadToken, nil, &follows)
+	if len(follows) != 2 || follows[0].FeedName != testFeed.Name || follows[1].FeedName != "New Blog" {
+		t.Errorf("got %+v, want %s and New Blog", follows, testFeed.Name)
+	}
+
+	path := apiPrefix + "/follows/" + testFeed.ID.String()
+	if code := request(t, srv, "DELETE", path, testWriteToken, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("got status %d, want 204", code)
+	}
+	request(t, srv, "GET", apiPrefix+"/follows", testReadToken, nil, &follows)
+	if len(follows) != 1 || follows[0].FeedName != "New Blog" {
+		t.Errorf("after unfollowing got %+v, want New Blog", follows)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		body any
+		want int
+	}{
+		{"unknown feed", "/follows", apiNewFollow{URL: "https://example.net/feed"}, http.StatusNotFound},
+		{"feed without url", "/feeds", apiNewFeed{Name: "No URL"}, http.StatusBadRequest},
+		{"not json", "/follows", "{", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := request(t, srv, "POST", apiPrefix+tt.path, testWriteToken, tt.body, nil)
+			if code != tt.want {
+				t.Errorf("got status %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIOpenAPI(t *testing.T) {
+	srv, _ := newTestServer(t, nil)
+
+	// The document is public, so clients can be generated without a
+	// token.
+	var doc struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	if code := request(t, srv, "GET", apiPrefix+"/openapi.json", "", nil, &doc); code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", code)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("got openapi %q, want 3.x", doc.OpenAPI)
+	}
+
+	a := &apiServer{}
+	for _, rt := range a.apiRoutes() {
+		if _, ok := doc.Paths[rt.path][strings.ToLower(rt.method)]; !ok {
+			t.Errorf("route %s %s is missing from the document", rt.method, rt.path)
+		}
+	}
+	if _, ok := doc.Paths["/posts"]["get"].(map[string]any)["parameters"]; !ok {
+		t.Errorf("GET /posts has no parameters")
+	}
+}
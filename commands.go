@@ -0,0 +1,356 @@
+package gogator
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Exit codes returned by the CLI, grouped by the class of error.
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitUsage    = 2
+	exitNotFound = 3
+	exitAuth     = 4
+)
+
+var (
+	// errNotFound is wrapped by errors about missing users, feeds, etc.
+	errNotFound = errors.New("not found")
+	// errUnauthorized is wrapped by errors about missing credentials.
+	errUnauthorized = errors.New("unauthorized")
+)
+
+// usageError is returned when a command is invoked with invalid
+// arguments or flags.
+type usageError struct {
+	cmd string
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(cmd, format string, a ...any) error {
+	return &usageError{cmd: cmd, msg: fmt.Sprintf(format, a...)}
+}
+
+// exitCode maps an error returned by a command to the process exit code.
+func exitCode(err error) int {
+	var ue *usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &ue):
+		return exitUsage
+	case errors.Is(err, errNotFound), errors.Is(err, sql.ErrNoRows):
+		return exitNotFound
+	case errors.Is(err, errUnauthorized):
+		return exitAuth
+	default:
+		return exitFailure
+	}
+}
+
+type command struct {
+	name  string
+	args  []string
+	flags *flag.FlagSet
+}
+
+func (c command) flagValue(name string) any {
+	f := c.flags.Lookup(name)
+	if f == nil {
+		panic(fmt.Sprintf("command %s has no flag %q", c.name, name))
+	}
+	return f.Value.(flag.Getter).Get()
+}
+
+func (c command) flagString(name string) string {
+	return c.flagValue(name).(string)
+}
+
+func (c command) flagInt(name string) int {
+	return c.flagValue(name).(int)
+}
+
+func (c command) flagBool(name string) bool {
+	return c.flagValue(name).(bool)
+}
+
+func (c command) flagDuration(name string) time.Duration {
+	return c.flagValue(name).(time.Duration)
+}
+
+func (c command) flagStrings(name string) []string {
+	return c.flagValue(name).([]string)
+}
+
+// stringsFlag is a flag that may be repeated, collecting every value.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+func (f *stringsFlag) Get() any {
+	return []string(*f)
+}
+
+// flagSet reports whether the flag was given on the command line.
+func (c command) flagSet(name string) bool {
+	set := false
+	c.flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// commandInfo describes how a command is invoked and documented.
+type commandInfo struct {
+	// usage is the synopsis of the positional arguments.
+	usage string
+	short string
+	long  string
+	// minArgs and maxArgs bound the number of positional arguments,
+	// a negative maxArgs means there is no upper bound.
+	minArgs int
+	maxArgs int
+	aliases []string
+	// flags defines the command's flags on its own flag set.
+	flags func(fs *flag.FlagSet)
+	// complete and flagValues provide shell completion candidates for
+	// the positional arguments and for flag values.
+	complete   completer
+	flagValues map[string]completer
+	// offline commands don't need the config file or the database.
+	offline bool
+	hidden  bool
+}
+
+type registeredCmd struct {
+	name string
+	info commandInfo
+	f    handler
+}
+
+type commands struct {
+	registeredCmds map[string]*registeredCmd
+	aliases        map[string]string
+}
+
+func newCommands() *commands {
+	return &commands{
+		registeredCmds: make(map[string]*registeredCmd),
+		aliases:        make(map[string]string),
+	}
+}
+
+func (c *commands) register(name string, f handler, info commandInfo) {
+	c.registeredCmds[name] = &registeredCmd{name: name, info: info, f: f}
+	for _, a := range info.aliases {
+		c.aliases[a] = name
+	}
+}
+
+func (c *commands) lookup(name string) (*registeredCmd, bool) {
+	if canonical, ok := c.aliases[name]; ok {
+		name = canonical
+	}
+	rc, ok := c.registeredCmds[name]
+	return rc, ok
+}
+
+// sorted returns the visible commands ordered by name.
+func (c *commands) sorted() []*registeredCmd {
+	var cmds []*registeredCmd
+	for _, rc := range c.registeredCmds {
+		if !rc.info.hidden {
+			cmds = append(cmds, rc)
+		}
+	}
+	slices.SortFunc(cmds, func(a, b *registeredCmd) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return cmds
+}
+
+func (c *commands) run(s *state, cmd command) error {
+	rc, ok := c.lookup(cmd.name)
+	if !ok {
+		return usageErrorf("", "unknown command %q", cmd.name)
+	}
+
+	fs := rc.flagSet()
+	help := fs.Bool("help", false, "show help for this command")
+	fs.BoolVar(help, "h", false, "show help for this command")
+	s.opts.bind(fs)
+
+	args, err := parseFlags(fs, cmd.args)
+	if err != nil {
+		return usageErrorf(rc.name, "%v", err)
+	}
+	global := false
+	fs.Visit(func(f *flag.Flag) { global = global || isGlobalFlag(f.Name) })
+	if global {
+		if s.out, err = s.opts.setup(); err != nil {
+			return usageErrorf(rc.name, "%v", err)
+		}
+	}
+	if *help {
+		rc.printHelp(s.out.out)
+		return nil
+	}
+
+	if len(args) < rc.info.minArgs ||
+		(rc.info.maxArgs >= 0 && len(args) > rc.info.maxArgs) {
+		return usageErrorf(rc.name, "%s", rc.argsError(len(args)))
+	}
+
+	if !rc.info.offline {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+	return rc.f(s, command{name: rc.name, args: args, flags: fs})
+}
+
+func (rc *registeredCmd) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(rc.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if rc.info.flags != nil {
+		rc.info.flags(fs)
+	}
+	return fs
+}
+
+func (rc *registeredCmd) argsError(n int) string {
+	switch {
+	case rc.info.minArgs == rc.info.maxArgs && rc.info.maxArgs == 0:
+		return "this command takes no arguments"
+	case rc.info.minArgs == rc.info.maxArgs:
+		return fmt.Sprintf("expected %d argument(s), got %d", rc.info.minArgs, n)
+	case n < rc.info.minArgs:
+		return fmt.Sprintf("expected at least %d argument(s), got %d",
+			rc.info.minArgs, n)
+	default:
+		return fmt.Sprintf("expected at most %d argument(s), got %d",
+			rc.info.maxArgs, n)
+	}
+}
+
+// parseFlags parses fs from args, allowing flags to be mixed with
+// positional arguments. Everything after "--" is positional.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	if i := slices.Index(args, "--"); i >= 0 {
+		args, rest = args[:i], args[i+1:]
+	}
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return append(positional, rest...), nil
+}
+
+func (rc *registeredCmd) synopsis() string {
+	parts := []string{"gogator", rc.name}
+	if rc.info.flags != nil {
+		parts = append(parts, "[flags]")
+	}
+	if rc.info.usage != "" {
+		parts = append(parts, rc.info.usage)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (rc *registeredCmd) printHelp(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s\n\n", rc.synopsis())
+
+	desc := rc.info.long
+	if desc == "" {
+		desc = rc.info.short
+	}
+	fmt.Fprintf(w, "%s\n", strings.TrimSpace(desc))
+
+	if len(rc.info.aliases) > 0 {
+		fmt.Fprintf(w, "\nAliases: %s\n", strings.Join(rc.info.aliases, ", "))
+	}
+
+	fs := rc.flagSet()
+	if rc.info.flags != nil {
+		fmt.Fprintln(w, "\nFlags:")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+	}
+	fmt.Fprintln(w)
+	printGlobalFlags(w)
+}
+
+func (c *commands) printHelp(w io.Writer) {
+	fmt.Fprintln(w, "gogator is a simple RSS feed aggregator.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage: gogator [global flags] <command> [flags] [args...]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, rc := range c.sorted() {
+		fmt.Fprintf(tw, "  %s\t%s\n", rc.name, rc.info.short)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	printGlobalFlags(w)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "gogator help <command>" for more information about a command.`)
+}
+
+func printGlobalFlags(w io.Writer) {
+	fmt.Fprintln(w, "Global flags:")
+	fmt.Fprintf(w, "  -o, --output format\n    \toutput format: %s (default %q)\n",
+		strings.Join(outputFormats, ", "), formatTable)
+	fmt.Fprintln(w, "  --fields list\n    \tcomma separated list of columns to print")
+	fmt.Fprintln(w, "  --log-level level\n    \tlevel of the logs written to stderr: debug, info, warn or error (default \"info\")")
+	fmt.Fprintf(w, "  --log-format format\n    \tformat of the logs: %s (default %q)\n",
+		strings.Join(logFormats, ", "), logFormatText)
+}
+
+// handlerHelp prints the list of commands or the help of a command.
+func (c *commands) handlerHelp(s *state, cmd command) error {
+	if len(cmd.args) == 0 {
+		c.printHelp(s.out.out)
+		return nil
+	}
+
+	rc, ok := c.lookup(cmd.args[0])
+	if !ok {
+		return usageErrorf(cmd.name, "unknown command %q", cmd.args[0])
+	}
+	rc.printHelp(s.out.out)
+	return nil
+}
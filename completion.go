@@ -0,0 +1,316 @@
+package gogator
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// completeCmd is the hidden command the completion scripts call with
+// the words typed so far. The last word is the one being completed.
+const completeCmd = "__complete"
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// completer returns the candidates for a positional argument or a flag
+// value. Completers that need the database fail silently, a broken
+// config shouldn't spam the user's terminal while they press tab.
+type completer func(s *state) []string
+
+func completeUsers(s *state) []string {
+	if s.connect() != nil {
+		return nil
+	}
+	users, err := s.db.GetAllUsers(context.Background())
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(users))
+	for _, u := range users {
+		names = append(names, u.Name)
+	}
+	return names
+}
+
+func completeFeedURLs(s *state) []string {
+	if s.connect() != nil {
+		return nil
+	}
+	feeds, err := s.db.GetFeeds(context.Background())
+	if err != nil {
+		return nil
+	}
+
+	urls := make([]string, 0, len(feeds))
+	for _, f := range feeds {
+		urls = append(urls, f.Url)
+	}
+	return urls
+}
+
+// completeFeeds completes both feed URLs and names, for flags that
+// accept either.
+func completeFeeds(s *state) []string {
+	if s.connect() != nil {
+		return nil
+	}
+	feeds, err := s.db.GetFeeds(context.Background())
+	if err != nil {
+		return nil
+	}
+
+	refs := make([]string, 0, 2*len(feeds))
+	for _, f := range feeds {
+		refs = append(refs, f.Url, f.Name)
+	}
+	slices.Sort(refs)
+	return slices.Compact(refs)
+}
+
+func completeFollowedFeeds(s *state) []string {
+	if s.connect() != nil || s.cfg.UserName == "" {
+		return nil
+	}
+	ctx := context.Background()
+	user, err := s.db.GetUser(ctx, s.cfg.UserName)
+	if err != nil {
+		return nil
+	}
+	follows, err := s.db.GetFeedFollowsForUser(ctx, user.ID)
+	if err != nil {
+		return nil
+	}
+
+	urls := make([]string, 0, len(follows))
+	for _, ff := range follows {
+		urls = append(urls, ff.FeedUrl)
+	}
+	return urls
+}
+
+func completeValues(values ...string) completer {
+	return func(*state) []string {
+		return values
+	}
+}
+
+func (c *commands) completeCommands(*state) []string {
+	var names []string
+	for _, rc := range c.sorted() {
+		names = append(names, rc.name)
+		names = append(names, rc.info.aliases...)
+	}
+	return names
+}
+
+// complete returns the candidates for the last of words.
+func (c *commands) complete(s *state, words []string) []string {
+	if len(words) == 0 {
+		return nil
+	}
+	cur := words[len(words)-1]
+
+	var (
+		rc         *registeredCmd
+		fs         *flag.FlagSet
+		positional int
+		valueFor   string
+	)
+	for _, w := range words[:len(words)-1] {
+		if valueFor != "" {
+			valueFor = ""
+			continue
+		}
+		if name, ok := flagName(w); ok {
+			if !strings.Contains(w, "=") && takesValue(fs, name) {
+				valueFor = name
+			}
+			continue
+		}
+		if rc == nil {
+			found, ok := c.lookup(w)
+			if !ok {
+				return nil
+			}
+			rc, fs = found, found.flagSet()
+			continue
+		}
+		positional++
+	}
+
+	if valueFor != "" {
+		return filterPrefix(c.flagValues(s, rc, valueFor), cur)
+	}
+
+	if strings.HasPrefix(cur, "-") {
+		if prefix, _, found := strings.Cut(cur, "="); found {
+			var candidates []string
+			name := strings.TrimLeft(prefix, "-")
+			for _, v := range c.flagValues(s, rc, name) {
+				candidates = append(candidates, prefix+"="+v)
+			}
+			return filterPrefix(candidates, cur)
+		}
+		return filterPrefix(flagNames(fs), cur)
+	}
+
+	if rc == nil {
+		return filterPrefix(c.completeCommands(s), cur)
+	}
+	if rc.info.complete == nil ||
+		(rc.info.maxArgs >= 0 && positional >= rc.info.maxArgs) {
+		return nil
+	}
+	return filterPrefix(rc.info.complete(s), cur)
+}
+
+// flagName returns the name of the flag in w, if w is a flag.
+func flagName(w string) (string, bool) {
+	if len(w) < 2 || w[0] != '-' || w == "--" {
+		return "", false
+	}
+	name := strings.TrimLeft(w, "-")
+	return name, name != ""
+}
+
+func takesValue(fs *flag.FlagSet, name string) bool {
+	name, _, _ = strings.Cut(name, "=")
+	if isGlobalFlag(name) {
+		return true
+	}
+	if fs == nil {
+		return false
+	}
+	f := fs.Lookup(name)
+	if f == nil {
+		return false
+	}
+	if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && bf.IsBoolFlag() {
+		return false
+	}
+	return true
+}
+
+func flagNames(fs *flag.FlagSet) []string {
+	names := []string{"--output", "--fields", "--log-level", "--log-format", "--help"}
+	if fs != nil {
+		fs.VisitAll(func(f *flag.Flag) {
+			names = append(names, "--"+f.Name)
+		})
+	}
+	return names
+}
+
+func (c *commands) flagValues(s *state, rc *registeredCmd, name string) []string {
+	if name == "o" || name == "output" {
+		return outputFormats
+	}
+	switch name {
+	case "log-level":
+		return logLevels
+	case "log-format":
+		return logFormats
+	}
+	if rc == nil || rc.info.flagValues == nil {
+		return nil
+	}
+	if f, ok := rc.info.flagValues[name]; ok {
+		return f(s)
+	}
+	return nil
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	var out []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// runComplete answers a completion request from one of the scripts.
+func (c *commands) runComplete(w io.Writer, words []string) int {
+	s := &state{}
+	defer s.close()
+
+	for _, candidate := range c.complete(s, words) {
+		fmt.Fprintln(w, candidate)
+	}
+	return exitOK
+}
+
+func handlerCompletion(s *state, cmd command) error {
+	switch cmd.args[0] {
+	case "bash":
+		fmt.Fprint(s.out.out, bashCompletion)
+	case "zsh":
+		fmt.Fprint(s.out.out, zshCompletion)
+	case "fish":
+		fmt.Fprint(s.out.out, fishCompletion)
+	default:
+		return usageErrorf(cmd.name, "unsupported shell %q, expected one of: %s",
+			cmd.args[0], strings.Join(completionShells, ", "))
+	}
+	return nil
+}
+
+const bashCompletion = `# bash completion for gogator
+# Load it with: source <(gogator completion bash)
+
+_gogator() {
+    local cur words cword
+    if declare -F _init_completion >/dev/null 2>&1; then
+        _init_completion -n =: || return
+    else
+        words=("${COMP_WORDS[@]}")
+        cword=$COMP_CWORD
+        cur=${COMP_WORDS[COMP_CWORD]}
+    fi
+
+    local IFS=$'\n'
+    COMPREPLY=($(gogator __complete "${words[@]:1:cword}" 2>/dev/null))
+
+    if declare -F __ltrim_colon_completions >/dev/null 2>&1; then
+        __ltrim_colon_completions "$cur"
+    fi
+}
+
+complete -o default -F _gogator gogator
+`
+
+const zshCompletion = `#compdef gogator
+# zsh completion for gogator
+# Load it with: source <(gogator completion zsh)
+# or save it as _gogator in a directory of your $fpath.
+
+_gogator() {
+    local -a candidates
+    candidates=("${(@f)$(gogator __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    candidates=(${candidates:#})
+    compadd -- "${candidates[@]}"
+}
+
+if [ "$funcstack[1]" = "_gogator" ]; then
+    _gogator "$@"
+else
+    compdef _gogator gogator
+fi
+`
+
+const fishCompletion = `# fish completion for gogator
+# Load it with: gogator completion fish | source
+# or save it as ~/.config/fish/completions/gogator.fish
+
+function __gogator_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    gogator __complete $tokens[2..-1] 2>/dev/null
+end
+
+complete -c gogator -f -a '(__gogator_complete)'
+`
@@ -0,0 +1,330 @@
+package gogator
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prchop/gogator/internal/database"
+	"golang.org/x/net/http/httpguts"
+)
+
+// credentialsKeyEnv holds the key encrypting the credentials of the
+// feeds. It takes precedence over the credentials_key setting.
+const credentialsKeyEnv = "GOGATOR_CREDENTIALS_KEY"
+
+// feedCredentials authenticate the requests of a feed. They are only
+// stored encrypted and print as the kinds they hold, so they can't
+// leak into listings or logs.
+type feedCredentials struct {
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	Bearer   string            `json:"bearer,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Cookies  map[string]string `json:"cookies,omitempty"`
+}
+
+// kinds returns what c holds: basic, bearer, headers and cookies.
+func (c *feedCredentials) kinds() []string {
+	var kinds []string
+	if c.Username != "" {
+		kinds = append(kinds, "basic")
+	}
+	if c.Bearer != "" {
+		kinds = append(kinds, "bearer")
+	}
+	if len(c.Headers) > 0 {
+		kinds = append(kinds, "headers")
+	}
+	if len(c.Cookies) > 0 {
+		kinds = append(kinds, "cookies")
+	}
+	return kinds
+}
+
+func (c *feedCredentials) String() string {
+	return "credentials(" + strings.Join(c.kinds(), ",") + ")"
+}
+
+func (c *feedCredentials) LogValue() slog.Value {
+	return slog.StringValue(c.String())
+}
+
+// apply authenticates req.
+func (c *feedCredentials) apply(req *http.Request) {
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	if c.Bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Bearer)
+	}
+	for name, value := range c.Headers {
+		req.Header.Set(name, value)
+	}
+	for name, value := range c.Cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+}
+
+type credentialHeadersKey struct{}
+
+// withCredentials records the headers set by c in ctx, so that
+// checkRedirect doesn't send them to another host.
+func withCredentials(ctx context.Context, c *feedCredentials) context.Context {
+	if c == nil || len(c.Headers) == 0 {
+		return ctx
+	}
+	names := make([]string, 0, len(c.Headers))
+	for name := range c.Headers {
+		names = append(names, name)
+	}
+	return context.WithValue(ctx, credentialHeadersKey{}, names)
+}
+
+// checkRedirect follows up to 10 redirects like the default policy. The
+// client already drops the Authorization and Cookie headers when leaving
+// the host, and this drops the custom headers of the credentials too.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Host != via[0].URL.Host {
+		names, _ := req.Context().Value(credentialHeadersKey{}).([]string)
+		for _, name := range names {
+			req.Header.Del(name)
+		}
+	}
+	return nil
+}
+
+// newCredentialsCipher returns the cipher of the credentials, keyed with
+// $GOGATOR_CREDENTIALS_KEY or else with key, the credentials_key setting.
+func newCredentialsCipher(key string) (cipher.AEAD, error) {
+	encoded := os.Getenv(credentialsKeyEnv)
+	if encoded == "" {
+		encoded = key
+	}
+	if encoded == "" {
+		return nil, fmt.Errorf("no credentials key, set %s or credentials_key "+
+			"in the config file to 32 random bytes in base64, "+
+			"such as the output of \"openssl rand -base64 32\"", credentialsKeyEnv)
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("the credentials key must be 32 bytes in base64")
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealCredentials encrypts c for the feed, which authenticates the
+// ciphertext so it can't be moved to another feed.
+func sealCredentials(aead cipher.AEAD, feedID uuid.UUID, c *feedCredentials) ([]byte, error) {
+	plain, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, feedID[:]), nil
+}
+
+func openCredentials(aead cipher.AEAD, feedID uuid.UUID, secret []byte) (*feedCredentials, error) {
+	if len(secret) < aead.NonceSize() {
+		return nil, errors.New("credentials too short")
+	}
+	nonce, sealed := secret[:aead.NonceSize()], secret[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, sealed, feedID[:])
+	if err != nil {
+		return nil, err
+	}
+	var c feedCredentials
+	if err := json.Unmarshal(plain, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// loadCredentials returns the credentials of a feed, nil when it has
+// none.
+func loadCredentials(ctx context.Context, s *state, feedID uuid.UUID) (*feedCredentials, error) {
+	row, err := s.db.GetFeedCredentials(ctx, feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get feed credentials: %w", err)
+	}
+
+	aead, err := s.fetcher.credentialsCipher()
+	if err != nil {
+		return nil, err
+	}
+	c, err := openCredentials(aead, feedID, row.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt feed credentials, "+
+			"was the credentials key changed? %w", err)
+	}
+	return c, nil
+}
+
+func handlerFeedAuth(s *state, cmd command, user database.User) error {
+	action, args := cmd.args[0], cmd.args[1:]
+	if action != "set" && (cmd.flagSet("basic") || cmd.flagSet("bearer") ||
+		cmd.flagSet("header") || cmd.flagSet("cookie")) {
+		return usageErrorf(cmd.name,
+			"--basic, --bearer, --header and --cookie only apply to set")
+	}
+
+	switch {
+	case action == "set" && len(args) == 1:
+		return setFeedAuth(s, cmd, user, args[0])
+	case action == "clear" && len(args) == 1:
+		return clearFeedAuth(s, user, args[0])
+	case action == "list" && len(args) == 0:
+		return listFeedAuth(s, user)
+	case slices.Contains(feedAuthActions, action):
+		return usageErrorf(cmd.name, "wrong number of arguments for %s", action)
+	default:
+		return usageErrorf(cmd.name, "unknown action %q, expected one of: %s",
+			action, strings.Join(feedAuthActions, ", "))
+	}
+}
+
+var feedAuthActions = []string{"set", "clear", "list"}
+
+// setFeedAuth replaces the credentials of a feed. The secrets are read
+// like passwords rather than from flags, which would leave them in the
+// shell history.
+func setFeedAuth(s *state, cmd command, user database.User, ref string) error {
+	ctx := context.Background()
+	feed, err := resolveFeed(ctx, s.db, ref)
+	if err != nil {
+		return err
+	}
+	if err := checkFeedOwner(user, feed, "change its credentials"); err != nil {
+		return err
+	}
+	aead, err := s.fetcher.credentialsCipher()
+	if err != nil {
+		return err
+	}
+
+	c := &feedCredentials{}
+	read := func(prompt string) (string, error) {
+		v, err := readPassword(prompt)
+		if err == nil && v == "" {
+			err = usageErrorf(cmd.name, "empty value for %s", strings.TrimSuffix(prompt, ": "))
+		}
+		return v, err
+	}
+	if c.Username = cmd.flagString("basic"); c.Username != "" {
+		if c.Password, err = read("Password of " + c.Username + ": "); err != nil {
+			return err
+		}
+	}
+	if cmd.flagBool("bearer") {
+		if c.Bearer, err = read("Bearer token: "); err != nil {
+			return err
+		}
+	}
+	for _, name := range cmd.flagStrings("header") {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return usageErrorf(cmd.name, "invalid header name %q", name)
+		}
+		if c.Headers == nil {
+			c.Headers = make(map[string]string)
+		}
+		if c.Headers[name], err = read("Header " + name + ": "); err != nil {
+			return err
+		}
+	}
+	for _, name := range cmd.flagStrings("cookie") {
+		if c.Cookies == nil {
+			c.Cookies = make(map[string]string)
+		}
+		if c.Cookies[name], err = read("Cookie " + name + ": "); err != nil {
+			return err
+		}
+		cookie := &http.Cookie{Name: name, Value: c.Cookies[name]}
+		if err := cookie.Valid(); err != nil {
+			return usageErrorf(cmd.name, "invalid cookie %q: %v", name, err)
+		}
+	}
+	if len(c.kinds()) == 0 {
+		return usageErrorf(cmd.name,
+			"set needs at least one of --basic, --bearer, --header or --cookie")
+	}
+
+	secret, err := sealCredentials(aead, feed.ID, c)
+	if err != nil {
+		return fmt.Errorf("couldn't encrypt credentials: %w", err)
+	}
+	err = s.db.SetFeedCredentials(ctx, database.SetFeedCredentialsParams{
+		FeedID:    feed.ID,
+		CreatedAt: time.Now().UTC(),
+		Kinds:     strings.Join(c.kinds(), ","),
+		Secret:    secret,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't save feed credentials: %w", err)
+	}
+	s.out.noticef("Credentials of %q saved.\n", feed.Name)
+	return nil
+}
+
+func clearFeedAuth(s *state, user database.User, ref string) error {
+	ctx := context.Background()
+	feed, err := resolveFeed(ctx, s.db, ref)
+	if err != nil {
+		return err
+	}
+	if err := checkFeedOwner(user, feed, "change its credentials"); err != nil {
+		return err
+	}
+
+	n, err := s.db.DeleteFeedCredentials(ctx, feed.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't delete feed credentials: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("feed %q has no credentials: %w", feed.Name, errNotFound)
+	}
+	s.out.noticef("Credentials of %q deleted.\n", feed.Name)
+	return nil
+}
+
+// listFeedAuth lists the feeds with credentials that the user can
+// change, with the kinds of credentials but never their values.
+func listFeedAuth(s *state, user database.User) error {
+	feeds, err := s.db.GetFeedsWithCredentials(context.Background(),
+		database.GetFeedsWithCredentialsParams{All: user.IsAdmin, UserID: user.ID})
+	if err != nil {
+		return fmt.Errorf("couldn't get feeds with credentials: %w", err)
+	}
+
+	l := newListing("name", "url", "auth", "updated_at")
+	for _, f := range feeds {
+		l.add(f.Feed.Name, f.Feed.Url, f.Kinds, f.CredentialsUpdatedAt)
+	}
+	return s.out.render(l)
+}
@@ -0,0 +1,165 @@
+package gogator
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+var testCredentialsKey = base64.StdEncoding.EncodeToString(
+	[]byte("0123456789abcdef0123456789abcdef"))
+
+func TestNewCredentialsCipher(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		key     string
+		wantErr string
+	}{
+		{name: "setting", key: testCredentialsKey},
+		{name: "environment", env: testCredentialsKey},
+		{name: "environment over setting", env: testCredentialsKey, key: "invalid"},
+		{name: "no key", wantErr: "no credentials key"},
+		{name: "not base64", key: "not base64!", wantErr: "32 bytes"},
+		{name: "too short", key: base64.StdEncoding.EncodeToString([]byte("short")),
+			wantErr: "32 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(credentialsKeyEnv, tt.env)
+			aead, err := newCredentialsCipher(tt.key)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || aead == nil {
+				t.Fatalf("got %v, %v, want a cipher", aead, err)
+			}
+		})
+	}
+}
+
+func TestSealCredentials(t *testing.T) {
+	t.Setenv(credentialsKeyEnv, "")
+	aead, err := newCredentialsCipher(testCredentialsKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newCredentialsCipher(base64.StdEncoding.EncodeToString(
+		[]byte("fedcba9876543210fedcba9876543210")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds := &feedCredentials{
+		Username: "alice",
+		Password: "secret",
+		Bearer:   "token",
+		Headers:  map[string]string{"X-Api-Key": "key"},
+		Cookies:  map[string]string{"session": "cookie"},
+	}
+	feedID, otherFeedID := uuid.New(), uuid.New()
+	secret, err := sealCredentials(aead, feedID, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := sealCredentials(aead, feedID, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) == string(again) {
+		t.Error("sealing twice gave the same ciphertext, want a new nonce each time")
+	}
+	if strings.Contains(string(secret), "secret") {
+		t.Error("the ciphertext contains the password")
+	}
+
+	tampered := append([]byte(nil), secret...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name    string
+		open    func() (*feedCredentials, error)
+		wantErr bool
+	}{
+		{name: "same feed", open: func() (*feedCredentials, error) {
+			return openCredentials(aead, feedID, secret)
+		}},
+		// The feed ID is authenticated, so credentials copied to another
+		// feed's row can't be used there.
+		{name: "another feed", wantErr: true, open: func() (*feedCredentials, error) {
+			return openCredentials(aead, otherFeedID, secret)
+		}},
+		{name: "another key", wantErr: true, open: func() (*feedCredentials, error) {
+			return openCredentials(other, feedID, secret)
+		}},
+		{name: "tampered", wantErr: true, open: func() (*feedCredentials, error) {
+			return openCredentials(aead, feedID, tampered)
+		}},
+		{name: "truncated", wantErr: true, open: func() (*feedCredentials, error) {
+			return openCredentials(aead, feedID, secret[:aead.NonceSize()-1])
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.open()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, creds) {
+				t.Errorf("got %+v, want %+v", got, creds)
+			}
+		})
+	}
+}
+
+func TestFeedCredentialsRedacted(t *testing.T) {
+	creds := &feedCredentials{Username: "alice", Password: "secret",
+		Headers: map[string]string{"X-Api-Key": "key"}}
+	for _, s := range []string{
+		creds.String(),
+		fmt.Sprint(creds),
+		fmt.Sprintf("%v", creds),
+		creds.LogValue().String(),
+	} {
+		if s != "credentials(basic,headers)" {
+			t.Errorf("got %q, want credentials(basic,headers)", s)
+		}
+	}
+}
+
+func TestFeedCredentialsApply(t *testing.T) {
+	creds := &feedCredentials{
+		Bearer:  "token",
+		Headers: map[string]string{"X-Api-Key": "key"},
+		Cookies: map[string]string{"session": "cookie"},
+	}
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/feed", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds.apply(req)
+
+	for name, want := range map[string]string{
+		"Authorization": "Bearer token",
+		"X-Api-Key":     "key",
+		"Cookie":        "session=cookie",
+	} {
+		if got := req.Header.Get(name); got != want {
+			t.Errorf("got %s %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package gogator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prchop/gogator/internal/database"
+)
+
+// fetchTimeout bounds a single fetch of a feed.
+const fetchTimeout = 30 * time.Second
+
+// handlerFetch fetches feeds once and prints a summary per feed. It
+// fails when any feed couldn't be fetched, so it can run from cron.
+func handlerFetch(s *state, cmd command) error {
+	feeds, err := feedsToFetch(s, cmd)
+	if err != nil {
+		return err
+	}
+	if len(feeds) == 0 {
+		s.out.noticef("No feeds to fetch.\n")
+		return nil
+	}
+
+	l := newListing("name", "url", "status", "posts", "found", "duration", "error")
+	failed := 0
+	for _, feed := range feeds {
+		logger := fetchLogger(feed)
+		ctx, cancel := context.WithTimeout(
+			withLogger(context.Background(), logger), fetchTimeout)
+		logger.Debug("fetching feed", "feed_name", feed.Name)
+		start := time.Now()
+		found, created, err := collectFeed(ctx, s, feed)
+		cancel()
+		if err != nil {
+			logger.Debug("couldn't fetch feed", "err", err)
+		}
+
+		took := time.Since(start).Round(time.Millisecond).String()
+		if err != nil {
+			failed++
+			l.add(feed.Name, feed.Url, "failed", nil, nil, took, err.Error())
+			continue
+		}
+		l.add(feed.Name, feed.Url, "ok", created, found, took, nil)
+	}
+	if err := s.out.render(l); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d feeds couldn't be fetched", failed, len(feeds))
+	}
+	return nil
+}
+
+// feedsToFetch returns the feeds selected by --all, --feed or --stale.
+func feedsToFetch(s *state, cmd command) ([]database.Feed, error) {
+	ctx := context.Background()
+	refs := cmd.flagStrings("feed")
+	modes := 0
+	for _, set := range []bool{cmd.flagBool("all"), len(refs) > 0, cmd.flagSet("stale")} {
+		if set {
+			modes++
+		}
+	}
+	if modes != 1 {
+		return nil, usageErrorf(cmd.name, "expected exactly one of --all, --feed or --stale")
+	}
+
+	switch {
+	case cmd.flagBool("all"):
+		feeds, err := s.db.GetUnorphanedFeeds(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get feeds: %w", err)
+		}
+		return feeds, nil
+	case len(refs) > 0:
+		var feeds []database.Feed
+		for _, ref := range refs {
+			feed, err := resolveFeed(ctx, s.db, ref)
+			if err != nil {
+				return nil, err
+			}
+			feeds = append(feeds, feed)
+		}
+		return feeds, nil
+	default:
+		age, err := parseAge(cmd.flagString("stale"))
+		if err != nil || age == 0 {
+			return nil, usageErrorf(cmd.name,
+				"couldn't parse --stale %q, expected e.g. 30m or 1d", cmd.flagString("stale"))
+		}
+		feeds, err := s.db.GetStaleFeeds(ctx, time.Now().UTC().Add(-age))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get stale feeds: %w", err)
+		}
+		return feeds, nil
+	}
+}
@@ -0,0 +1,376 @@
+package gogator
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prchop/gogator/internal/database"
+)
+
+// The Fever API is a single endpoint whose query string selects what
+// to return. Every response carries the API version and whether the
+// api_key was accepted.
+const (
+	feverPrefix  = "/fever/"
+	feverVersion = 3
+	// feverMaxItems is the page size fixed by the Fever API.
+	feverMaxItems = 50
+	// feverGroupID is the only group: gogator has no folders, so every
+	// followed feed is in it.
+	feverGroupID = 1
+)
+
+type feverServer struct {
+	s *state
+}
+
+// newFeverHandler returns the handler of the Fever API, ready to be
+// mounted on feverPrefix.
+func newFeverHandler(s *state) http.Handler {
+	return &feverServer{s: s}
+}
+
+// feverAPIKey returns the key Fever clients derive from the username
+// and password.
+func feverAPIKey(name, password string) string {
+	sum := md5.Sum([]byte(name + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+func (f *feverServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]any{"api_version": feverVersion, "auth": 0}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := f.s.db.GetUserByFeverAPIKey(ctx,
+		strings.ToLower(r.Form.Get("api_key")))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	if err == nil {
+		resp["auth"] = 1
+		err = f.serve(ctx, r, user, resp)
+	}
+
+	var ae *apiError
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, resp)
+	case errors.As(err, &ae):
+		resp["error"] = ae.msg
+		writeJSON(w, ae.status, resp)
+	default:
+		slog.Error("fever request failed", "err", err)
+		resp["error"] = "internal server error"
+		writeJSON(w, http.StatusInternalServerError, resp)
+	}
+}
+
+// serve adds the sections asked for by the request to resp. Marking
+// comes first so that the sections returned reflect it.
+func (f *feverServer) serve(ctx context.Context, r *http.Request,
+	user database.User, resp map[string]any,
+) error {
+	if r.Form.Has("mark") {
+		if err := f.mark(ctx, r, user); err != nil {
+			return err
+		}
+	}
+
+	feeds, err := f.s.db.GetFollowedFeeds(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	var refreshed time.Time
+	for _, feed := range feeds {
+		if feed.LastFetchedAt.Valid && feed.LastFetchedAt.Time.After(refreshed) {
+			refreshed = feed.LastFetchedAt.Time
+		}
+	}
+	resp["last_refreshed_on_time"] = unixOrZero(refreshed)
+
+	if r.Form.Has("groups") {
+		resp["groups"] = []map[string]any{{"id": feverGroupID, "title": "All"}}
+		resp["feeds_groups"] = feverFeedsGroups(feeds)
+	}
+
+	if r.Form.Has("feeds") {
+		out := make([]map[string]any, 0, len(feeds))
+		for _, feed := range feeds {
+			out = append(out, map[string]any{
+				"id":                   feed.Seq,
+				"favicon_id":           0,
+				"title":                feed.Name,
+				"url":                  feed.Url,
+				"site_url":             feed.Url,
+				"is_spark":             0,
+				"last_updated_on_time": unixOrZero(feed.LastFetchedAt.Time),
+			})
+		}
+		resp["feeds"] = out
+		resp["feeds_groups"] = feverFeedsGroups(feeds)
+	}
+
+	if r.Form.Has("favicons") {
+		resp["favicons"] = []any{}
+	}
+	if r.Form.Has("links") {
+		resp["links"] = []any{}
+	}
+
+	if r.Form.Has("items") {
+		items, err := f.items(ctx, r, user)
+		if err != nil {
+			return err
+		}
+		total, err := f.s.db.CountFollowedPosts(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		resp["items"] = items
+		resp["total_items"] = total
+	}
+
+	if r.Form.Has("unread_item_ids") {
+		seqs, err := f.s.db.GetUnreadSeqs(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		resp["unread_item_ids"] = joinIDs(seqs)
+	}
+
+	if r.Form.Has("saved_item_ids") {
+		seqs, err := f.s.db.GetStarredSeqs(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		resp["saved_item_ids"] = joinIDs(seqs)
+	}
+	return nil
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func joinIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+func feverFeedsGroups(feeds []database.Feed) []map[string]any {
+	ids := make([]int64, len(feeds))
+	for i, feed := range feeds {
+		ids[i] = feed.Seq
+	}
+	return []map[string]any{{"group_id": feverGroupID, "feed_ids": joinIDs(ids)}}
+}
+
+func formInt(r *http.Request, name string) (int64, error) {
+	v := r.Form.Get(name)
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, apiErrorf(http.StatusBadRequest, "invalid %s %q", name, v)
+	}
+	return n, nil
+}
+
+// items returns a page of items: the ones listed by with_ids, the ones
+// before max_id, or otherwise the ones after since_id.
+func (f *feverServer) items(ctx context.Context, r *http.Request,
+	user database.User,
+) ([]map[string]any, error) {
+	var (
+		rows []database.GetStreamItemsRow
+		err  error
+	)
+
+	switch {
+	case r.Form.Get("with_ids") != "":
+		var seqs []int64
+		for v := range strings.SplitSeq(r.Form.Get("with_ids"), ",") {
+			seq, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, apiErrorf(http.StatusBadRequest, "invalid with_ids %q", v)
+			}
+			seqs = append(seqs, seq)
+		}
+		if len(seqs) > feverMaxItems {
+			seqs = seqs[:feverMaxItems]
+		}
+
+		var bySeq []database.GetStreamItemsBySeqRow
+		bySeq, err = f.s.db.GetStreamItemsBySeq(ctx,
+			database.GetStreamItemsBySeqParams{UserID: user.ID, Seqs: seqs})
+		for _, row := range bySeq {
+			rows = append(rows, database.GetStreamItemsRow(row))
+		}
+	default:
+		params := database.GetStreamItemsParams{
+			UserID:      user.ID,
+			OldestFirst: true,
+			Limit:       feverMaxItems,
+		}
+		if r.Form.Get("max_id") != "" {
+			maxID, err := formInt(r, "max_id")
+			if err != nil {
+				return nil, err
+			}
+			params.OldestFirst = false
+			params.Continuation = sql.NullInt64{Int64: maxID, Valid: true}
+		} else if r.Form.Get("since_id") != "" {
+			sinceID, err := formInt(r, "since_id")
+			if err != nil {
+				return nil, err
+			}
+			params.Continuation = sql.NullInt64{Int64: sinceID, Valid: true}
+		}
+		rows, err = f.s.db.GetStreamItems(ctx, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]map[string]any, 0, len(rows))
+	for _, row := range rows {
+		p := row.Post
+		created := p.CreatedAt
+		if p.PublishedAt.Valid {
+			created = p.PublishedAt.Time
+		}
+		items = append(items, map[string]any{
+			"id":              p.Seq,
+			"feed_id":         row.FeedSeq,
+			"title":           p.Title,
+			"author":          "",
+			"html":            p.Description.String,
+			"url":             p.Url,
+			"is_saved":        boolInt(row.Starred),
+			"is_read":         boolInt(row.Read),
+			"created_on_time": created.Unix(),
+		})
+	}
+	return items, nil
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// mark handles mark=item with as=read|unread|saved|unsaved, and
+// mark=feed|group with as=read, which marks the items fetched before
+// the before timestamp.
+func (f *feverServer) mark(ctx context.Context, r *http.Request,
+	user database.User,
+) error {
+	id, err := formInt(r, "id")
+	if err != nil {
+		return err
+	}
+	as := r.Form.Get("as")
+
+	switch mark := r.Form.Get("mark"); mark {
+	case "item":
+		rows, err := f.s.db.GetStreamItemsBySeq(ctx,
+			database.GetStreamItemsBySeqParams{UserID: user.ID, Seqs: []int64{id}})
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return apiErrorf(http.StatusNotFound, "no item %d", id)
+		}
+
+		postID := rows[0].Post.ID
+		switch as {
+		case "read", "unread":
+			return setPostRead(ctx, f.s.db, user.ID, postID, as == "read")
+		case "saved", "unsaved":
+			return setPostStarred(ctx, f.s.db, user.ID, postID, as == "saved")
+		}
+		return apiErrorf(http.StatusBadRequest, "invalid as %q", as)
+	case "feed", "group":
+		if as != "read" {
+			return apiErrorf(http.StatusBadRequest, "invalid as %q", as)
+		}
+
+		params := database.MarkStreamReadParams{
+			UserID:    user.ID,
+			ReadAt:    time.Now().UTC(),
+			OlderThan: time.Now().UTC(),
+		}
+		if r.Form.Get("before") != "" {
+			before, err := formInt(r, "before")
+			if err != nil {
+				return err
+			}
+			params.OlderThan = time.Unix(before, 0).UTC()
+		}
+
+		// Group 0 is Fever's "Kindling", all feeds, just like the only
+		// group gogator has.
+		if mark == "feed" {
+			feed, err := f.s.db.GetFeedBySeq(ctx, id)
+			if errors.Is(err, sql.ErrNoRows) {
+				return apiErrorf(http.StatusNotFound, "no feed %d", id)
+			}
+			if err != nil {
+				return err
+			}
+			params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+		} else if id != 0 && id != feverGroupID {
+			return apiErrorf(http.StatusNotFound, "no group %d", id)
+		}
+
+		_, err := f.s.db.MarkStreamRead(ctx, params)
+		return err
+	default:
+		return apiErrorf(http.StatusBadRequest, "invalid mark %q", mark)
+	}
+}
+
+func handlerFeverKey(s *state, cmd command, user database.User) error {
+	password, err := readPassword("Fever password: ")
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		return usageErrorf(cmd.name, "the password can't be empty")
+	}
+
+	err = s.db.SetFeverAPIKey(context.Background(), database.SetFeverAPIKeyParams{
+		ID:          user.ID,
+		FeverApiKey: sql.NullString{String: feverAPIKey(user.Name, password), Valid: true},
+		UpdatedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't set the fever api key: %w", err)
+	}
+
+	s.out.noticef("Fever password set for %q, log in with that username and password.\n",
+		user.Name)
+	return nil
+}
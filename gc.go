@@ -0,0 +1,106 @@
+package gogator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/prchop/gogator/internal/database"
+)
+
+// Feeds no one follows are deleted feedGCGrace after they lost their
+// last follower, which leaves time to follow them again without losing
+// their posts. agg collects them every feedGCInterval.
+const (
+	feedGCGrace    = 7 * 24 * time.Hour
+	feedGCInterval = time.Hour
+)
+
+// markOrphanedFeeds starts the grace period of the feeds no one follows
+// and ends it for those followed again.
+func markOrphanedFeeds(ctx context.Context, s *state) error {
+	if _, err := s.db.MarkOrphanedFeeds(ctx, time.Now().UTC()); err != nil {
+		return fmt.Errorf("couldn't mark orphaned feeds: %w", err)
+	}
+	if _, err := s.db.ClearAdoptedFeeds(ctx); err != nil {
+		return fmt.Errorf("couldn't clear adopted feeds: %w", err)
+	}
+	return nil
+}
+
+// collectFeeds deletes the feeds no one has followed for grace, with
+// their posts, and returns how many were deleted.
+func collectFeeds(ctx context.Context, s *state, grace time.Duration) (int64, error) {
+	if err := markOrphanedFeeds(ctx, s); err != nil {
+		return 0, err
+	}
+	n, err := s.db.DeleteOrphanedFeeds(ctx, time.Now().UTC().Add(-grace))
+	if err != nil {
+		return 0, fmt.Errorf("couldn't delete orphaned feeds: %w", err)
+	}
+	return n, nil
+}
+
+// collectFeedsInBackground is run by agg.
+func collectFeedsInBackground(s *state) {
+	n, err := collectFeeds(context.Background(), s, feedGCGrace)
+	if err != nil {
+		slog.Error("couldn't collect feeds", "err", err)
+		return
+	}
+	feedsCollected.Add(float64(n))
+	if n > 0 {
+		slog.Info("deleted feeds no one follows", "feeds", n)
+	}
+}
+
+func handlerGCFeeds(s *state, cmd command, _ database.User) error {
+	ctx := context.Background()
+	grace, err := parseAge(cmd.flagString("grace"))
+	if err != nil {
+		return usageErrorf(cmd.name, "%v", err)
+	}
+
+	// A dry run doesn't start any grace period.
+	if !cmd.flagBool("dry-run") {
+		if err := markOrphanedFeeds(ctx, s); err != nil {
+			return err
+		}
+	}
+	before := time.Now().UTC().Add(-grace)
+	feeds, err := s.db.GetOrphanedFeeds(ctx, before)
+	if err != nil {
+		return fmt.Errorf("couldn't get orphaned feeds: %w", err)
+	}
+	if len(feeds) == 0 {
+		s.out.noticef("No feed has been unfollowed for %s.\n", formatAge(grace))
+		return nil
+	}
+
+	if cmd.flagBool("dry-run") {
+		s.out.noticef("Dry run, would delete %d feed(s):\n", len(feeds))
+	} else {
+		s.out.noticef("Deleting %d feed(s):\n", len(feeds))
+	}
+	l := newListing("id", "name", "url", "orphaned_at", "posts")
+	for _, f := range feeds {
+		l.add(f.ID, f.Name, f.Url, nullTime(f.OrphanedAt), f.Posts)
+	}
+	if err := s.out.render(l); err != nil {
+		return err
+	}
+	if cmd.flagBool("dry-run") {
+		return nil
+	}
+
+	if err := confirm(cmd, "Delete these feeds and their posts?"); err != nil {
+		return err
+	}
+	n, err := s.db.DeleteOrphanedFeeds(ctx, before)
+	if err != nil {
+		return fmt.Errorf("couldn't delete orphaned feeds: %w", err)
+	}
+	s.out.noticef("%d feed(s) deleted.\n", n)
+	return nil
+}
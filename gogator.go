@@ -3,81 +3,549 @@
 package gogator
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"time"
 
 	"github.com/prchop/gogator/internal/config"
 	"github.com/prchop/gogator/internal/database"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 type state struct {
-	cfg *config.Settings
-	db  *database.Queries
+	opts globalOptions
+	cfg  *config.Settings
+	db   *database.Queries
+	conn *sql.DB
+	out  *printer
+	// fetcher downloads the feeds.
+	fetcher *fetcher
+	// tracing is the tracer provider, nil when tracing is disabled.
+	tracing *sdktrace.TracerProvider
 }
 
-type command struct {
-	name string
-	args []string
-}
+// connect reads the config file and opens the database. It is called
+// lazily so that offline commands such as help work without a config.
+func (s *state) connect() error {
+	if s.db != nil {
+		return nil
+	}
+
+	cfg, err := config.Read()
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+
+	fetcher, err := newFetcher(&cfg)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("postgres", cfg.DBURL)
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %w", err)
+	}
 
-type commands struct {
-	registeredCmds map[string]handler
+	s.cfg = &cfg
+	s.conn = db
+	s.db = database.New(timedDB{db})
+	s.fetcher = fetcher
+	if err := s.applyLogConfig(); err != nil {
+		return err
+	}
+	return s.setupTracing()
 }
 
-func (c *commands) run(s *state, cmd command) error {
-	f, ok := c.registeredCmds[cmd.name]
-	if !ok {
-		return fmt.Errorf("command not found")
+// inTx runs f with queries made in a transaction, which is committed
+// if f succeeds and rolled back otherwise.
+func (s *state) inTx(ctx context.Context, f func(q *database.Queries) error) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("couldn't begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := f(database.New(timedDB{tx})); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("couldn't commit transaction: %w", err)
 	}
-	return f(s, cmd)
+	return nil
 }
 
-func (c *commands) register(name string, f handler) {
-	c.registeredCmds[name] = f
+func (s *state) close() {
+	s.stopTracing()
+	if s.conn != nil {
+		s.conn.Close()
+	}
 }
 
 func Run() {
-	cfg, err := config.Read()
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	cmds := newCommands()
+	registerCommands(cmds)
+
+	// Completion requests need the raw words, global flags included.
+	if len(args) > 0 && args[0] == completeCmd {
+		return cmds.runComplete(os.Stdout, args[1:])
+	}
+
+	opts, args, err := parseGlobalFlags(args)
 	if err != nil {
-		log.Fatalf("error reading config: %v\n", err)
+		slog.Error(err.Error())
+		return exitUsage
+	}
+	out, err := opts.setup()
+	if err != nil {
+		slog.Error(err.Error())
+		return exitUsage
 	}
 
-	db, err := sql.Open("postgres", cfg.DBURL)
+	if len(args) < 1 {
+		cmds.printHelp(os.Stderr)
+		return exitUsage
+	}
+	if args[0] == "-h" || args[0] == "--help" {
+		args[0] = "help"
+	}
+
+	programState := &state{opts: opts, out: out}
+	defer programState.close()
+
+	err = cmds.run(programState, command{name: args[0], args: args[1:]})
 	if err != nil {
-		log.Fatalf("error connecting to database: %v\n", err)
+		slog.Error(err.Error(), "command", args[0])
+		var ue *usageError
+		if errors.As(err, &ue) {
+			if rc, found := cmds.lookup(ue.cmd); found {
+				fmt.Fprintf(os.Stderr, "Usage: %s\n", rc.synopsis())
+				fmt.Fprintf(os.Stderr,
+					"Run \"gogator help %s\" for more information.\n", rc.name)
+			} else {
+				fmt.Fprintln(os.Stderr,
+					`Run "gogator help" for a list of commands.`)
+			}
+		}
 	}
-	defer db.Close()
+	return exitCode(err)
+}
 
-	dbq := database.New(db)
+// destructiveFlags are the flags of commands that delete data.
+func destructiveFlags(fs *flag.FlagSet) {
+	fs.Bool("yes", false, "don't ask for confirmation")
+	fs.Bool("dry-run", false, "print what would be deleted without deleting it")
+}
 
-	programState := &state{cfg: &cfg, db: dbq}
-	cmds := &commands{registeredCmds: make(map[string]handler)}
+func registerCommands(cmds *commands) {
+	cmds.register("help", cmds.handlerHelp, commandInfo{
+		usage:    "[command]",
+		short:    "Show help for gogator or one of its commands",
+		maxArgs:  1,
+		offline:  true,
+		complete: cmds.completeCommands,
+	})
+	cmds.register("completion", handlerCompletion, commandInfo{
+		usage: "<shell>",
+		short: "Print the shell completion script for bash, zsh or fish",
+		long: `Print the shell completion script for bash, zsh or fish.
 
-	cmds.register("login", handlerLogin)
-	cmds.register("register", handlerRegister)
-	cmds.register("users", handlerListUsers)
-	cmds.register("reset", handlerReset)
-	cmds.register("agg", handlerAggregate)
-	cmds.register("addfeed", MiddlewareLoggedIn(handlerAddFeed))
-	cmds.register("feeds", handlerListFeeds)
-	cmds.register("follow", MiddlewareLoggedIn(handlerFollow))
-	cmds.register("following", MiddlewareLoggedIn(handlerGetFollows))
-	cmds.register("unfollow", MiddlewareLoggedIn(handlerUnfollow))
-	cmds.register("browse", handlerBrowse)
+  bash: source <(gogator completion bash)
+  zsh:  source <(gogator completion zsh)
+  fish: gogator completion fish | source
 
-	if len(os.Args) < 2 {
-		log.Fatal("Usage: cli <command> [args...]")
-	}
+Feed URLs and usernames are completed from the database.`,
+		minArgs:  1,
+		maxArgs:  1,
+		offline:  true,
+		complete: completeValues(completionShells...),
+	})
+	cmds.register("login", handlerLogin, commandInfo{
+		usage: "<username>",
+		short: "Log in as an existing user",
+		long: `Log in as an existing user.
 
-	cmdName := os.Args[1]
-	cmdArgs := os.Args[2:]
+The password is read from the terminal or from the first line of stdin.
+Users registered before passwords existed can't log in until an admin
+sets their password with "gogator admin password".`,
+		minArgs:  1,
+		maxArgs:  1,
+		complete: completeUsers,
+	})
+	cmds.register("register", handlerRegister, commandInfo{
+		usage: "<username>",
+		short: "Register a new user and log in as them",
+		long: `Register a new user and log in as them.
 
-	err = cmds.run(programState, command{
-		name: cmdName, args: cmdArgs,
+The password is read from the terminal, twice, or from the first line of
+stdin. It must be at least 8 characters long.`,
+		minArgs: 1,
+		maxArgs: 1,
 	})
-	if err != nil {
-		log.Fatalf("[ERROR]: %v", err)
+	cmds.register("logout", handlerLogout, commandInfo{
+		short: "Log out the current user",
+	})
+	cmds.register("passwd", MiddlewareLoggedIn(handlerPasswd), commandInfo{
+		short: "Change the password of the current user",
+		long: `Change the password of the current user.
+
+Every other session of the user, in the CLI and the web reader, is
+logged out.`,
+	})
+	cmds.register("users", handlerListUsers, commandInfo{
+		short: "List all users and show who is currently logged in",
+		flags: func(fs *flag.FlagSet) {
+			fs.Bool("details", false, "also show what users own and when they last logged in")
+		},
+	})
+	cmds.register("whoami", MiddlewareLoggedInRead(handlerWhoami), commandInfo{
+		short: "Show the current user",
+	})
+	cmds.register("deleteuser", MiddlewareAdmin(handlerDeleteUser), commandInfo{
+		usage: "<username>",
+		short: "Delete a user and everything they own",
+		long: `Delete a user and everything they own: follows, read and starred
+posts, published feeds, tokens and sessions. Only admins can delete
+users.
+
+The feeds the user added that other users follow are transferred to
+their oldest follower. The others are attributed to no one and deleted
+with their posts by the feed garbage collection.
+
+What will be deleted is shown before asking for confirmation. --yes
+skips the question, which is required when stdin isn't a terminal, and
+--dry-run only shows it.`,
+		minArgs:  1,
+		maxArgs:  1,
+		flags:    destructiveFlags,
+		complete: completeUsers,
+	})
+	cmds.register("renameuser", MiddlewareAdmin(handlerRenameUser), commandInfo{
+		usage: "<username> <new name>",
+		short: "Rename a user",
+		long: `Rename a user. Only admins can rename users.
+
+The user's Fever password is derived from their name, so it has to be
+set again with "gogator feverkey".`,
+		minArgs:  2,
+		maxArgs:  2,
+		complete: completeUsers,
+	})
+	cmds.register("reset", MiddlewareAdmin(handlerReset), commandInfo{
+		short: "Delete every user, feed, follow and post",
+		long: `Delete every user, feed, follow and post. Only admins can reset.
+
+It asks for confirmation first, --yes skips the question, which is
+required when stdin isn't a terminal. --dry-run prints the number of
+rows that would be deleted instead.`,
+		flags: destructiveFlags,
+	})
+	cmds.register("admin", middlewareAdminSetup(handlerAdmin), commandInfo{
+		usage: "<grant|revoke|password> <username>",
+		short: "Grant or revoke the admin role, or set a password",
+		long: `Grant or revoke the admin role, or set the password of a user. Only
+admins can change roles and passwords.
+
+Admins can run the commands that affect every user, such as reset. The
+first registered user is an admin, and the last admin can't be revoked.
+
+password sets the password of a user who forgot theirs, or who was
+registered before passwords existed and can't log in without one, and
+logs out their sessions. The password is read like for register. While
+no admin has a password, as right after upgrading an install from before
+passwords, it runs without logging in, for an admin only.`,
+		minArgs:  2,
+		maxArgs:  2,
+		complete: completeValues(adminActions...),
+	})
+	cmds.register("agg", handlerAggregate, commandInfo{
+		usage: "<interval>",
+		short: "Collect feeds in the background at a fixed interval",
+		long: `Collect feeds in the background, fetching the least recently
+fetched feed every interval (e.g. 30s, 1m, 1h) until interrupted.
+
+  SIGHUP           reload the config file and the feed set of status
+  SIGUSR1          write the state of every feed to stderr
+  SIGINT, SIGTERM  stop, waiting up to --drain for the fetches in
+                   flight, a second signal cancels them right away
+
+Every turn asks the database for the next feed, so feeds added or
+removed are fetched or left out without a SIGHUP, which only updates
+the feeds listed by status sooner.
+
+"gogator status" shows the state of a running agg, served on a Unix
+socket.`,
+		minArgs: 1,
+		maxArgs: 1,
+		aliases: []string{"aggregate"},
+		flags: func(fs *flag.FlagSet) {
+			fs.String("socket", defaultSocketPath(), "path of the status socket")
+			fs.Duration("drain", 30*time.Second, "how long to wait for fetches in flight when stopping")
+			fs.String("metrics-addr", "", "serve Prometheus metrics at /metrics on this address (e.g. localhost:9090)")
+		},
+	})
+	cmds.register("status", handlerStatus, commandInfo{
+		short: "Show the state of a running agg",
+		long: `Show the state of a running agg: its uptime, the fetches and failures
+since it started, the number of feeds due and, for every feed, when it
+was last attempted and last fetched successfully and the last error.
+
+agg fetches one feed per interval, so a feed is due once it hasn't been
+attempted for as many intervals as there are feeds. Feeds due pile up
+when fetches can't keep up with the interval.`,
+		offline: true,
+		flags: func(fs *flag.FlagSet) {
+			fs.String("socket", defaultSocketPath(), "path of the status socket of agg")
+		},
+	})
+	cmds.register("fetch", handlerFetch, commandInfo{
+		short: "Fetch feeds once and print a summary",
+		long: `Fetch feeds once, print a summary per feed and exit.
+
+Choose the feeds with --all, one or more --feed, or --stale to fetch
+the feeds not successfully fetched for a while. Like agg, --all and
+--stale skip the feeds no one follows anymore. The exit code is 1
+when any feed couldn't be fetched, which suits cron jobs:
+
+  gogator fetch --stale 30m`,
+		flags: func(fs *flag.FlagSet) {
+			fs.Bool("all", false, "fetch every followed feed")
+			fs.Var(new(stringsFlag), "feed", "fetch this feed (url or name), may be repeated")
+			fs.String("stale", "", "fetch the feeds not fetched for this long (e.g. 30m, 1d)")
+		},
+		flagValues: map[string]completer{
+			"feed": completeFeeds,
+		},
+	})
+	cmds.register("addfeed", MiddlewareLoggedIn(handlerAddFeed), commandInfo{
+		usage:   "<name> <url>",
+		short:   "Add a new feed to the aggregator and follow it",
+		minArgs: 2,
+		maxArgs: 2,
+	})
+	cmds.register("transferfeed", MiddlewareLoggedIn(handlerTransferFeed), commandInfo{
+		usage: "<url|name> <username>",
+		short: "Attribute a feed to another user",
+		long: `Attribute a feed to another user, as if they had added it.
+
+Admins can transfer any feed, other users the feeds they added. Feeds
+whose user was deleted are attributed to no one until transferred.`,
+		minArgs:  2,
+		maxArgs:  2,
+		complete: completeFeeds,
+	})
+	cmds.register("feedauth", MiddlewareLoggedIn(handlerFeedAuth), commandInfo{
+		usage: "<set|clear|list> [url|name]",
+		short: "Manage the credentials used to fetch private feeds",
+		long: `Manage the credentials sent when fetching a feed.
+
+  set <url|name>      replace the credentials of a feed
+  clear <url|name>    delete the credentials of a feed
+  list                list the feeds with credentials and their kinds
+
+set prompts for the password of --basic, the --bearer token and the
+value of every --header and --cookie, in that order, one per line when
+stdin isn't a terminal. Credentials are encrypted with the key in
+$GOGATOR_CREDENTIALS_KEY or the credentials_key setting, and are never
+shown. Admins can change the credentials of any feed, other users those
+of the feeds they added.`,
+		minArgs: 1,
+		maxArgs: 2,
+		flags: func(fs *flag.FlagSet) {
+			fs.String("basic", "", "authenticate with HTTP basic auth as this username")
+			fs.Bool("bearer", false, "authenticate with a bearer token")
+			fs.Var(new(stringsFlag), "header", "send this header, may be repeated")
+			fs.Var(new(stringsFlag), "cookie", "send this cookie, may be repeated")
+		},
+		complete: completeValues(feedAuthActions...),
+	})
+	cmds.register("gcfeeds", MiddlewareAdmin(handlerGCFeeds), commandInfo{
+		short: "Delete the feeds no one has followed for a while",
+		long: `Delete the feeds no one has followed for the grace period, along
+with their posts. Only admins can collect feeds.
+
+agg does the same every hour with the default grace period. A feed
+followed again during the grace period is kept.`,
+		flags: func(fs *flag.FlagSet) {
+			destructiveFlags(fs)
+			fs.String("grace", formatAge(feedGCGrace),
+				"delete feeds no one has followed for this long (e.g. 12h, 7d)")
+		},
+	})
+	cmds.register("feeds", handlerListFeeds, commandInfo{
+		short: "List all available feeds",
+	})
+	cmds.register("follow", MiddlewareLoggedIn(handlerFollow), commandInfo{
+		usage:    "<url>",
+		short:    "Follow an existing feed",
+		minArgs:  1,
+		maxArgs:  1,
+		complete: completeFeedURLs,
+	})
+	cmds.register("following", MiddlewareLoggedInRead(handlerGetFollows), commandInfo{
+		short:   "Show all feeds the current user is following",
+		aliases: []string{"follows"},
+	})
+	cmds.register("unfollow", MiddlewareLoggedIn(handlerUnfollow), commandInfo{
+		usage:    "<url>",
+		short:    "Unfollow a feed",
+		minArgs:  1,
+		maxArgs:  1,
+		complete: completeFollowedFeeds,
+	})
+	cmds.register("tui", MiddlewareLoggedIn(handlerTUI), commandInfo{
+		short: "Read followed feeds in a full-screen terminal reader",
+		long: `Read followed feeds in a full-screen terminal reader.
+
+The left pane lists the feeds you follow with their unread counts, the
+right panes show the posts of the selected feed and the open post.
+
+  j/k, arrows    move the selection or scroll the open post
+  h/l, tab       switch between panes
+  enter          open the selected feed or post
+  n/p            open the next or previous post
+  space/b        scroll the open post by a page
+  m              toggle read
+  s              toggle star
+  o              open the post in the browser
+  r              reload from the database
+  R              fetch the selected feed now
+  q              quit`,
+		aliases: []string{"reader"},
+	})
+	cmds.register("browse", handlerBrowse, commandInfo{
+		usage: "[limit]",
+		short: "Browse aggregated posts",
+		long: `Browse aggregated posts, newest first by default.
+
+Posts are paged with cursors: every page ends with the --before and
+--after cursors of the next and previous pages.`,
+		maxArgs: 1,
+		aliases: []string{"posts"},
+		flags: func(fs *flag.FlagSet) {
+			fs.Int("limit", 2, "maximum number of posts to show")
+			fs.String("before", "", "show posts before this cursor")
+			fs.String("after", "", "show posts after this cursor")
+			fs.String("feed", "", "only show posts from this feed (url or name)")
+			fs.String("since", "", "only show posts published within this duration (e.g. 24h, 7d)")
+			fs.String("order", "newest", "sort order: newest or oldest")
+		},
+		flagValues: map[string]completer{
+			"feed":  completeFeeds,
+			"order": completeValues("newest", "oldest"),
+		},
+	})
+	cmds.register("token", MiddlewareLoggedIn(handlerToken), commandInfo{
+		usage: "<create|list|revoke> [name|id]",
+		short: "Manage the API tokens of the current user",
+		long: `Manage the API tokens of the current user.
+
+  create [name]       create a token, shown only once
+  list                list tokens with their scope, expiry and last use
+  revoke <name|id>    revoke a token
+
+Tokens authenticate requests to the HTTP APIs, sent as "Authorization:
+Bearer <token>", and CLI commands run with the token in $GOGATOR_TOKEN
+instead of the logged in session. Read tokens can only run commands and
+requests that don't change anything. Tokens can't create or revoke
+tokens.`,
+		minArgs: 1,
+		maxArgs: 2,
+		flags: func(fs *flag.FlagSet) {
+			fs.String("scope", scopeRead, "scope of the created token: read or write")
+			fs.String("expires", "", "lifetime of the created token (e.g. 12h, 90d), it never expires by default")
+		},
+		complete: completeValues(tokenActions...),
+		flagValues: map[string]completer{
+			"scope": completeValues(tokenScopes...),
+		},
+	})
+	cmds.register("feverkey", MiddlewareLoggedIn(handlerFeverKey), commandInfo{
+		short: "Set the password Fever API clients log in with",
+		long: `Set the password Fever API clients log in with.
+
+Fever clients log in with your username and this password, which is
+read from the terminal or from the first line of stdin. Only the api
+key derived from both is stored.`,
+	})
+	timelineFlags := func(fs *flag.FlagSet) {
+		fs.Var(new(stringsFlag), "feed",
+			"only include this feed (url or name), may be repeated to group feeds")
+		fs.String("search", "", "only include posts whose title or description contains this text")
+		fs.String("title", "", "title of the generated feed")
 	}
+	cmds.register("export-feed", MiddlewareLoggedInRead(handlerExportFeed), commandInfo{
+		usage: "<file>",
+		short: "Export followed posts as an RSS, Atom or JSON feed",
+		long: `Export the posts of the feeds you follow as an RSS 2.0, Atom or
+JSON Feed file, newest first. Use "-" to write to stdout.
+
+--feed narrows the export to a group of feeds and --search to the posts
+matching a text, which makes it a saved search.`,
+		minArgs: 1,
+		maxArgs: 1,
+		flags: func(fs *flag.FlagSet) {
+			timelineFlags(fs)
+			fs.String("format", feedFormatAtom, "feed format: rss, atom or json")
+			fs.Int("limit", timelineDefaultLimit, "maximum number of posts to export")
+		},
+		flagValues: map[string]completer{
+			"feed":   completeFeeds,
+			"format": completeValues(feedFormats...),
+		},
+	})
+	cmds.register("publish", MiddlewareLoggedIn(handlerPublish), commandInfo{
+		usage: "<name>",
+		short: "Publish followed posts as a feed at a secret URL",
+		long: `Publish the posts of the feeds you follow as a feed served by
+"gogator serve" at a secret URL, in Atom, RSS and JSON Feed.
+
+--feed narrows the feed to a group of feeds and --search to the posts
+matching a text. Anyone with the URL can read the feed, unpublish it to
+revoke the URL.`,
+		minArgs: 1,
+		maxArgs: 1,
+		flags:   timelineFlags,
+		flagValues: map[string]completer{
+			"feed": completeFeeds,
+		},
+	})
+	cmds.register("published", MiddlewareLoggedInRead(handlerListPublished), commandInfo{
+		short: "List the feeds the current user has published",
+	})
+	cmds.register("unpublish", MiddlewareLoggedIn(handlerUnpublish), commandInfo{
+		usage:   "<name>",
+		short:   "Stop publishing a feed",
+		minArgs: 1,
+		maxArgs: 1,
+	})
+	cmds.register("serve", handlerServe, commandInfo{
+		short: "Serve the web reader and the HTTP APIs",
+		long: `Serve the web reader and the HTTP APIs until interrupted.
+
+The web reader is at the root: log in with your username and password.
+
+The API is versioned under /api/v1 and described by the OpenAPI
+document at /api/v1/openapi.json. Requests are authenticated with
+tokens created by "gogator token create".
+
+Reader apps can sync through the Google Reader API, logging in with a
+username and password or API token, or through the Fever API at /fever/, logging in
+with the password set by "gogator feverkey".
+
+Feeds published with "gogator publish" are served under /published/.
+
+Prometheus metrics are served at /metrics.`,
+		flags: func(fs *flag.FlagSet) {
+			fs.String("addr", "localhost:8080", "address to listen on")
+		},
+	})
 }
@@ -0,0 +1,722 @@
+package gogator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prchop/gogator/internal/database"
+)
+
+// The Google Reader API is the de facto sync protocol of feed reader
+// apps. Only the subset used by common clients is implemented.
+const greaderPrefix = "/reader/api/0"
+
+// Stream and tag IDs. The user part of "user/<id>/..." is always
+// normalized to "-", which means the authenticated user.
+const (
+	streamReadingList = "user/-/state/com.google/reading-list"
+	streamStarred     = "user/-/state/com.google/starred"
+	streamRead        = "user/-/state/com.google/read"
+	streamKeptUnread  = "user/-/state/com.google/kept-unread"
+	streamFeedPrefix  = "feed/"
+	itemIDPrefix      = "tag:google.com,2005:reader/item/"
+)
+
+const (
+	greaderDefaultItems = 20
+	greaderMaxItems     = 1000
+)
+
+var streamUser = regexp.MustCompile(`^user/[^/]+/`)
+
+type greaderHandler func(w http.ResponseWriter, r *http.Request, user database.User) error
+
+type greaderServer struct {
+	s *state
+}
+
+// newGReaderHandler returns the handler of the Google Reader API,
+// ready to be mounted on the root of the server.
+func newGReaderHandler(s *state) http.Handler {
+	g := &greaderServer{s: s}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/accounts/ClientLogin", g.handleClientLogin)
+	routes := map[string]greaderHandler{
+		"GET /token":                   g.handleToken,
+		"GET /user-info":               g.handleUserInfo,
+		"GET /subscription/list":       g.handleSubscriptions,
+		"POST /subscription/edit":      g.handleEditSubscription,
+		"POST /subscription/quickadd":  g.handleQuickAdd,
+		"GET /tag/list":                g.handleTags,
+		"GET /unread-count":            g.handleUnreadCount,
+		"GET /stream/contents/{id...}": g.handleStreamContents,
+		"GET /stream/items/ids":        g.handleItemIDs,
+		"GET /stream/items/contents":   g.handleItemContents,
+		"POST /stream/items/contents":  g.handleItemContents,
+		"POST /edit-tag":               g.handleEditTag,
+		"POST /mark-all-as-read":       g.handleMarkAllRead,
+	}
+	for pattern, h := range routes {
+		method, path, _ := strings.Cut(pattern, " ")
+		// Clients POST to fetch items, every other POST edits.
+		scope := scopeRead
+		if method == http.MethodPost && path != "/stream/items/contents" {
+			scope = scopeWrite
+		}
+		mux.Handle(method+" "+greaderPrefix+path, g.wrap(h, scope))
+	}
+	return mux
+}
+
+// greaderToken returns the token of a "GoogleLogin auth=<token>"
+// authorization header.
+func greaderToken(r *http.Request) string {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"),
+		"GoogleLogin auth=")
+	return token
+}
+
+func (g *greaderServer) wrap(h greaderHandler, scope string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := greaderToken(r)
+		if token == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		user, tokenScope, err := authenticateToken(r.Context(), g.s.db, token)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err == nil && !scopeAllows(tokenScope, scope) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if err == nil {
+			err = r.ParseForm()
+		}
+		if err == nil {
+			err = h(w, r, user)
+		}
+		if err != nil {
+			writeGReaderError(w, err)
+		}
+	})
+}
+
+func writeGReaderError(w http.ResponseWriter, err error) {
+	var ae *apiError
+	switch {
+	case errors.As(err, &ae):
+		http.Error(w, ae.msg, ae.status)
+	case errors.Is(err, errNotFound), errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Not found", http.StatusNotFound)
+	default:
+		slog.Error("greader request failed", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func writeText(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, text)
+}
+
+// handleClientLogin exchanges a username and password for the token
+// sent with the following requests. The password is either the user's
+// password, which starts a session, or an API token created with
+// "gogator token create", which is handed back as is.
+func (g *greaderServer) handleClientLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	name, password := r.Form.Get("Email"), r.Form.Get("Passwd")
+
+	token := password
+	user, _, err := authenticateToken(ctx, g.s.db, password)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = g.s.db.GetUser(ctx, name)
+		if err == nil || errors.Is(err, sql.ErrNoRows) {
+			err = checkPassword(user, password)
+		}
+		if err == nil {
+			token, err = startSession(ctx, g.s, user)
+		}
+	}
+	if errors.Is(err, errUnauthorized) || (err == nil && user.Name != name) {
+		http.Error(w, "Error=BadAuthentication", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		writeGReaderError(w, err)
+		return
+	}
+	writeText(w, fmt.Sprintf("SID=%s\nLSID=null\nAuth=%s\n", token, token))
+}
+
+// handleToken returns the edit token clients send along with their
+// POST requests. Requests are authenticated by a header rather than a
+// cookie, so the token isn't needed against CSRF and isn't checked.
+func (g *greaderServer) handleToken(w http.ResponseWriter, r *http.Request, _ database.User) error {
+	writeText(w, hashToken(greaderToken(r))[:57])
+	return nil
+}
+
+type greaderUserInfo struct {
+	UserID        string `json:"userId"`
+	UserName      string `json:"userName"`
+	UserProfileID string `json:"userProfileId"`
+	UserEmail     string `json:"userEmail"`
+}
+
+func (g *greaderServer) handleUserInfo(w http.ResponseWriter, r *http.Request, user database.User) error {
+	writeJSON(w, http.StatusOK, greaderUserInfo{
+		UserID:        user.ID.String(),
+		UserName:      user.Name,
+		UserProfileID: user.ID.String(),
+	})
+	return nil
+}
+
+type (
+	greaderCategory struct {
+		ID    string `json:"id"`
+		Label string `json:"label"`
+	}
+
+	greaderSubscription struct {
+		ID         string            `json:"id"`
+		Title      string            `json:"title"`
+		Categories []greaderCategory `json:"categories"`
+		URL        string            `json:"url"`
+		HTMLURL    string            `json:"htmlUrl"`
+		IconURL    string            `json:"iconUrl"`
+	}
+)
+
+func feedStreamID(id uuid.UUID) string {
+	return streamFeedPrefix + id.String()
+}
+
+func (g *greaderServer) handleSubscriptions(w http.ResponseWriter, r *http.Request, user database.User) error {
+	follows, err := g.s.db.GetFeedFollowsForUser(r.Context(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	subs := make([]greaderSubscription, 0, len(follows))
+	for _, ff := range follows {
+		subs = append(subs, greaderSubscription{
+			ID:         feedStreamID(ff.FeedID),
+			Title:      ff.FeedName,
+			Categories: []greaderCategory{},
+			URL:        ff.FeedUrl,
+			HTMLURL:    ff.FeedUrl,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"subscriptions": subs})
+	return nil
+}
+
+// lookupStreamFeed returns the feed of a "feed/..." stream ID. Feeds
+// are listed with their ID, but clients subscribing to a new feed use
+// its URL.
+func (g *greaderServer) lookupStreamFeed(ctx context.Context, stream string) (database.Feed, error) {
+	ref, ok := strings.CutPrefix(stream, streamFeedPrefix)
+	if !ok {
+		return database.Feed{}, apiErrorf(http.StatusBadRequest,
+			"invalid feed stream %q", stream)
+	}
+	if id, err := uuid.Parse(ref); err == nil {
+		return g.s.db.GetFeedByID(ctx, id)
+	}
+	return g.s.db.GetFeedByUrl(ctx, ref)
+}
+
+func (g *greaderServer) handleEditSubscription(w http.ResponseWriter, r *http.Request, user database.User) error {
+	ctx := r.Context()
+	for _, stream := range r.Form["s"] {
+		switch action := r.Form.Get("ac"); action {
+		case "subscribe":
+			url, ok := strings.CutPrefix(stream, streamFeedPrefix)
+			if !ok {
+				return apiErrorf(http.StatusBadRequest, "invalid feed stream %q", stream)
+			}
+			if _, err := subscribe(ctx, g.s, user, url, r.Form.Get("t")); err != nil {
+				return err
+			}
+		case "unsubscribe":
+			feed, err := g.lookupStreamFeed(ctx, stream)
+			if err != nil {
+				return err
+			}
+			err = g.s.db.DeleteFeedFollow(ctx, database.DeleteFeedFollowParams{
+				UserID: user.ID,
+				FeedID: feed.ID,
+			})
+			if err != nil {
+				return err
+			}
+		case "edit":
+			// Renaming and labels aren't supported, feeds keep the name
+			// they were added with.
+		default:
+			return apiErrorf(http.StatusBadRequest, "unknown action %q", action)
+		}
+	}
+	writeText(w, "OK")
+	return nil
+}
+
+func (g *greaderServer) handleQuickAdd(w http.ResponseWriter, r *http.Request, user database.User) error {
+	url := strings.TrimPrefix(r.Form.Get("quickadd"), streamFeedPrefix)
+	if url == "" {
+		return apiErrorf(http.StatusBadRequest, "missing quickadd")
+	}
+
+	feed, err := subscribe(r.Context(), g.s, user, url, "")
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"numResults": 1,
+		"query":      url,
+		"streamId":   feedStreamID(feed.ID),
+		"streamName": feed.Name,
+	})
+	return nil
+}
+
+func (g *greaderServer) handleTags(w http.ResponseWriter, r *http.Request, _ database.User) error {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"tags": []map[string]string{{"id": streamStarred}},
+	})
+	return nil
+}
+
+type greaderUnreadCount struct {
+	ID                      string `json:"id"`
+	Count                   int64  `json:"count"`
+	NewestItemTimestampUsec string `json:"newestItemTimestampUsec"`
+}
+
+func (g *greaderServer) handleUnreadCount(w http.ResponseWriter, r *http.Request, user database.User) error {
+	rows, err := g.s.db.GetUnreadCounts(r.Context(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	total := greaderUnreadCount{ID: streamReadingList}
+	var newest time.Time
+	counts := make([]greaderUnreadCount, 0, len(rows)+1)
+	for _, row := range rows {
+		counts = append(counts, greaderUnreadCount{
+			ID:                      feedStreamID(row.ID),
+			Count:                   row.UnreadCount,
+			NewestItemTimestampUsec: usec(row.NewestAt),
+		})
+		total.Count += row.UnreadCount
+		if row.NewestAt.After(newest) {
+			newest = row.NewestAt
+		}
+	}
+	total.NewestItemTimestampUsec = usec(newest)
+	counts = append(counts, total)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"max":          greaderMaxItems,
+		"unreadcounts": counts,
+	})
+	return nil
+}
+
+func usec(t time.Time) string {
+	return strconv.FormatInt(t.UnixMicro(), 10)
+}
+
+// streamParams converts the stream parameters shared by stream/contents
+// and stream/items/ids to query parameters.
+func (g *greaderServer) streamParams(ctx context.Context, r *http.Request,
+	stream string, user database.User,
+) (database.GetStreamItemsParams, error) {
+	params := database.GetStreamItemsParams{
+		UserID:      user.ID,
+		Limit:       greaderDefaultItems,
+		OldestFirst: r.Form.Get("r") == "o",
+	}
+
+	switch stream = streamUser.ReplaceAllString(stream, "user/-/"); {
+	case stream == streamReadingList:
+	case stream == streamStarred:
+		params.StarredOnly = true
+	case strings.HasPrefix(stream, streamFeedPrefix):
+		feed, err := g.lookupStreamFeed(ctx, stream)
+		if err != nil {
+			return params, err
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	default:
+		return params, apiErrorf(http.StatusBadRequest, "unknown stream %q", stream)
+	}
+
+	for _, xt := range r.Form["xt"] {
+		if streamUser.ReplaceAllString(xt, "user/-/") == streamRead {
+			params.UnreadOnly = true
+		}
+	}
+
+	if v := r.Form.Get("n"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return params, apiErrorf(http.StatusBadRequest, "invalid n %q", v)
+		}
+		params.Limit = int32(min(n, greaderMaxItems))
+	}
+
+	if v := r.Form.Get("c"); v != "" {
+		c, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return params, apiErrorf(http.StatusBadRequest, "invalid continuation %q", v)
+		}
+		params.Continuation = sql.NullInt64{Int64: c, Valid: true}
+	}
+
+	var err error
+	if params.NewerThan, err = formTime(r, "ot"); err != nil {
+		return params, err
+	}
+	if params.OlderThan, err = formTime(r, "nt"); err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+// formTime parses a form value holding a Unix time in seconds.
+func formTime(r *http.Request, name string) (sql.NullTime, error) {
+	v := r.Form.Get(name)
+	if v == "" {
+		return sql.NullTime{}, nil
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return sql.NullTime{}, apiErrorf(http.StatusBadRequest, "invalid %s %q", name, v)
+	}
+	return sql.NullTime{Time: time.Unix(sec, 0).UTC(), Valid: true}, nil
+}
+
+// continuation returns the continuation of a full page of items.
+func continuation(items []database.GetStreamItemsRow, limit int32) string {
+	if len(items) == 0 || len(items) < int(limit) {
+		return ""
+	}
+	return strconv.FormatInt(items[len(items)-1].Post.Seq, 10)
+}
+
+type (
+	greaderLink struct {
+		Href string `json:"href"`
+		Type string `json:"type,omitempty"`
+	}
+
+	greaderContent struct {
+		Direction string `json:"direction"`
+		Content   string `json:"content"`
+	}
+
+	greaderOrigin struct {
+		StreamID string `json:"streamId"`
+		Title    string `json:"title"`
+		HTMLURL  string `json:"htmlUrl"`
+	}
+
+	greaderItem struct {
+		ID            string         `json:"id"`
+		CrawlTimeMsec string         `json:"crawlTimeMsec"`
+		TimestampUsec string         `json:"timestampUsec"`
+		Published     int64          `json:"published"`
+		Updated       int64          `json:"updated"`
+		Title         string         `json:"title"`
+		Canonical     []greaderLink  `json:"canonical"`
+		Alternate     []greaderLink  `json:"alternate"`
+		Summary       greaderContent `json:"summary"`
+		Categories    []string       `json:"categories"`
+		Origin        greaderOrigin  `json:"origin"`
+		Author        string         `json:"author"`
+	}
+
+	greaderStream struct {
+		Direction    string        `json:"direction"`
+		ID           string        `json:"id"`
+		Title        string        `json:"title"`
+		Updated      int64         `json:"updated"`
+		Items        []greaderItem `json:"items"`
+		Continuation string        `json:"continuation,omitempty"`
+	}
+)
+
+func itemID(seq int64) string {
+	return fmt.Sprintf("%s%016x", itemIDPrefix, seq)
+}
+
+// parseItemID accepts the long form of item IDs, which is hexadecimal,
+// and the short form, which is decimal.
+func parseItemID(s string) (int64, error) {
+	var (
+		n   uint64
+		err error
+	)
+	if hex, ok := strings.CutPrefix(s, itemIDPrefix); ok {
+		n, err = strconv.ParseUint(hex, 16, 64)
+	} else {
+		n, err = strconv.ParseUint(s, 10, 64)
+	}
+	if err != nil {
+		return 0, apiErrorf(http.StatusBadRequest, "invalid item id %q", s)
+	}
+	return int64(n), nil
+}
+
+func formItemIDs(r *http.Request) ([]int64, error) {
+	seqs := make([]int64, 0, len(r.Form["i"]))
+	for _, v := range r.Form["i"] {
+		seq, err := parseItemID(v)
+		if err != nil {
+			return nil, err
+		}
+		seqs = append(seqs, seq)
+	}
+	return seqs, nil
+}
+
+func toGReaderItem(row database.GetStreamItemsRow) greaderItem {
+	p := row.Post
+	published := p.CreatedAt
+	if p.PublishedAt.Valid {
+		published = p.PublishedAt.Time
+	}
+
+	categories := []string{streamReadingList}
+	if row.Read {
+		categories = append(categories, streamRead)
+	}
+	if row.Starred {
+		categories = append(categories, streamStarred)
+	}
+
+	return greaderItem{
+		ID:            itemID(p.Seq),
+		CrawlTimeMsec: strconv.FormatInt(p.CreatedAt.UnixMilli(), 10),
+		TimestampUsec: usec(p.CreatedAt),
+		Published:     published.Unix(),
+		Updated:       p.UpdatedAt.Unix(),
+		Title:         p.Title,
+		Canonical:     []greaderLink{{Href: p.Url}},
+		Alternate:     []greaderLink{{Href: p.Url, Type: "text/html"}},
+		Summary:       greaderContent{Direction: "ltr", Content: p.Description.String},
+		Categories:    categories,
+		Origin: greaderOrigin{
+			StreamID: feedStreamID(p.FeedID),
+			Title:    row.FeedName,
+			HTMLURL:  row.FeedUrl,
+		},
+	}
+}
+
+func (g *greaderServer) handleStreamContents(w http.ResponseWriter, r *http.Request, user database.User) error {
+	stream := r.PathValue("id")
+	if stream == "" {
+		stream = streamReadingList
+	}
+
+	ctx := r.Context()
+	params, err := g.streamParams(ctx, r, stream, user)
+	if err != nil {
+		return err
+	}
+	rows, err := g.s.db.GetStreamItems(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	out := greaderStream{
+		Direction:    "ltr",
+		ID:           stream,
+		Title:        stream,
+		Updated:      time.Now().Unix(),
+		Items:        make([]greaderItem, 0, len(rows)),
+		Continuation: continuation(rows, params.Limit),
+	}
+	for _, row := range rows {
+		out.Items = append(out.Items, toGReaderItem(row))
+	}
+	writeJSON(w, http.StatusOK, out)
+	return nil
+}
+
+type greaderItemRef struct {
+	ID              string   `json:"id"`
+	DirectStreamIDs []string `json:"directStreamIds"`
+	TimestampUsec   string   `json:"timestampUsec"`
+}
+
+func (g *greaderServer) handleItemIDs(w http.ResponseWriter, r *http.Request, user database.User) error {
+	ctx := r.Context()
+	params, err := g.streamParams(ctx, r, r.Form.Get("s"), user)
+	if err != nil {
+		return err
+	}
+	rows, err := g.s.db.GetStreamItems(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	refs := make([]greaderItemRef, 0, len(rows))
+	for _, row := range rows {
+		refs = append(refs, greaderItemRef{
+			ID:              strconv.FormatInt(row.Post.Seq, 10),
+			DirectStreamIDs: []string{},
+			TimestampUsec:   usec(row.Post.CreatedAt),
+		})
+	}
+
+	out := map[string]any{"itemRefs": refs}
+	if c := continuation(rows, params.Limit); c != "" {
+		out["continuation"] = c
+	}
+	writeJSON(w, http.StatusOK, out)
+	return nil
+}
+
+func (g *greaderServer) handleItemContents(w http.ResponseWriter, r *http.Request, user database.User) error {
+	seqs, err := formItemIDs(r)
+	if err != nil {
+		return err
+	}
+
+	rows, err := g.s.db.GetStreamItemsBySeq(r.Context(),
+		database.GetStreamItemsBySeqParams{UserID: user.ID, Seqs: seqs})
+	if err != nil {
+		return err
+	}
+
+	out := greaderStream{
+		Direction: "ltr",
+		ID:        streamReadingList,
+		Title:     streamReadingList,
+		Updated:   time.Now().Unix(),
+		Items:     make([]greaderItem, 0, len(rows)),
+	}
+	for _, row := range rows {
+		out.Items = append(out.Items, toGReaderItem(database.GetStreamItemsRow(row)))
+	}
+	writeJSON(w, http.StatusOK, out)
+	return nil
+}
+
+// handleEditTag adds and removes the read and starred states of items.
+// Other tags are ignored.
+func (g *greaderServer) handleEditTag(w http.ResponseWriter, r *http.Request, user database.User) error {
+	seqs, err := formItemIDs(r)
+	if err != nil {
+		return err
+	}
+
+	ctx := r.Context()
+	rows, err := g.s.db.GetStreamItemsBySeq(ctx,
+		database.GetStreamItemsBySeqParams{UserID: user.ID, Seqs: seqs})
+	if err != nil {
+		return err
+	}
+
+	edits := map[string]func(id uuid.UUID) error{}
+	for _, tag := range r.Form["a"] {
+		switch streamUser.ReplaceAllString(tag, "user/-/") {
+		case streamRead:
+			edits[streamRead] = g.setRead(ctx, user, true)
+		case streamKeptUnread:
+			edits[streamRead] = g.setRead(ctx, user, false)
+		case streamStarred:
+			edits[streamStarred] = g.setStar(ctx, user, true)
+		}
+	}
+	for _, tag := range r.Form["r"] {
+		switch streamUser.ReplaceAllString(tag, "user/-/") {
+		case streamRead:
+			edits[streamRead] = g.setRead(ctx, user, false)
+		case streamStarred:
+			edits[streamStarred] = g.setStar(ctx, user, false)
+		}
+	}
+
+	for _, row := range rows {
+		for _, edit := range edits {
+			if err := edit(row.Post.ID); err != nil {
+				return err
+			}
+		}
+	}
+	writeText(w, "OK")
+	return nil
+}
+
+func (g *greaderServer) setRead(ctx context.Context, user database.User, read bool) func(uuid.UUID) error {
+	return func(id uuid.UUID) error {
+		return setPostRead(ctx, g.s.db, user.ID, id, read)
+	}
+}
+
+func (g *greaderServer) setStar(ctx context.Context, user database.User, star bool) func(uuid.UUID) error {
+	return func(id uuid.UUID) error {
+		return setPostStarred(ctx, g.s.db, user.ID, id, star)
+	}
+}
+
+// handleMarkAllRead marks the posts of a stream read, up to the time
+// given in microseconds by ts.
+func (g *greaderServer) handleMarkAllRead(w http.ResponseWriter, r *http.Request, user database.User) error {
+	ctx := r.Context()
+	params := database.MarkStreamReadParams{
+		UserID:    user.ID,
+		ReadAt:    time.Now().UTC(),
+		OlderThan: time.Now().UTC(),
+	}
+
+	if v := r.Form.Get("ts"); v != "" {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return apiErrorf(http.StatusBadRequest, "invalid ts %q", v)
+		}
+		params.OlderThan = time.UnixMicro(ts).UTC()
+	}
+
+	switch stream := streamUser.ReplaceAllString(r.Form.Get("s"), "user/-/"); {
+	case stream == streamReadingList:
+	case strings.HasPrefix(stream, streamFeedPrefix):
+		feed, err := g.lookupStreamFeed(ctx, stream)
+		if err != nil {
+			return err
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	default:
+		return apiErrorf(http.StatusBadRequest, "unknown stream %q", stream)
+	}
+
+	if _, err := g.s.db.MarkStreamRead(ctx, params); err != nil {
+		return err
+	}
+	writeText(w, "OK")
+	return nil
+}
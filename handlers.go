@@ -2,14 +2,10 @@ package gogator
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"log"
-	"os"
-	"os/signal"
 	"strconv"
-	"sync"
-	"sync/atomic"
-	"syscall"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,132 +16,189 @@ type handler func(*state, command) error
 type handlerLoggedIn func(*state, command, database.User) error
 
 func handlerLogin(s *state, cmd command) error {
-	if len(cmd.args) != 1 {
-		log.Printf("Usage: %s <username>\n", cmd.name)
-		return fmt.Errorf("username is required")
+	ctx := context.Background()
+	name := cmd.args[0]
+	user, err := s.db.GetUser(ctx, name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("couldn't get user: %w", err)
 	}
 
-	name := cmd.args[0]
-	_, err := s.db.GetUser(context.Background(), name)
+	// Users without a password, registered before passwords existed,
+	// can't log in until an admin sets one with "admin password".
+	password, err := readPassword("Password: ")
+	if err != nil {
+		return err
+	}
+	if err := checkPassword(user, password); err != nil {
+		return err
+	}
+
+	if err := saveSession(ctx, s, user); err != nil {
+		return err
+	}
+	s.out.noticef("User %q switched successfully!\n", name)
+	return nil
+}
+
+// saveSession starts a session for user and stores its token in the
+// config file.
+func saveSession(ctx context.Context, s *state, user database.User) error {
+	token, err := startSession(ctx, s, user)
 	if err != nil {
-		return fmt.Errorf("couldn't find user %q: %w", name, err)
+		return err
 	}
 
-	err = s.cfg.SetUser(name)
+	err = s.cfg.SetSession(user.Name, token)
 	if err != nil {
 		return fmt.Errorf("couldn't set current user: %w", err)
 	}
+	return nil
+}
+
+// setPassword prompts for a new password and sets it.
+func setPassword(ctx context.Context, s *state, cmd string, user database.User) error {
+	password, err := readNewPassword(cmd, "New password: ")
+	if err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
 
-	fmt.Printf("User %q switched successfully!\n", name)
+	err = s.db.SetUserPassword(ctx, database.SetUserPasswordParams{
+		ID:           user.ID,
+		PasswordHash: sql.NullString{String: hash, Valid: true},
+		UpdatedAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't set password: %w", err)
+	}
 	return nil
 }
 
 func handlerRegister(s *state, cmd command) error {
-	if len(cmd.args) != 1 {
-		log.Printf("Usage: %s <username>\n", cmd.name)
-		return fmt.Errorf("username is required")
+	ctx := context.Background()
+	name := cmd.args[0]
+	password, err := readNewPassword(cmd.name, "Password: ")
+	if err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
 	}
 
-	name := cmd.args[0]
-	user, err := s.db.CreateUser(
-		context.Background(),
+	user, err := s.db.CreateUser(ctx,
 		database.CreateUserParams{
-			ID:        uuid.New(),
-			CreatedAt: time.Now().UTC(),
-			UpdatedAt: time.Now().UTC(),
-			Name:      name,
+			ID:           uuid.New(),
+			CreatedAt:    time.Now().UTC(),
+			UpdatedAt:    time.Now().UTC(),
+			Name:         name,
+			PasswordHash: sql.NullString{String: hash, Valid: true},
 		})
 	if err != nil {
 		return fmt.Errorf("couldn't create user: %w", err)
 	}
 
-	err = s.cfg.SetUser(user.Name)
-	if err != nil {
-		return fmt.Errorf("couldn't set current user: %w", err)
+	if err := saveSession(ctx, s, user); err != nil {
+		return err
 	}
 
-	fmt.Printf("User %q created successfully:\n", name)
-	printUser(user)
+	s.out.noticef("User %q created successfully:\n", name)
+	l := userListing()
+	addUser(l, user, true)
+	return s.out.render(l)
+}
+
+// handlerPasswd changes the password of the current user and logs out
+// their other sessions.
+func handlerPasswd(s *state, cmd command, user database.User) error {
+	ctx := context.Background()
+	if user.PasswordHash.Valid {
+		current, err := readPassword("Current password: ")
+		if err != nil {
+			return err
+		}
+		if err := checkPassword(user, current); err != nil {
+			return err
+		}
+	}
+
+	if err := setPassword(ctx, s, cmd.name, user); err != nil {
+		return err
+	}
+	if err := s.db.DeleteUserSessions(ctx, user.ID); err != nil {
+		return fmt.Errorf("couldn't log out other sessions: %w", err)
+	}
+	if err := saveSession(ctx, s, user); err != nil {
+		return err
+	}
+
+	s.out.noticef("Password changed, other sessions were logged out.\n")
+	return nil
+}
+
+func handlerLogout(s *state, cmd command) error {
+	if s.cfg.SessionToken != "" {
+		err := s.db.DeleteSession(context.Background(), hashToken(s.cfg.SessionToken))
+		if err != nil {
+			return fmt.Errorf("couldn't delete session: %w", err)
+		}
+	}
+	if err := s.cfg.ClearSession(); err != nil {
+		return fmt.Errorf("couldn't clear current user: %w", err)
+	}
+
+	s.out.noticef("Logged out.\n")
 	return nil
 }
 
 func handlerListUsers(s *state, cmd command) error {
+	if cmd.flagBool("details") {
+		return listUserDetails(s)
+	}
+
 	users, err := s.db.GetAllUsers(context.Background())
 	if err != nil {
 		return fmt.Errorf("couldn't get all users: %w", err)
 	}
+
+	l := userListing()
 	for _, u := range users {
-		if u.Name == s.cfg.UserName {
-			fmt.Printf(" * Name:    %v (current)\n", u.Name)
-			continue
-		}
-		fmt.Printf(" * Name:    %v\n", u.Name)
+		addUser(l, u, u.Name == s.cfg.UserName)
 	}
-	return nil
+	return s.out.render(l)
 }
 
-func printUser(u database.User) {
-	fmt.Printf(" * ID:      %v\n", u.ID)
-	fmt.Printf(" * Name:    %v\n", u.Name)
-}
-
-func handlerAggregate(s *state, cmd command) error {
-	if len(cmd.args) != 1 {
-		log.Printf("Usage: %s <time>\ntime: 1ms, 1s, 1m, 1h\n", cmd.name)
-		return fmt.Errorf("time is required")
-	}
-
-	reqtime := cmd.args[0]
-	td, err := time.ParseDuration(reqtime)
+// listUserDetails lists users with what they own and when they last
+// logged in.
+func listUserDetails(s *state) error {
+	users, err := s.db.GetUsersWithDetails(context.Background())
 	if err != nil {
-		return fmt.Errorf("couldn't parse the time duration")
+		return fmt.Errorf("couldn't get all users: %w", err)
 	}
-	fmt.Printf("Collecting feeds every %s\n", td.String())
 
-	var (
-		tc atomic.Int32
-		wg sync.WaitGroup
-	)
+	l := newListing("id", "name", "created_at", "updated_at", "admin", "current",
+		"feeds", "follows", "api_tokens", "last_login_at")
+	for _, u := range users {
+		l.add(u.User.ID, u.User.Name, u.User.CreatedAt, u.User.UpdatedAt,
+			u.User.IsAdmin, u.User.Name == s.cfg.UserName, u.Feeds, u.Follows,
+			u.ApiTokens, nullTime(u.LastLoginAt))
+	}
+	return s.out.render(l)
+}
 
-	ticker := time.NewTicker(td)
-	done := make(chan struct{})
-	sigch := make(chan os.Signal, 1)
-
-	signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
-
-	wg.Go(func() {
-		for {
-			select {
-			case <-ticker.C:
-				scrapeFeeds(s)
-				tc.Add(1)
-			case <-done:
-				ticker.Stop()
-				return
-			}
-		}
-	})
+func userListing() *listing {
+	return newListing("id", "name", "created_at", "admin", "current")
+}
 
-	<-sigch
-	signal.Stop(sigch)
-	close(done)
-	wg.Wait()
-	log.Printf("[INFO] scraping ended, %d tasks processed.", tc.Load())
-	return nil
+func addUser(l *listing, u database.User, current bool) {
+	l.add(u.ID, u.Name, u.CreatedAt, u.IsAdmin, current)
 }
 
 func handlerAddFeed(s *state, cmd command, user database.User) error {
-	if len(cmd.args) == 0 {
-		log.Printf("Usage: %s <name> <url>\n", cmd.name)
-		return fmt.Errorf("feed name and url is required")
-	}
-
 	name := cmd.args[0]
-	if len(cmd.args) == 1 {
-		log.Printf("Usage: %s %s <url>\n", cmd.name, name)
-		return fmt.Errorf("url is required")
-	}
-
 	url := cmd.args[1]
 	feed, err := s.db.CreateFeed(context.Background(),
 		database.CreateFeedParams{
@@ -154,7 +207,7 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 			UpdatedAt: time.Now().UTC(),
 			Name:      name,
 			Url:       url,
-			UserID:    user.ID,
+			UserID:    uuid.NullUUID{UUID: user.ID, Valid: true},
 		})
 	if err != nil {
 		return fmt.Errorf("couldn't create feed: %w", err)
@@ -173,13 +226,17 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 		return fmt.Errorf("couldn't create feed follow: %w", err)
 	}
 
-	fmt.Println("Feed created successfully:")
-	printFeed(feed, user)
-	fmt.Println("=====================================")
-	fmt.Println("Feed follow created successfully:")
-	printCreateFeedFollow(follow)
-	fmt.Println("=====================================")
-	return nil
+	s.out.noticef("Feed created successfully:\n")
+	fl := feedListing()
+	addFeed(fl, feed, user)
+	if err := s.out.render(fl); err != nil {
+		return err
+	}
+
+	s.out.noticef("Feed follow created successfully:\n")
+	ffl := feedFollowListing()
+	addCreateFeedFollow(ffl, follow, feed.Url)
+	return s.out.render(ffl)
 }
 
 func handlerListFeeds(s *state, cmd command) error {
@@ -189,37 +246,148 @@ func handlerListFeeds(s *state, cmd command) error {
 	}
 
 	if len(feeds) == 0 {
-		fmt.Println("No feeds found.")
-		return nil
+		s.out.noticef("No feeds found.\n")
+	} else {
+		s.out.noticef("Found %d feeds:\n", len(feeds))
 	}
 
-	fmt.Printf("Found %d feeds:\n", len(feeds))
+	l := feedListing()
 	for _, feed := range feeds {
-		user, err := s.db.GetUserByID(context.Background(), feed.UserID)
-		if err != nil {
-			return fmt.Errorf("couldn't get user: %w", err)
+		var user database.User
+		if feed.UserID.Valid {
+			user, err = s.db.GetUserByID(context.Background(), feed.UserID.UUID)
+			if err != nil {
+				return fmt.Errorf("couldn't get user: %w", err)
+			}
 		}
-		printFeed(feed, user)
-		fmt.Println("=====================================")
+		addFeed(l, feed, user)
+	}
+	return s.out.render(l)
+}
+
+func feedListing() *listing {
+	return newListing("id", "created_at", "updated_at", "name", "url",
+		"user", "last_fetched_at", "last_attempted_at")
+}
+
+// addFeed adds a feed added by user, which is the zero User when the
+// feed lost its attribution.
+func addFeed(l *listing, feed database.Feed, user database.User) {
+	var name any
+	if user.ID != uuid.Nil {
+		name = user.Name
+	}
+	l.add(feed.ID, feed.CreatedAt, feed.UpdatedAt, feed.Name, feed.Url,
+		name, nullTime(feed.LastFetchedAt), nullTime(feed.LastAttemptedAt))
+}
+
+// handlerTransferFeed changes the user a feed is attributed to. Admins
+// can transfer any feed, other users the feeds they added.
+func handlerTransferFeed(s *state, cmd command, user database.User) error {
+	ctx := context.Background()
+	feed, err := resolveFeed(ctx, s.db, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	if err := checkFeedOwner(user, feed, "transfer it"); err != nil {
+		return err
+	}
+
+	to, err := getUser(ctx, s, cmd.args[1])
+	if err != nil {
+		return err
 	}
+	err = s.db.TransferFeed(ctx, database.TransferFeedParams{
+		ID:        feed.ID,
+		UserID:    uuid.NullUUID{UUID: to.ID, Valid: true},
+		UpdatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't transfer feed: %w", err)
+	}
+	s.out.noticef("Feed %q transferred to %q.\n", feed.Name, to.Name)
 	return nil
 }
 
-func printFeed(feed database.Feed, user database.User) {
-	fmt.Printf("* ID:            %s\n", feed.ID)
-	fmt.Printf("* Created:       %v\n", feed.CreatedAt)
-	fmt.Printf("* Updated:       %v\n", feed.UpdatedAt)
-	fmt.Printf("* Name:          %s\n", feed.Name)
-	fmt.Printf("* URL:           %s\n", feed.Url)
-	fmt.Printf("* User:          %s\n", user.Name)
+// checkFeedOwner lets admins and the user who added feed do what.
+func checkFeedOwner(user database.User, feed database.Feed, what string) error {
+	if !user.IsAdmin && (!feed.UserID.Valid || feed.UserID.UUID != user.ID) {
+		return fmt.Errorf("only admins and the user who added %q can %s: %w",
+			feed.Name, what, errUnauthorized)
+	}
+	return nil
 }
 
-func handlerFollow(s *state, cmd command, user database.User) error {
-	if len(cmd.args) != 1 {
-		log.Printf("Usage: %s <url>\n", cmd.name)
-		return fmt.Errorf("url is required")
+// feedFinder is the part of the database used to resolve feeds.
+type feedFinder interface {
+	GetFeedByUrl(ctx context.Context, url string) (database.Feed, error)
+	GetFeedsByName(ctx context.Context, name string) ([]database.Feed, error)
+}
+
+// resolveFeed looks a feed up by its URL, falling back to its name.
+// Names are not unique, so an ambiguous name is reported as an error.
+func resolveFeed(ctx context.Context, db feedFinder, ref string) (database.Feed, error) {
+	feed, err := db.GetFeedByUrl(ctx, ref)
+	if err == nil {
+		return feed, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.Feed{}, fmt.Errorf("couldn't get feed: %w", err)
+	}
+
+	feeds, err := db.GetFeedsByName(ctx, ref)
+	if err != nil {
+		return database.Feed{}, fmt.Errorf("couldn't get feed: %w", err)
+	}
+	switch len(feeds) {
+	case 0:
+		return database.Feed{}, fmt.Errorf("couldn't find feed %q: %w",
+			ref, errNotFound)
+	case 1:
+		return feeds[0], nil
+	default:
+		return database.Feed{}, usageErrorf("",
+			"feed name %q is ambiguous, use the feed url instead", ref)
 	}
+}
 
+// subscribe follows the feed at url, adding it first if needed, named
+// after title or its URL. Following a feed twice is not an error.
+func subscribe(ctx context.Context, s *state, user database.User,
+	url, title string,
+) (database.Feed, error) {
+	feed, err := s.db.GetFeedByUrl(ctx, url)
+	if errors.Is(err, sql.ErrNoRows) {
+		if title == "" {
+			title = url
+		}
+		feed, err = s.db.CreateFeed(ctx, database.CreateFeedParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now().UTC(),
+			UpdatedAt: time.Now().UTC(),
+			Name:      title,
+			Url:       url,
+			UserID:    uuid.NullUUID{UUID: user.ID, Valid: true},
+		})
+	}
+	if err != nil {
+		return database.Feed{}, err
+	}
+
+	_, err = s.db.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+	})
+	if isUniqueViolation(err) {
+		err = nil
+	}
+	return feed, err
+}
+
+func handlerFollow(s *state, cmd command, user database.User) error {
 	url := cmd.args[0]
 	feed, err := s.db.GetFeedByUrl(context.Background(), url)
 	if err != nil {
@@ -238,10 +406,10 @@ func handlerFollow(s *state, cmd command, user database.User) error {
 	if err != nil {
 		return fmt.Errorf("couldn't create feed follow: %w", err)
 	}
-	fmt.Println("Feed follow created successfully:")
-	printCreateFeedFollow(follow)
-	fmt.Println("=====================================")
-	return nil
+	s.out.noticef("Feed follow created successfully:\n")
+	l := feedFollowListing()
+	addCreateFeedFollow(l, follow, feed.Url)
+	return s.out.render(l)
 }
 
 func handlerGetFollows(s *state, cmd command, user database.User) error {
@@ -251,24 +419,19 @@ func handlerGetFollows(s *state, cmd command, user database.User) error {
 	}
 
 	if len(follows) == 0 {
-		fmt.Println("No feed follows found.")
-		return nil
+		s.out.noticef("No feed follows found.\n")
+	} else {
+		s.out.noticef("Found %d feed follows:\n", len(follows))
 	}
 
-	fmt.Printf("Found %d feed follows:\n", len(follows))
-	for _, feed := range follows {
-		printGetFeedFollows(feed)
-		fmt.Println("=====================================")
+	l := feedFollowListing()
+	for _, ffw := range follows {
+		addGetFeedFollow(l, ffw)
 	}
-	return nil
+	return s.out.render(l)
 }
 
 func handlerUnfollow(s *state, cmd command, user database.User) error {
-	if len(cmd.args) != 1 {
-		log.Printf("Usage: %s <url>\n", cmd.name)
-		return fmt.Errorf("url is required")
-	}
-
 	url := cmd.args[0]
 	feed, err := s.db.GetFeedByUrl(context.Background(), url)
 	if err != nil {
@@ -284,75 +447,128 @@ func handlerUnfollow(s *state, cmd command, user database.User) error {
 		return fmt.Errorf("couldn't delete feed: %w", err)
 	}
 
-	fmt.Printf("%q feed unfollowed successfully!\n", feed.Name)
+	s.out.noticef("%q feed unfollowed successfully!\n", feed.Name)
 	return nil
 }
 
-func printCreateFeedFollow(ffw database.CreateFeedFollowRow) {
-	printFeedFollows(
-		ffw.ID, ffw.FeedID, ffw.UserID,
-		ffw.CreatedAt, ffw.UpdatedAt,
-		ffw.FeedName, ffw.UserName,
-	)
+func feedFollowListing() *listing {
+	return newListing("id", "created_at", "updated_at", "user_id",
+		"feed_id", "feed_name", "feed_url", "user_name")
 }
 
-func printGetFeedFollows(ffwu database.GetFeedFollowsForUserRow) {
-	printFeedFollows(
-		ffwu.ID, ffwu.FeedID, ffwu.UserID,
-		ffwu.CreatedAt, ffwu.UpdatedAt,
-		ffwu.FeedName, ffwu.UserName,
-	)
+func addCreateFeedFollow(l *listing, ffw database.CreateFeedFollowRow, url string) {
+	l.add(ffw.ID, ffw.CreatedAt, ffw.UpdatedAt, ffw.UserID,
+		ffw.FeedID, ffw.FeedName, url, ffw.UserName)
 }
 
-func printFeedFollows(id, fid, uid uuid.UUID, ca, ua time.Time, fname, uname string) {
-	fmt.Printf("* ID:            %s\n", id)
-	fmt.Printf("* Created:       %v\n", ca)
-	fmt.Printf("* Updated:       %v\n", ua)
-	fmt.Printf("* UserID:        %v\n", uid)
-	fmt.Printf("* FeedID:        %v\n", fid)
-	fmt.Printf("* FeedName:      %s\n", fname)
-	fmt.Printf("* UserName:      %s\n", uname)
+func addGetFeedFollow(l *listing, ffwu database.GetFeedFollowsForUserRow) {
+	l.add(ffwu.ID, ffwu.CreatedAt, ffwu.UpdatedAt, ffwu.UserID,
+		ffwu.FeedID, ffwu.FeedName, ffwu.FeedUrl, ffwu.UserName)
 }
 
 func handlerBrowse(s *state, cmd command) error {
-	limit := "2"
+	f := postFilter{
+		limit:  cmd.flagInt("limit"),
+		before: cmd.flagString("before"),
+		after:  cmd.flagString("after"),
+		feed:   cmd.flagString("feed"),
+		since:  cmd.flagString("since"),
+		order:  cmd.flagString("order"),
+	}
+
+	// The limit used to be a positional argument, keep accepting it.
 	if len(cmd.args) == 1 {
-		limit = cmd.args[0]
+		n, err := strconv.Atoi(cmd.args[0])
+		if err != nil {
+			return usageErrorf(cmd.name, "couldn't parse limit count %q", cmd.args[0])
+		}
+		f.limit = n
 	}
 
-	n, err := strconv.Atoi(limit)
-	if err != nil {
-		return fmt.Errorf("couldn't parse limit count")
+	if _, err := f.params(); err != nil {
+		return usageErrorf(cmd.name, "%v", err)
 	}
 
-	posts, err := s.db.GetPosts(context.Background(), int32(n))
+	posts, err := queryPosts(context.Background(), s.db, f)
 	if err != nil {
-		return fmt.Errorf("couldn't get the posts: %w", err)
+		return err
 	}
 
-	fmt.Printf("Found %d posts:\n", len(posts))
+	s.out.noticef("Found %d posts:\n", len(posts))
+	l := postListing()
 	for _, p := range posts {
-		printPost(p)
-		fmt.Println("=====================================")
+		addPost(l, p)
+	}
+	if err := s.out.render(l); err != nil {
+		return err
+	}
+
+	if len(posts) == 0 {
+		return nil
+	}
+
+	next, prev := pageCursors(posts)
+	if f.order == "newest" {
+		s.out.noticef("Next page:     --before %s\n", next)
+		s.out.noticef("Previous page: --after %s\n", prev)
+	} else {
+		s.out.noticef("Next page:     --after %s\n", next)
+		s.out.noticef("Previous page: --before %s\n", prev)
 	}
 	return nil
 }
 
-func printPost(p database.Post) {
-	fmt.Printf("* ID:            %s\n", p.ID)
-	fmt.Printf("* Created:       %v\n", p.CreatedAt)
-	fmt.Printf("* Updated:       %v\n", p.UpdatedAt)
-	fmt.Printf("* Title:         %s\n", p.Title)
-	fmt.Printf("* URL:           %s\n", p.Url)
-	fmt.Printf("* Desc:          %s\n", p.Description.String)
-	fmt.Printf("* PubDate:       %v\n", p.PublishedAt.Time)
-	fmt.Printf("* FeedID:        %v\n", p.FeedID)
+func postListing() *listing {
+	return newListing("id", "created_at", "updated_at", "title", "url",
+		"description", "published_at", "feed_id", "cursor")
 }
 
-func handlerReset(s *state, cmd command) error {
-	if err := s.db.DeleteAllUsers(context.Background()); err != nil {
-		return fmt.Errorf("couldn't delete users: %w", err)
+func addPost(l *listing, p database.Post) {
+	l.add(p.ID, p.CreatedAt, p.UpdatedAt, p.Title, p.Url,
+		nullString(p.Description), nullTime(p.PublishedAt), p.FeedID,
+		postCursor(p).String())
+}
+
+func handlerReset(s *state, cmd command, _ database.User) error {
+	ctx := context.Background()
+	if cmd.flagBool("dry-run") {
+		c, err := s.db.CountAllRows(ctx)
+		if err != nil {
+			return fmt.Errorf("couldn't count rows: %w", err)
+		}
+
+		s.out.noticef("Dry run, reset would delete:\n")
+		l := rowCounts()
+		l.add("users", c.Users)
+		l.add("feeds", c.Feeds)
+		l.add("feed_credentials", c.FeedCredentials)
+		l.add("feed_follows", c.FeedFollows)
+		l.add("posts", c.Posts)
+		l.add("post_reads", c.PostReads)
+		l.add("post_stars", c.PostStars)
+		l.add("published_feeds", c.PublishedFeeds)
+		l.add("api_tokens", c.ApiTokens)
+		l.add("sessions", c.Sessions)
+		return s.out.render(l)
+	}
+
+	err := confirm(cmd, "Delete every user, feed, follow and post?")
+	if err != nil {
+		return err
+	}
+	// Feeds outlive their users, so they are deleted too.
+	err = s.inTx(ctx, func(q *database.Queries) error {
+		if err := q.DeleteAllUsers(ctx); err != nil {
+			return fmt.Errorf("couldn't delete users: %w", err)
+		}
+		if err := q.DeleteAllFeeds(ctx); err != nil {
+			return fmt.Errorf("couldn't delete feeds: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	fmt.Println("Database reset successfully!")
+	s.out.noticef("Database reset successfully!\n")
 	return nil
 }
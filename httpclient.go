@@ -0,0 +1,296 @@
+package gogator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prchop/gogator/internal/config"
+)
+
+// defaultContactURL is put in the user agent when the config file sets
+// no contact_url.
+const defaultContactURL = "https://github.com/prchop/gogator"
+
+// The settings of the client when the config file sets none. The total
+// timeout leaves room for the wait for the host within fetchTimeout.
+var defaultClientSettings = clientSettings{
+	connectTimeout: 10 * time.Second,
+	readTimeout:    15 * time.Second,
+	timeout:        20 * time.Second,
+	maxBodySize:    10 << 20,
+}
+
+// errReadTimeout is returned when a server stops sending the response
+// for longer than the read timeout.
+var errReadTimeout = errors.New("read timeout")
+
+// clientSettings are the parsed config.HTTPClient. Feeds with the same
+// settings share a client, and so its connections.
+type clientSettings struct {
+	proxy          string
+	caFile         string
+	insecure       bool
+	connectTimeout time.Duration
+	readTimeout    time.Duration
+	timeout        time.Duration
+	userAgent      string
+	disableHTTP2   bool
+	maxBodySize    int64
+}
+
+// parseClientSettings parses c, taking what it doesn't set from def.
+func parseClientSettings(c config.HTTPClient, def clientSettings) (clientSettings, error) {
+	cs := def
+	if c.Proxy != "" {
+		if _, err := proxyFunc(c.Proxy); err != nil {
+			return clientSettings{}, err
+		}
+		cs.proxy = c.Proxy
+	}
+	if c.CAFile != "" {
+		cs.caFile = c.CAFile
+	}
+	cs.insecure = cs.insecure || c.InsecureSkipVerify
+	cs.disableHTTP2 = cs.disableHTTP2 || c.DisableHTTP2
+	if c.UserAgent != "" {
+		cs.userAgent = c.UserAgent
+	}
+	switch {
+	case c.MaxBodySize < 0:
+		return clientSettings{}, fmt.Errorf("max_body_size %d is negative", c.MaxBodySize)
+	case c.MaxBodySize > 0:
+		cs.maxBodySize = c.MaxBodySize
+	}
+
+	for _, t := range []struct {
+		name  string
+		value string
+		d     *time.Duration
+	}{
+		{"connect_timeout", c.ConnectTimeout, &cs.connectTimeout},
+		{"read_timeout", c.ReadTimeout, &cs.readTimeout},
+		{"timeout", c.Timeout, &cs.timeout},
+	} {
+		if t.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(t.value)
+		if err != nil || d <= 0 {
+			return clientSettings{}, fmt.Errorf("invalid %s %q", t.name, t.value)
+		}
+		*t.d = d
+	}
+	return cs, nil
+}
+
+// proxyFunc returns the proxy of the transport for the proxy setting.
+func proxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	switch proxy {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case "direct":
+		return nil, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q", proxy)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected one of: "+
+			"http, https, socks5", u.Scheme)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// defaultUserAgent tells the owners of the feeds what fetches them and
+// how to reach whoever runs it.
+func defaultUserAgent(contactURL string) string {
+	name := "gogator"
+	if bi, ok := debug.ReadBuildInfo(); ok &&
+		bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		name += "/" + bi.Main.Version
+	}
+	return fmt.Sprintf("%s (feed aggregator; +%s)", name,
+		orDefault(contactURL, defaultContactURL))
+}
+
+// httpClients hands out the clients of the feeds, shared by the feeds
+// with the same settings so that their connections are reused.
+type httpClients struct {
+	mu       sync.Mutex
+	global   clientSettings
+	feeds    map[string]clientSettings
+	insecure map[string]bool
+	// pools are the certificates trusted with each CA file.
+	pools   map[string]*x509.CertPool
+	clients map[clientSettings]*http.Client
+}
+
+func newHTTPClients(cfg *config.HTTP) (*httpClients, error) {
+	h := &httpClients{}
+	if err := h.configure(cfg); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// configure sets the settings from the config file. The clients of the
+// previous settings are dropped once their requests are done.
+func (h *httpClients) configure(cfg *config.HTTP) error {
+	if cfg == nil {
+		cfg = &config.HTTP{}
+	}
+	def := defaultClientSettings
+	def.userAgent = defaultUserAgent(cfg.ContactURL)
+	global, err := parseClientSettings(cfg.HTTPClient, def)
+	if err != nil {
+		return fmt.Errorf("error in config: http: %w", err)
+	}
+
+	feeds := make(map[string]clientSettings, len(cfg.Feeds))
+	pools := make(map[string]*x509.CertPool)
+	if err := loadCAFile(pools, global.caFile); err != nil {
+		return fmt.Errorf("error in config: http: %w", err)
+	}
+	for u, c := range cfg.Feeds {
+		cs, err := parseClientSettings(c, global)
+		if err != nil {
+			return fmt.Errorf("error in config: http of %s: %w", u, err)
+		}
+		if err := loadCAFile(pools, cs.caFile); err != nil {
+			return fmt.Errorf("error in config: http of %s: %w", u, err)
+		}
+		feeds[u] = cs
+	}
+	insecure := make(map[string]bool, len(cfg.InsecureHosts))
+	for _, host := range cfg.InsecureHosts {
+		insecure[strings.ToLower(host)] = true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range h.clients {
+		c.CloseIdleConnections()
+	}
+	h.global = global
+	h.feeds = feeds
+	h.insecure = insecure
+	h.pools = pools
+	h.clients = make(map[clientSettings]*http.Client)
+	return nil
+}
+
+// loadCAFile adds the certificates of file to those of the system.
+func loadCAFile(pools map[string]*x509.CertPool, file string) error {
+	if file == "" || pools[file] != nil {
+		return nil
+	}
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("couldn't read CA file: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificate found in %s", file)
+	}
+	pools[file] = pool
+	return nil
+}
+
+// client returns the client of feedURL and its settings.
+func (h *httpClients) client(feedURL string) (*http.Client, clientSettings) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cs, ok := h.feeds[feedURL]
+	if !ok {
+		cs = h.global
+	}
+	if u, err := url.Parse(feedURL); err == nil && h.insecure[strings.ToLower(u.Hostname())] {
+		cs.insecure = true
+	}
+
+	c, ok := h.clients[cs]
+	if !ok {
+		c = h.newClient(cs)
+		h.clients[cs] = c
+	}
+	return c, cs
+}
+
+func (h *httpClients) newClient(cs clientSettings) *http.Client {
+	// The proxy was checked by parseClientSettings.
+	proxy, _ := proxyFunc(cs.proxy)
+	dialer := &net.Dialer{Timeout: cs.connectTimeout, KeepAlive: 30 * time.Second}
+
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(!cs.disableHTTP2)
+
+	return &http.Client{
+		Timeout:       cs.timeout,
+		CheckRedirect: checkRedirect,
+		Transport: &http.Transport{
+			Proxy:       proxy,
+			DialContext: dialer.DialContext,
+			TLSClientConfig: &tls.Config{
+				RootCAs:            h.pools[cs.caFile],
+				InsecureSkipVerify: cs.insecure,
+			},
+			TLSHandshakeTimeout:   cs.connectTimeout,
+			ResponseHeaderTimeout: cs.readTimeout,
+			Protocols:             protocols,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   4,
+			IdleConnTimeout:       90 * time.Second,
+		},
+	}
+}
+
+// idleReader calls timeout when the server sends nothing for d, which
+// the transport only bounds until the headers.
+type idleReader struct {
+	r io.Reader
+	t *time.Timer
+	d time.Duration
+}
+
+func newIdleReader(r io.Reader, d time.Duration, timeout func()) *idleReader {
+	return &idleReader{r: r, t: time.AfterFunc(d, timeout), d: d}
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.t.Reset(r.d)
+	return n, err
+}
+
+func (r *idleReader) stop() {
+	r.t.Stop()
+}
+
+// readTimeoutCause returns errReadTimeout when it is why ctx ended, and
+// err otherwise.
+func readTimeoutCause(ctx context.Context, err error, d time.Duration) error {
+	if errors.Is(context.Cause(ctx), errReadTimeout) {
+		return fmt.Errorf("%w: nothing received for %s", errReadTimeout, d)
+	}
+	return err
+}
@@ -10,15 +10,87 @@ const configFileName = ".gogatorconfig.json"
 
 // Settings is the default config
 type Settings struct {
-	DBURL    string `json:"db_url"`
-	UserName string `json:"current_user_name"`
+	DBURL        string `json:"db_url"`
+	UserName     string `json:"current_user_name"`
+	SessionToken string `json:"session_token,omitempty"`
+	LogLevel     string `json:"log_level,omitempty"`
+	LogFormat    string `json:"log_format,omitempty"`
+	// TraceExporter is otlp or stderr, tracing is disabled when empty.
+	TraceExporter string `json:"trace_exporter,omitempty"`
+	TraceEndpoint string `json:"trace_endpoint,omitempty"`
+	// Politeness limits the requests made to each host.
+	Politeness *Politeness `json:"politeness,omitempty"`
+	// CredentialsKey is the base64 key encrypting the credentials of
+	// the feeds, unless $GOGATOR_CREDENTIALS_KEY is set.
+	CredentialsKey string `json:"credentials_key,omitempty"`
+	// HTTP configures the client fetching the feeds.
+	HTTP *HTTP `json:"http,omitempty"`
 }
 
-func (cfg *Settings) SetUser(name string) error {
+// HTTP holds the settings of the client fetching the feeds, which the
+// entries of Feeds override for a feed URL.
+type HTTP struct {
+	HTTPClient
+	// ContactURL is put in the default user agent, so that the owners
+	// of the feeds can reach whoever runs gogator.
+	ContactURL string `json:"contact_url,omitempty"`
+	// InsecureHosts are the hosts whose certificates aren't verified.
+	InsecureHosts []string              `json:"insecure_hosts,omitempty"`
+	Feeds         map[string]HTTPClient `json:"feeds,omitempty"`
+}
+
+// HTTPClient are the settings that a feed may override. Empty values
+// are inherited from the global settings, then from the defaults.
+type HTTPClient struct {
+	// Proxy is the URL of an http, https or socks5 proxy, or "direct"
+	// for none. The HTTPS_PROXY and related variables apply by default.
+	Proxy string `json:"proxy,omitempty"`
+	// CAFile is a PEM bundle of certificates trusted along with those
+	// of the system.
+	CAFile             string `json:"ca_file,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+	// The timeouts are durations such as "10s".
+	ConnectTimeout string `json:"connect_timeout,omitempty"`
+	ReadTimeout    string `json:"read_timeout,omitempty"`
+	Timeout        string `json:"timeout,omitempty"`
+	UserAgent      string `json:"user_agent,omitempty"`
+	DisableHTTP2   bool   `json:"disable_http2,omitempty"`
+	// MaxBodySize is the largest response accepted, in bytes once
+	// decompressed.
+	MaxBodySize int64 `json:"max_body_size,omitempty"`
+}
+
+// Politeness holds the limits of every host, which the entries of
+// Domains override for the hosts of a domain.
+type Politeness struct {
+	HostLimits
+	Domains map[string]HostLimits `json:"domains,omitempty"`
+}
+
+// HostLimits are the limits of a host. Zero values are inherited from
+// the global limits, then from the defaults.
+type HostLimits struct {
+	// Rate is the number of requests per second, Burst how many may be
+	// made at once.
+	Rate           float64 `json:"rate,omitempty"`
+	Burst          int     `json:"burst,omitempty"`
+	MaxConcurrency int     `json:"max_concurrency,omitempty"`
+	// MinInterval is a duration such as "2s" between two requests.
+	MinInterval string `json:"min_interval,omitempty"`
+}
+
+// SetSession records the logged in user and their session token.
+func (cfg *Settings) SetSession(name, token string) error {
 	cfg.UserName = name
+	cfg.SessionToken = token
 	return write(*cfg)
 }
 
+// ClearSession forgets the logged in user.
+func (cfg *Settings) ClearSession() error {
+	return cfg.SetSession("", "")
+}
+
 // Read config file
 func Read() (Settings, error) {
 	fpath, err := getConfigFilePath()
@@ -54,12 +126,17 @@ func write(cfg Settings) error {
 		return err
 	}
 
-	f, err := os.Create(fpath)
+	// The file holds a session token, keep it private.
+	f, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
+	if err := f.Chmod(0o600); err != nil {
+		return err
+	}
+
 	if err := json.NewEncoder(f).Encode(cfg); err != nil {
 		return err
 	}
@@ -0,0 +1,173 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: api_tokens.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createAPIToken = `-- name: CreateAPIToken :one
+INSERT INTO api_tokens (id, created_at, user_id, name, token_hash, scope, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at, user_id, name, token_hash, scope, expires_at, last_used_at
+`
+
+type CreateAPITokenParams struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Name      string
+	TokenHash string
+	Scope     string
+	ExpiresAt sql.NullTime
+}
+
+func (q *Queries) CreateAPIToken(ctx context.Context, arg CreateAPITokenParams) (ApiToken, error) {
+	row := q.db.QueryRowContext(ctx, createAPIToken,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UserID,
+		arg.Name,
+		arg.TokenHash,
+		arg.Scope,
+		arg.ExpiresAt,
+	)
+	var i ApiToken
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		&i.Scope,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const deleteAPIToken = `-- name: DeleteAPIToken :execrows
+DELETE FROM api_tokens
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteAPITokenParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) DeleteAPIToken(ctx context.Context, arg DeleteAPITokenParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteAPIToken, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getAPIToken = `-- name: GetAPIToken :one
+SELECT users.id, users.created_at, users.updated_at, users.name, users.fever_api_key, users.password_hash, users.is_admin, api_tokens.id, api_tokens.created_at, api_tokens.user_id, api_tokens.name, api_tokens.token_hash, api_tokens.scope, api_tokens.expires_at, api_tokens.last_used_at
+FROM api_tokens
+INNER JOIN users
+ON users.id = api_tokens.user_id
+WHERE api_tokens.token_hash = $1
+AND (api_tokens.expires_at IS NULL
+  OR api_tokens.expires_at > $2::timestamp)
+`
+
+type GetAPITokenParams struct {
+	TokenHash string
+	Now       time.Time
+}
+
+type GetAPITokenRow struct {
+	User     User
+	ApiToken ApiToken
+}
+
+func (q *Queries) GetAPIToken(ctx context.Context, arg GetAPITokenParams) (GetAPITokenRow, error) {
+	row := q.db.QueryRowContext(ctx, getAPIToken, arg.TokenHash, arg.Now)
+	var i GetAPITokenRow
+	err := row.Scan(
+		&i.User.ID,
+		&i.User.CreatedAt,
+		&i.User.UpdatedAt,
+		&i.User.Name,
+		&i.User.FeverApiKey,
+		&i.User.PasswordHash,
+		&i.User.IsAdmin,
+		&i.ApiToken.ID,
+		&i.ApiToken.CreatedAt,
+		&i.ApiToken.UserID,
+		&i.ApiToken.Name,
+		&i.ApiToken.TokenHash,
+		&i.ApiToken.Scope,
+		&i.ApiToken.ExpiresAt,
+		&i.ApiToken.LastUsedAt,
+	)
+	return i, err
+}
+
+const getAPITokensForUser = `-- name: GetAPITokensForUser :many
+SELECT id, created_at, user_id, name, token_hash, scope, expires_at, last_used_at FROM api_tokens
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetAPITokensForUser(ctx context.Context, userID uuid.UUID) ([]ApiToken, error) {
+	rows, err := q.db.QueryContext(ctx, getAPITokensForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ApiToken
+	for rows.Next() {
+		var i ApiToken
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.Name,
+			&i.TokenHash,
+			&i.Scope,
+			&i.ExpiresAt,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const touchAPIToken = `-- name: TouchAPIToken :exec
+UPDATE api_tokens
+SET last_used_at = $2::timestamp
+WHERE id = $1
+AND (last_used_at IS NULL
+  OR last_used_at < $2::timestamp - INTERVAL '1 minute')
+`
+
+type TouchAPITokenParams struct {
+	ID     uuid.UUID
+	UsedAt time.Time
+}
+
+// Last use is recorded with a minute's precision to spare a write per
+// request.
+func (q *Queries) TouchAPIToken(ctx context.Context, arg TouchAPITokenParams) error {
+	_, err := q.db.ExecContext(ctx, touchAPIToken, arg.ID, arg.UsedAt)
+	return err
+}
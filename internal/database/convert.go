@@ -2,7 +2,6 @@ package database
 
 import (
 	"database/sql"
-	"log"
 	"time"
 )
 
@@ -16,6 +15,8 @@ func ToNullString(s string) sql.NullString {
 	}
 }
 
+// ToNullTime parses the date of a feed item, which is null when it is
+// empty or in none of the formats feeds commonly use.
 func ToNullTime(s string) sql.NullTime {
 	if s == "" {
 		return sql.NullTime{Valid: false}
@@ -41,7 +42,6 @@ func ToNullTime(s string) sql.NullTime {
 	}
 
 	if err != nil {
-		log.Printf("couldn't parse time %q: %v", s, err)
 		return sql.NullTime{Valid: false}
 	}
 
@@ -0,0 +1,128 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: feed_credentials.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const deleteFeedCredentials = `-- name: DeleteFeedCredentials :execrows
+DELETE FROM feed_credentials
+WHERE feed_id = $1
+`
+
+func (q *Queries) DeleteFeedCredentials(ctx context.Context, feedID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteFeedCredentials, feedID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getFeedCredentials = `-- name: GetFeedCredentials :one
+SELECT feed_id, created_at, updated_at, kinds, secret FROM feed_credentials
+WHERE feed_id = $1
+`
+
+func (q *Queries) GetFeedCredentials(ctx context.Context, feedID uuid.UUID) (FeedCredential, error) {
+	row := q.db.QueryRowContext(ctx, getFeedCredentials, feedID)
+	var i FeedCredential
+	err := row.Scan(
+		&i.FeedID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Kinds,
+		&i.Secret,
+	)
+	return i, err
+}
+
+const getFeedsWithCredentials = `-- name: GetFeedsWithCredentials :many
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.seq, feeds.orphaned_at, feeds.last_attempted_at, feed_credentials.kinds, feed_credentials.updated_at AS credentials_updated_at
+FROM feed_credentials
+INNER JOIN feeds
+ON feeds.id = feed_credentials.feed_id
+WHERE $1::boolean
+OR feeds.user_id = $2::uuid
+ORDER BY feeds.name
+`
+
+type GetFeedsWithCredentialsParams struct {
+	All    bool
+	UserID uuid.UUID
+}
+
+type GetFeedsWithCredentialsRow struct {
+	Feed                 Feed
+	Kinds                string
+	CredentialsUpdatedAt time.Time
+}
+
+// Feeds whose credentials the user can change, every feed for admins.
+func (q *Queries) GetFeedsWithCredentials(ctx context.Context, arg GetFeedsWithCredentialsParams) ([]GetFeedsWithCredentialsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedsWithCredentials, arg.All, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFeedsWithCredentialsRow
+	for rows.Next() {
+		var i GetFeedsWithCredentialsRow
+		if err := rows.Scan(
+			&i.Feed.ID,
+			&i.Feed.CreatedAt,
+			&i.Feed.UpdatedAt,
+			&i.Feed.Name,
+			&i.Feed.Url,
+			&i.Feed.UserID,
+			&i.Feed.LastFetchedAt,
+			&i.Feed.Seq,
+			&i.Feed.OrphanedAt,
+			&i.Feed.LastAttemptedAt,
+			&i.Kinds,
+			&i.CredentialsUpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setFeedCredentials = `-- name: SetFeedCredentials :exec
+INSERT INTO feed_credentials (feed_id, created_at, updated_at, kinds, secret)
+VALUES ($1, $2, $2, $3, $4)
+ON CONFLICT (feed_id) DO UPDATE
+SET updated_at = EXCLUDED.updated_at,
+  kinds = EXCLUDED.kinds,
+  secret = EXCLUDED.secret
+`
+
+type SetFeedCredentialsParams struct {
+	FeedID    uuid.UUID
+	CreatedAt time.Time
+	Kinds     string
+	Secret    []byte
+}
+
+func (q *Queries) SetFeedCredentials(ctx context.Context, arg SetFeedCredentialsParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedCredentials,
+		arg.FeedID,
+		arg.CreatedAt,
+		arg.Kinds,
+		arg.Secret,
+	)
+	return err
+}
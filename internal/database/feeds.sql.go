@@ -7,11 +7,44 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const clearAdoptedFeeds = `-- name: ClearAdoptedFeeds :execrows
+UPDATE feeds SET orphaned_at = NULL
+WHERE orphaned_at IS NOT NULL
+AND EXISTS (SELECT 1 FROM feed_follows ff WHERE ff.feed_id = feeds.id)
+`
+
+// Ends the grace period of orphaned feeds that were followed again.
+func (q *Queries) ClearAdoptedFeeds(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, clearAdoptedFeeds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const countDueFeeds = `-- name: CountDueFeeds :one
+SELECT count(*) FROM feeds
+WHERE orphaned_at IS NULL
+AND (last_attempted_at IS NULL
+  OR last_attempted_at < $1::timestamp)
+`
+
+// Feeds not attempted since due_before are due, as are those never
+// attempted.
+func (q *Queries) CountDueFeeds(ctx context.Context, dueBefore time.Time) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countDueFeeds, dueBefore)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds (
   id,
@@ -22,7 +55,7 @@ INSERT INTO feeds (
   user_id
 )
 VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, seq, orphaned_at, last_attempted_at
 `
 
 type CreateFeedParams struct {
@@ -31,7 +64,7 @@ type CreateFeedParams struct {
 	UpdatedAt time.Time
 	Name      string
 	Url       string
-	UserID    uuid.UUID
+	UserID    uuid.NullUUID
 }
 
 func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error) {
@@ -52,10 +85,36 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Seq,
+		&i.OrphanedAt,
+		&i.LastAttemptedAt,
 	)
 	return i, err
 }
 
+const deleteAllFeeds = `-- name: DeleteAllFeeds :exec
+DELETE FROM feeds
+`
+
+func (q *Queries) DeleteAllFeeds(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteAllFeeds)
+	return err
+}
+
+const deleteOrphanedFeeds = `-- name: DeleteOrphanedFeeds :execrows
+DELETE FROM feeds
+WHERE orphaned_at < $1::timestamp
+AND NOT EXISTS (SELECT 1 FROM feed_follows ff WHERE ff.feed_id = feeds.id)
+`
+
+func (q *Queries) DeleteOrphanedFeeds(ctx context.Context, orphanedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteOrphanedFeeds, orphanedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getAllFeeds = `-- name: GetAllFeeds :many
 SELECT
   COALESCE(feeds.name, '') AS name,
@@ -95,8 +154,52 @@ func (q *Queries) GetAllFeeds(ctx context.Context) ([]GetAllFeedsRow, error) {
 	return items, nil
 }
 
+const getFeedByID = `-- name: GetFeedByID :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, seq, orphaned_at, last_attempted_at FROM feeds WHERE id = $1
+`
+
+func (q *Queries) GetFeedByID(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByID, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Seq,
+		&i.OrphanedAt,
+		&i.LastAttemptedAt,
+	)
+	return i, err
+}
+
+const getFeedBySeq = `-- name: GetFeedBySeq :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, seq, orphaned_at, last_attempted_at FROM feeds WHERE seq = $1
+`
+
+func (q *Queries) GetFeedBySeq(ctx context.Context, seq int64) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedBySeq, seq)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Seq,
+		&i.OrphanedAt,
+		&i.LastAttemptedAt,
+	)
+	return i, err
+}
+
 const getFeedByUrl = `-- name: GetFeedByUrl :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds WHERE url = $1
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, seq, orphaned_at, last_attempted_at FROM feeds WHERE url = $1
 `
 
 func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
@@ -110,12 +213,15 @@ func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Seq,
+		&i.OrphanedAt,
+		&i.LastAttemptedAt,
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, seq, orphaned_at, last_attempted_at FROM feeds
 `
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
@@ -135,6 +241,47 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Seq,
+			&i.OrphanedAt,
+			&i.LastAttemptedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFeedsByName = `-- name: GetFeedsByName :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, seq, orphaned_at, last_attempted_at FROM feeds WHERE name = $1
+`
+
+func (q *Queries) GetFeedsByName(ctx context.Context, name string) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedsByName, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Seq,
+			&i.OrphanedAt,
+			&i.LastAttemptedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -150,13 +297,17 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 }
 
 const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at NULLS FIRST
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, seq, orphaned_at, last_attempted_at FROM feeds
+WHERE orphaned_at IS NULL
+AND id <> ALL($1::uuid[])
+ORDER BY last_attempted_at NULLS FIRST
 LIMIT 1
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
+// Feeds are fetched in turn, so one that keeps failing doesn't hold up
+// the others. Feeds being fetched are skipped.
+func (q *Queries) GetNextFeedToFetch(ctx context.Context, fetching []uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getNextFeedToFetch, pq.Array(fetching))
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -166,24 +317,217 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Seq,
+		&i.OrphanedAt,
+		&i.LastAttemptedAt,
 	)
 	return i, err
 }
 
+const getOrphanedFeeds = `-- name: GetOrphanedFeeds :many
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.seq, feeds.orphaned_at, feeds.last_attempted_at,
+  (SELECT count(*) FROM posts WHERE posts.feed_id = feeds.id) AS posts
+FROM feeds
+WHERE orphaned_at < $1::timestamp
+ORDER BY orphaned_at
+`
+
+type GetOrphanedFeedsRow struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Name            string
+	Url             string
+	UserID          uuid.NullUUID
+	LastFetchedAt   sql.NullTime
+	Seq             int64
+	OrphanedAt      sql.NullTime
+	LastAttemptedAt sql.NullTime
+	Posts           int64
+}
+
+func (q *Queries) GetOrphanedFeeds(ctx context.Context, orphanedBefore time.Time) ([]GetOrphanedFeedsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getOrphanedFeeds, orphanedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetOrphanedFeedsRow
+	for rows.Next() {
+		var i GetOrphanedFeedsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Seq,
+			&i.OrphanedAt,
+			&i.LastAttemptedAt,
+			&i.Posts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getStaleFeeds = `-- name: GetStaleFeeds :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, seq, orphaned_at, last_attempted_at FROM feeds
+WHERE orphaned_at IS NULL
+AND (last_fetched_at IS NULL
+  OR last_fetched_at < $1::timestamp)
+ORDER BY last_fetched_at NULLS FIRST
+`
+
+// Returns the followed feeds not successfully fetched since a time,
+// least recently fetched first.
+func (q *Queries) GetStaleFeeds(ctx context.Context, fetchedBefore time.Time) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getStaleFeeds, fetchedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Seq,
+			&i.OrphanedAt,
+			&i.LastAttemptedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnorphanedFeeds = `-- name: GetUnorphanedFeeds :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, seq, orphaned_at, last_attempted_at FROM feeds
+WHERE orphaned_at IS NULL
+ORDER BY last_fetched_at NULLS FIRST
+`
+
+// Returns the feeds not waiting to be collected by gc, least recently
+// fetched first.
+func (q *Queries) GetUnorphanedFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getUnorphanedFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Seq,
+			&i.OrphanedAt,
+			&i.LastAttemptedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markFeedAttempted = `-- name: MarkFeedAttempted :exec
+UPDATE feeds SET last_attempted_at = $2::timestamp
+WHERE id = $1
+`
+
+type MarkFeedAttemptedParams struct {
+	ID          uuid.UUID
+	AttemptedAt time.Time
+}
+
+func (q *Queries) MarkFeedAttempted(ctx context.Context, arg MarkFeedAttemptedParams) error {
+	_, err := q.db.ExecContext(ctx, markFeedAttempted, arg.ID, arg.AttemptedAt)
+	return err
+}
+
 const markFeedFetched = `-- name: MarkFeedFetched :exec
-UPDATE feeds SET (
-  updated_at,
-  last_fetched_at
-) = ($1, NOW())
-WHERE user_id = $2
+UPDATE feeds
+SET updated_at = $2::timestamp,
+  last_fetched_at = $2::timestamp,
+  last_attempted_at = $3::timestamp
+WHERE id = $1
 `
 
 type MarkFeedFetchedParams struct {
-	UpdatedAt time.Time
-	UserID    uuid.UUID
+	ID          uuid.UUID
+	FetchedAt   time.Time
+	AttemptedAt time.Time
 }
 
 func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) error {
-	_, err := q.db.ExecContext(ctx, markFeedFetched, arg.UpdatedAt, arg.UserID)
+	_, err := q.db.ExecContext(ctx, markFeedFetched, arg.ID, arg.FetchedAt, arg.AttemptedAt)
+	return err
+}
+
+const markOrphanedFeeds = `-- name: MarkOrphanedFeeds :execrows
+UPDATE feeds SET orphaned_at = $1::timestamp
+WHERE orphaned_at IS NULL
+AND NOT EXISTS (SELECT 1 FROM feed_follows ff WHERE ff.feed_id = feeds.id)
+`
+
+// Starts the grace period of feeds no one follows.
+func (q *Queries) MarkOrphanedFeeds(ctx context.Context, now time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markOrphanedFeeds, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const transferFeed = `-- name: TransferFeed :exec
+UPDATE feeds SET user_id = $2, updated_at = $3
+WHERE id = $1
+`
+
+type TransferFeedParams struct {
+	ID        uuid.UUID
+	UserID    uuid.NullUUID
+	UpdatedAt time.Time
+}
+
+func (q *Queries) TransferFeed(ctx context.Context, arg TransferFeedParams) error {
+	_, err := q.db.ExecContext(ctx, transferFeed, arg.ID, arg.UserID, arg.UpdatedAt)
 	return err
 }
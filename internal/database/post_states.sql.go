@@ -0,0 +1,644 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: post_states.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const countFollowedPosts = `-- name: CountFollowedPosts :one
+SELECT COUNT(*)
+FROM posts
+WHERE posts.feed_id IN (
+  SELECT feed_id FROM feed_follows WHERE user_id = $1)
+`
+
+func (q *Queries) CountFollowedPosts(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countFollowedPosts, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const getFeedPostsForUser = `-- name: GetFeedPostsForUser :many
+SELECT
+  posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.seq,
+  (post_reads.post_id IS NOT NULL)::boolean AS read,
+  (post_stars.post_id IS NOT NULL)::boolean AS starred
+FROM posts
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = $1
+LEFT JOIN post_stars
+ON post_stars.post_id = posts.id AND post_stars.user_id = $1
+WHERE posts.feed_id = $2
+ORDER BY COALESCE(posts.published_at, posts.created_at) DESC, posts.id DESC
+LIMIT $3
+`
+
+type GetFeedPostsForUserParams struct {
+	UserID uuid.UUID
+	FeedID uuid.UUID
+	Limit  int32
+}
+
+type GetFeedPostsForUserRow struct {
+	Post    Post
+	Read    bool
+	Starred bool
+}
+
+func (q *Queries) GetFeedPostsForUser(ctx context.Context, arg GetFeedPostsForUserParams) ([]GetFeedPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedPostsForUser, arg.UserID, arg.FeedID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFeedPostsForUserRow
+	for rows.Next() {
+		var i GetFeedPostsForUserRow
+		if err := rows.Scan(
+			&i.Post.ID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Post.Title,
+			&i.Post.Url,
+			&i.Post.Description,
+			&i.Post.PublishedAt,
+			&i.Post.FeedID,
+			&i.Post.Seq,
+			&i.Read,
+			&i.Starred,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFollowedFeedsWithUnread = `-- name: GetFollowedFeedsWithUnread :many
+SELECT
+  feeds.id,
+  feeds.name,
+  feeds.url,
+  COUNT(posts.id) FILTER (WHERE post_reads.post_id IS NULL) AS unread_count
+FROM feed_follows ff
+INNER JOIN feeds
+ON feeds.id = ff.feed_id
+LEFT JOIN posts
+ON posts.feed_id = feeds.id
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = ff.user_id
+WHERE ff.user_id = $1
+GROUP BY feeds.id
+ORDER BY feeds.name
+`
+
+type GetFollowedFeedsWithUnreadRow struct {
+	ID          uuid.UUID
+	Name        string
+	Url         string
+	UnreadCount int64
+}
+
+func (q *Queries) GetFollowedFeedsWithUnread(ctx context.Context, userID uuid.UUID) ([]GetFollowedFeedsWithUnreadRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFollowedFeedsWithUnread, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFollowedFeedsWithUnreadRow
+	for rows.Next() {
+		var i GetFollowedFeedsWithUnreadRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Url,
+			&i.UnreadCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostStates = `-- name: GetPostStates :many
+SELECT
+  posts.id,
+  (post_reads.post_id IS NOT NULL)::boolean AS read,
+  (post_stars.post_id IS NOT NULL)::boolean AS starred
+FROM posts
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = $1
+LEFT JOIN post_stars
+ON post_stars.post_id = posts.id AND post_stars.user_id = $1
+WHERE posts.id = ANY($2::uuid[])
+`
+
+type GetPostStatesParams struct {
+	UserID  uuid.UUID
+	PostIds []uuid.UUID
+}
+
+type GetPostStatesRow struct {
+	ID      uuid.UUID
+	Read    bool
+	Starred bool
+}
+
+func (q *Queries) GetPostStates(ctx context.Context, arg GetPostStatesParams) ([]GetPostStatesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostStates, arg.UserID, pq.Array(arg.PostIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostStatesRow
+	for rows.Next() {
+		var i GetPostStatesRow
+		if err := rows.Scan(&i.ID, &i.Read, &i.Starred); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getStarredPostsForUser = `-- name: GetStarredPostsForUser :many
+SELECT
+  posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.seq,
+  (post_reads.post_id IS NOT NULL)::boolean AS read,
+  TRUE AS starred
+FROM post_stars
+INNER JOIN posts
+ON posts.id = post_stars.post_id
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = post_stars.user_id
+WHERE post_stars.user_id = $1
+ORDER BY post_stars.starred_at DESC
+LIMIT $2
+`
+
+type GetStarredPostsForUserParams struct {
+	UserID uuid.UUID
+	Limit  int32
+}
+
+type GetStarredPostsForUserRow struct {
+	Post    Post
+	Read    bool
+	Starred bool
+}
+
+func (q *Queries) GetStarredPostsForUser(ctx context.Context, arg GetStarredPostsForUserParams) ([]GetStarredPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getStarredPostsForUser, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetStarredPostsForUserRow
+	for rows.Next() {
+		var i GetStarredPostsForUserRow
+		if err := rows.Scan(
+			&i.Post.ID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Post.Title,
+			&i.Post.Url,
+			&i.Post.Description,
+			&i.Post.PublishedAt,
+			&i.Post.FeedID,
+			&i.Post.Seq,
+			&i.Read,
+			&i.Starred,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getStarredSeqs = `-- name: GetStarredSeqs :many
+SELECT posts.seq
+FROM post_stars
+INNER JOIN posts
+ON posts.id = post_stars.post_id
+WHERE post_stars.user_id = $1
+ORDER BY posts.seq
+`
+
+func (q *Queries) GetStarredSeqs(ctx context.Context, userID uuid.UUID) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, getStarredSeqs, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var seq int64
+		if err := rows.Scan(&seq); err != nil {
+			return nil, err
+		}
+		items = append(items, seq)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getStreamItems = `-- name: GetStreamItems :many
+
+SELECT
+  posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.seq,
+  feeds.name AS feed_name,
+  feeds.url AS feed_url,
+  feeds.seq AS feed_seq,
+  (post_reads.post_id IS NOT NULL)::boolean AS read,
+  (post_stars.post_id IS NOT NULL)::boolean AS starred
+FROM posts
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = $1
+LEFT JOIN post_stars
+ON post_stars.post_id = posts.id AND post_stars.user_id = $1
+WHERE
+  ($2::boolean OR posts.feed_id IN (
+    SELECT feed_id FROM feed_follows WHERE user_id = $1))
+  AND (NOT $2::boolean OR post_stars.post_id IS NOT NULL)
+  AND (NOT $3::boolean OR post_reads.post_id IS NULL)
+  AND ($4::uuid IS NULL OR posts.feed_id = $4)
+  AND ($5::timestamp IS NULL
+    OR posts.created_at >= $5)
+  AND ($6::timestamp IS NULL
+    OR posts.created_at <= $6)
+  AND ($7::bigint IS NULL
+    OR ($8::boolean AND posts.seq > $7)
+    OR (NOT $8::boolean AND posts.seq < $7))
+ORDER BY
+  CASE WHEN $8::boolean THEN posts.seq END ASC,
+  posts.seq DESC
+LIMIT $9
+`
+
+type GetStreamItemsParams struct {
+	UserID       uuid.UUID
+	StarredOnly  bool
+	UnreadOnly   bool
+	FeedID       uuid.NullUUID
+	NewerThan    sql.NullTime
+	OlderThan    sql.NullTime
+	Continuation sql.NullInt64
+	OldestFirst  bool
+	Limit        int32
+}
+
+type GetStreamItemsRow struct {
+	Post     Post
+	FeedName string
+	FeedUrl  string
+	FeedSeq  int64
+	Read     bool
+	Starred  bool
+}
+
+// Streams of the Google Reader API are ordered and continued by the
+// posts' seq. Starred posts stay visible after an unfollow.
+func (q *Queries) GetStreamItems(ctx context.Context, arg GetStreamItemsParams) ([]GetStreamItemsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getStreamItems,
+		arg.UserID,
+		arg.StarredOnly,
+		arg.UnreadOnly,
+		arg.FeedID,
+		arg.NewerThan,
+		arg.OlderThan,
+		arg.Continuation,
+		arg.OldestFirst,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetStreamItemsRow
+	for rows.Next() {
+		var i GetStreamItemsRow
+		if err := rows.Scan(
+			&i.Post.ID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Post.Title,
+			&i.Post.Url,
+			&i.Post.Description,
+			&i.Post.PublishedAt,
+			&i.Post.FeedID,
+			&i.Post.Seq,
+			&i.FeedName,
+			&i.FeedUrl,
+			&i.FeedSeq,
+			&i.Read,
+			&i.Starred,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getStreamItemsBySeq = `-- name: GetStreamItemsBySeq :many
+SELECT
+  posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.seq,
+  feeds.name AS feed_name,
+  feeds.url AS feed_url,
+  feeds.seq AS feed_seq,
+  (post_reads.post_id IS NOT NULL)::boolean AS read,
+  (post_stars.post_id IS NOT NULL)::boolean AS starred
+FROM posts
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = $1
+LEFT JOIN post_stars
+ON post_stars.post_id = posts.id AND post_stars.user_id = $1
+WHERE posts.seq = ANY($2::bigint[])
+ORDER BY posts.seq DESC
+`
+
+type GetStreamItemsBySeqParams struct {
+	UserID uuid.UUID
+	Seqs   []int64
+}
+
+type GetStreamItemsBySeqRow struct {
+	Post     Post
+	FeedName string
+	FeedUrl  string
+	FeedSeq  int64
+	Read     bool
+	Starred  bool
+}
+
+func (q *Queries) GetStreamItemsBySeq(ctx context.Context, arg GetStreamItemsBySeqParams) ([]GetStreamItemsBySeqRow, error) {
+	rows, err := q.db.QueryContext(ctx, getStreamItemsBySeq, arg.UserID, pq.Array(arg.Seqs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetStreamItemsBySeqRow
+	for rows.Next() {
+		var i GetStreamItemsBySeqRow
+		if err := rows.Scan(
+			&i.Post.ID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Post.Title,
+			&i.Post.Url,
+			&i.Post.Description,
+			&i.Post.PublishedAt,
+			&i.Post.FeedID,
+			&i.Post.Seq,
+			&i.FeedName,
+			&i.FeedUrl,
+			&i.FeedSeq,
+			&i.Read,
+			&i.Starred,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnreadCounts = `-- name: GetUnreadCounts :many
+SELECT
+  feeds.id,
+  feeds.url,
+  COUNT(posts.id) AS unread_count,
+  MAX(posts.created_at)::timestamp AS newest_at
+FROM feed_follows ff
+INNER JOIN feeds
+ON feeds.id = ff.feed_id
+INNER JOIN posts
+ON posts.feed_id = feeds.id
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = ff.user_id
+WHERE ff.user_id = $1 AND post_reads.post_id IS NULL
+GROUP BY feeds.id
+`
+
+type GetUnreadCountsRow struct {
+	ID          uuid.UUID
+	Url         string
+	UnreadCount int64
+	NewestAt    time.Time
+}
+
+func (q *Queries) GetUnreadCounts(ctx context.Context, userID uuid.UUID) ([]GetUnreadCountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUnreadCounts, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUnreadCountsRow
+	for rows.Next() {
+		var i GetUnreadCountsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			&i.UnreadCount,
+			&i.NewestAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnreadSeqs = `-- name: GetUnreadSeqs :many
+SELECT posts.seq
+FROM posts
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = $1
+WHERE
+  posts.feed_id IN (
+    SELECT feed_id FROM feed_follows WHERE user_id = $1)
+  AND post_reads.post_id IS NULL
+ORDER BY posts.seq
+`
+
+func (q *Queries) GetUnreadSeqs(ctx context.Context, userID uuid.UUID) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, getUnreadSeqs, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var seq int64
+		if err := rows.Scan(&seq); err != nil {
+			return nil, err
+		}
+		items = append(items, seq)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markPostRead = `-- name: MarkPostRead :exec
+INSERT INTO post_reads (user_id, post_id, read_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO NOTHING
+`
+
+type MarkPostReadParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt time.Time
+}
+
+func (q *Queries) MarkPostRead(ctx context.Context, arg MarkPostReadParams) error {
+	_, err := q.db.ExecContext(ctx, markPostRead, arg.UserID, arg.PostID, arg.ReadAt)
+	return err
+}
+
+const markPostUnread = `-- name: MarkPostUnread :exec
+DELETE FROM post_reads
+WHERE user_id = $1 AND post_id = $2
+`
+
+type MarkPostUnreadParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+}
+
+func (q *Queries) MarkPostUnread(ctx context.Context, arg MarkPostUnreadParams) error {
+	_, err := q.db.ExecContext(ctx, markPostUnread, arg.UserID, arg.PostID)
+	return err
+}
+
+const markStreamRead = `-- name: MarkStreamRead :execrows
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT $1::uuid, posts.id, $2::timestamp
+FROM posts
+WHERE
+  posts.feed_id IN (
+    SELECT feed_id FROM feed_follows WHERE user_id = $1)
+  AND ($3::uuid IS NULL OR posts.feed_id = $3)
+  AND posts.created_at <= $4
+ON CONFLICT (user_id, post_id) DO NOTHING
+`
+
+type MarkStreamReadParams struct {
+	UserID    uuid.UUID
+	ReadAt    time.Time
+	FeedID    uuid.NullUUID
+	OlderThan time.Time
+}
+
+func (q *Queries) MarkStreamRead(ctx context.Context, arg MarkStreamReadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markStreamRead,
+		arg.UserID,
+		arg.ReadAt,
+		arg.FeedID,
+		arg.OlderThan,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const starPost = `-- name: StarPost :exec
+INSERT INTO post_stars (user_id, post_id, starred_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO NOTHING
+`
+
+type StarPostParams struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	StarredAt time.Time
+}
+
+func (q *Queries) StarPost(ctx context.Context, arg StarPostParams) error {
+	_, err := q.db.ExecContext(ctx, starPost, arg.UserID, arg.PostID, arg.StarredAt)
+	return err
+}
+
+const unstarPost = `-- name: UnstarPost :exec
+DELETE FROM post_stars
+WHERE user_id = $1 AND post_id = $2
+`
+
+type UnstarPostParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+}
+
+func (q *Queries) UnstarPost(ctx context.Context, arg UnstarPostParams) error {
+	_, err := q.db.ExecContext(ctx, unstarPost, arg.UserID, arg.PostID)
+	return err
+}
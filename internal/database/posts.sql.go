@@ -13,7 +13,7 @@ import (
 	"github.com/google/uuid"
 )
 
-const createPost = `-- name: CreatePost :exec
+const createPost = `-- name: CreatePost :execrows
 INSERT INTO posts (
     id,
     created_at,
@@ -25,6 +25,7 @@ INSERT INTO posts (
     feed_id
 )
 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (url) DO NOTHING
 `
 
 type CreatePostParams struct {
@@ -38,8 +39,9 @@ type CreatePostParams struct {
 	FeedID      uuid.UUID
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) error {
-	_, err := q.db.ExecContext(ctx, createPost,
+// Posts already collected are skipped.
+func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createPost,
 		arg.ID,
 		arg.CreatedAt,
 		arg.UpdatedAt,
@@ -49,17 +51,167 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) error {
 		arg.PublishedAt,
 		arg.FeedID,
 	)
-	return err
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getPostByID = `-- name: GetPostByID :one
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, seq FROM posts WHERE id = $1
+`
+
+func (q *Queries) GetPostByID(ctx context.Context, id uuid.UUID) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPostByID, id)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Seq,
+	)
+	return i, err
+}
+
+const getPostsNewest = `-- name: GetPostsNewest :many
+
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, seq FROM posts
+WHERE
+  ($1::uuid IS NULL OR feed_id = $1)
+  AND ($2::timestamp IS NULL
+    OR COALESCE(published_at, created_at) >= $2)
+  AND ($3::timestamp IS NULL
+    OR (COALESCE(published_at, created_at), id)
+      < ($3, $4::uuid))
+  AND ($5::timestamp IS NULL
+    OR (COALESCE(published_at, created_at), id)
+      > ($5, $6::uuid))
+  AND (NOT $7::boolean OR NOT EXISTS (
+    SELECT 1 FROM post_reads
+    WHERE post_reads.post_id = posts.id
+      AND post_reads.user_id = $8))
+  AND (NOT $9::boolean OR EXISTS (
+    SELECT 1 FROM post_stars
+    WHERE post_stars.post_id = posts.id
+      AND post_stars.user_id = $8))
+ORDER BY COALESCE(published_at, created_at) DESC, id DESC
+LIMIT $10
+`
+
+type GetPostsNewestParams struct {
+	FeedID      uuid.NullUUID
+	Since       sql.NullTime
+	BeforeTime  sql.NullTime
+	BeforeID    uuid.NullUUID
+	AfterTime   sql.NullTime
+	AfterID     uuid.NullUUID
+	UnreadOnly  bool
+	UserID      uuid.NullUUID
+	StarredOnly bool
+	Limit       int32
+}
+
+// Posts are paged by (COALESCE(published_at, created_at), id) so that
+// posts without a publication date still get a stable position.
+func (q *Queries) GetPostsNewest(ctx context.Context, arg GetPostsNewestParams) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsNewest,
+		arg.FeedID,
+		arg.Since,
+		arg.BeforeTime,
+		arg.BeforeID,
+		arg.AfterTime,
+		arg.AfterID,
+		arg.UnreadOnly,
+		arg.UserID,
+		arg.StarredOnly,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Post
+	for rows.Next() {
+		var i Post
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Seq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const getPosts = `-- name: GetPosts :many
-SELECT id, created_at, updated_at, title, url, description, published_at, feed_id FROM posts
-ORDER BY updated_at DESC
-LIMIT $1
+const getPostsOldest = `-- name: GetPostsOldest :many
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, seq FROM posts
+WHERE
+  ($1::uuid IS NULL OR feed_id = $1)
+  AND ($2::timestamp IS NULL
+    OR COALESCE(published_at, created_at) >= $2)
+  AND ($3::timestamp IS NULL
+    OR (COALESCE(published_at, created_at), id)
+      < ($3, $4::uuid))
+  AND ($5::timestamp IS NULL
+    OR (COALESCE(published_at, created_at), id)
+      > ($5, $6::uuid))
+  AND (NOT $7::boolean OR NOT EXISTS (
+    SELECT 1 FROM post_reads
+    WHERE post_reads.post_id = posts.id
+      AND post_reads.user_id = $8))
+  AND (NOT $9::boolean OR EXISTS (
+    SELECT 1 FROM post_stars
+    WHERE post_stars.post_id = posts.id
+      AND post_stars.user_id = $8))
+ORDER BY COALESCE(published_at, created_at) ASC, id ASC
+LIMIT $10
 `
 
-func (q *Queries) GetPosts(ctx context.Context, limit int32) ([]Post, error) {
-	rows, err := q.db.QueryContext(ctx, getPosts, limit)
+type GetPostsOldestParams struct {
+	FeedID      uuid.NullUUID
+	Since       sql.NullTime
+	BeforeTime  sql.NullTime
+	BeforeID    uuid.NullUUID
+	AfterTime   sql.NullTime
+	AfterID     uuid.NullUUID
+	UnreadOnly  bool
+	UserID      uuid.NullUUID
+	StarredOnly bool
+	Limit       int32
+}
+
+func (q *Queries) GetPostsOldest(ctx context.Context, arg GetPostsOldestParams) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsOldest,
+		arg.FeedID,
+		arg.Since,
+		arg.BeforeTime,
+		arg.BeforeID,
+		arg.AfterTime,
+		arg.AfterID,
+		arg.UnreadOnly,
+		arg.UserID,
+		arg.StarredOnly,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -76,6 +228,7 @@ func (q *Queries) GetPosts(ctx context.Context, limit int32) ([]Post, error) {
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.Seq,
 		); err != nil {
 			return nil, err
 		}
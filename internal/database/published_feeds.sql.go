@@ -0,0 +1,220 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: published_feeds.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createPublishedFeed = `-- name: CreatePublishedFeed :one
+INSERT INTO published_feeds (
+  id,
+  created_at,
+  updated_at,
+  user_id,
+  name,
+  title,
+  feed_ids,
+  search,
+  token
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, created_at, updated_at, user_id, name, title, feed_ids, search, token
+`
+
+type CreatePublishedFeedParams struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Name      string
+	Title     string
+	FeedIds   []uuid.UUID
+	Search    sql.NullString
+	Token     string
+}
+
+func (q *Queries) CreatePublishedFeed(ctx context.Context, arg CreatePublishedFeedParams) (PublishedFeed, error) {
+	row := q.db.QueryRowContext(ctx, createPublishedFeed,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.UserID,
+		arg.Name,
+		arg.Title,
+		pq.Array(arg.FeedIds),
+		arg.Search,
+		arg.Token,
+	)
+	var i PublishedFeed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.Title,
+		pq.Array(&i.FeedIds),
+		&i.Search,
+		&i.Token,
+	)
+	return i, err
+}
+
+const deletePublishedFeed = `-- name: DeletePublishedFeed :execrows
+DELETE FROM published_feeds
+WHERE user_id = $1 AND name = $2
+`
+
+type DeletePublishedFeedParams struct {
+	UserID uuid.UUID
+	Name   string
+}
+
+func (q *Queries) DeletePublishedFeed(ctx context.Context, arg DeletePublishedFeedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deletePublishedFeed, arg.UserID, arg.Name)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getPublishedFeedByToken = `-- name: GetPublishedFeedByToken :one
+SELECT id, created_at, updated_at, user_id, name, title, feed_ids, search, token FROM published_feeds WHERE token = $1
+`
+
+func (q *Queries) GetPublishedFeedByToken(ctx context.Context, token string) (PublishedFeed, error) {
+	row := q.db.QueryRowContext(ctx, getPublishedFeedByToken, token)
+	var i PublishedFeed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.Title,
+		pq.Array(&i.FeedIds),
+		&i.Search,
+		&i.Token,
+	)
+	return i, err
+}
+
+const getPublishedFeedsForUser = `-- name: GetPublishedFeedsForUser :many
+SELECT id, created_at, updated_at, user_id, name, title, feed_ids, search, token FROM published_feeds
+WHERE user_id = $1
+ORDER BY name
+`
+
+func (q *Queries) GetPublishedFeedsForUser(ctx context.Context, userID uuid.UUID) ([]PublishedFeed, error) {
+	rows, err := q.db.QueryContext(ctx, getPublishedFeedsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PublishedFeed
+	for rows.Next() {
+		var i PublishedFeed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Name,
+			&i.Title,
+			pq.Array(&i.FeedIds),
+			&i.Search,
+			&i.Token,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTimelinePosts = `-- name: GetTimelinePosts :many
+SELECT
+  posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.seq,
+  feeds.name AS feed_name,
+  feeds.url AS feed_url
+FROM posts
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+WHERE
+  ((cardinality($1::uuid[]) = 0 AND posts.feed_id IN (
+      SELECT ff.feed_id FROM feed_follows ff WHERE ff.user_id = $2::uuid))
+    OR posts.feed_id = ANY($1::uuid[]))
+  AND ($3::text IS NULL
+    OR strpos(lower(posts.title), lower($3)) > 0
+    OR strpos(lower(COALESCE(posts.description, '')), lower($3)) > 0)
+ORDER BY COALESCE(posts.published_at, posts.created_at) DESC, posts.id DESC
+LIMIT $4
+`
+
+type GetTimelinePostsParams struct {
+	FeedIds []uuid.UUID
+	UserID  uuid.UUID
+	Search  sql.NullString
+	Limit   int32
+}
+
+type GetTimelinePostsRow struct {
+	Post     Post
+	FeedName string
+	FeedUrl  string
+}
+
+func (q *Queries) GetTimelinePosts(ctx context.Context, arg GetTimelinePostsParams) ([]GetTimelinePostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getTimelinePosts,
+		pq.Array(arg.FeedIds),
+		arg.UserID,
+		arg.Search,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTimelinePostsRow
+	for rows.Next() {
+		var i GetTimelinePostsRow
+		if err := rows.Scan(
+			&i.Post.ID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Post.Title,
+			&i.Post.Url,
+			&i.Post.Description,
+			&i.Post.PublishedAt,
+			&i.Post.FeedID,
+			&i.Post.Seq,
+			&i.FeedName,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
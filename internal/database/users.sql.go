@@ -7,35 +7,153 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const countAdmins = `-- name: CountAdmins :one
+SELECT count(*) FROM users WHERE is_admin
+`
+
+func (q *Queries) CountAdmins(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countAdmins)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countAdminsWithPassword = `-- name: CountAdminsWithPassword :one
+SELECT count(*) FROM users WHERE is_admin AND password_hash IS NOT NULL
+`
+
+func (q *Queries) CountAdminsWithPassword(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countAdminsWithPassword)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countAllRows = `-- name: CountAllRows :one
+SELECT
+  (SELECT count(*) FROM users) AS users,
+  (SELECT count(*) FROM feeds) AS feeds,
+  (SELECT count(*) FROM feed_credentials) AS feed_credentials,
+  (SELECT count(*) FROM feed_follows) AS feed_follows,
+  (SELECT count(*) FROM posts) AS posts,
+  (SELECT count(*) FROM post_reads) AS post_reads,
+  (SELECT count(*) FROM post_stars) AS post_stars,
+  (SELECT count(*) FROM published_feeds) AS published_feeds,
+  (SELECT count(*) FROM api_tokens) AS api_tokens,
+  (SELECT count(*) FROM sessions) AS sessions
+`
+
+type CountAllRowsRow struct {
+	Users           int64
+	Feeds           int64
+	FeedCredentials int64
+	FeedFollows     int64
+	Posts           int64
+	PostReads       int64
+	PostStars       int64
+	PublishedFeeds  int64
+	ApiTokens       int64
+	Sessions        int64
+}
+
+func (q *Queries) CountAllRows(ctx context.Context) (CountAllRowsRow, error) {
+	row := q.db.QueryRowContext(ctx, countAllRows)
+	var i CountAllRowsRow
+	err := row.Scan(
+		&i.Users,
+		&i.Feeds,
+		&i.FeedCredentials,
+		&i.FeedFollows,
+		&i.Posts,
+		&i.PostReads,
+		&i.PostStars,
+		&i.PublishedFeeds,
+		&i.ApiTokens,
+		&i.Sessions,
+	)
+	return i, err
+}
+
+const countUserRows = `-- name: CountUserRows :one
+SELECT
+  (SELECT count(*) FROM feeds f WHERE f.user_id = $1::uuid
+    AND NOT EXISTS (SELECT 1 FROM feed_follows ff
+      WHERE ff.feed_id = f.id AND ff.user_id <> $1::uuid)) AS unattributed_feeds,
+  (SELECT count(*) FROM feeds f WHERE f.user_id = $1::uuid
+    AND EXISTS (SELECT 1 FROM feed_follows ff
+      WHERE ff.feed_id = f.id AND ff.user_id <> $1::uuid)) AS transferred_feeds,
+  (SELECT count(*) FROM feed_follows ff WHERE ff.user_id = $1::uuid) AS feed_follows,
+  (SELECT count(*) FROM post_reads pr WHERE pr.user_id = $1::uuid) AS post_reads,
+  (SELECT count(*) FROM post_stars ps WHERE ps.user_id = $1::uuid) AS post_stars,
+  (SELECT count(*) FROM published_feeds pf WHERE pf.user_id = $1::uuid) AS published_feeds,
+  (SELECT count(*) FROM api_tokens t WHERE t.user_id = $1::uuid) AS api_tokens,
+  (SELECT count(*) FROM sessions se WHERE se.user_id = $1::uuid) AS sessions
+`
+
+type CountUserRowsRow struct {
+	UnattributedFeeds int64
+	TransferredFeeds  int64
+	FeedFollows       int64
+	PostReads         int64
+	PostStars         int64
+	PublishedFeeds    int64
+	ApiTokens         int64
+	Sessions          int64
+}
+
+// Counts what deleting a user deletes. Feeds other users follow are
+// transferred, the others lose their attribution.
+func (q *Queries) CountUserRows(ctx context.Context, userID uuid.UUID) (CountUserRowsRow, error) {
+	row := q.db.QueryRowContext(ctx, countUserRows, userID)
+	var i CountUserRowsRow
+	err := row.Scan(
+		&i.UnattributedFeeds,
+		&i.TransferredFeeds,
+		&i.FeedFollows,
+		&i.PostReads,
+		&i.PostStars,
+		&i.PublishedFeeds,
+		&i.ApiTokens,
+		&i.Sessions,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, name)
+INSERT INTO users (id, created_at, updated_at, name, password_hash, is_admin)
 VALUES (
   $1,
   $2,
   $3,
-  $4
+  $4,
+  $5,
+  NOT EXISTS (SELECT 1 FROM users)
 )
-RETURNING id, created_at, updated_at, name
+RETURNING id, created_at, updated_at, name, fever_api_key, password_hash, is_admin
 `
 
 type CreateUserParams struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Name      string
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Name         string
+	PasswordHash sql.NullString
 }
 
+// The first user administers the install.
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
 	row := q.db.QueryRowContext(ctx, createUser,
 		arg.ID,
 		arg.CreatedAt,
 		arg.UpdatedAt,
 		arg.Name,
+		arg.PasswordHash,
 	)
 	var i User
 	err := row.Scan(
@@ -43,6 +161,9 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.FeverApiKey,
+		&i.PasswordHash,
+		&i.IsAdmin,
 	)
 	return i, err
 }
@@ -56,8 +177,20 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	return err
 }
 
+const deleteUser = `-- name: DeleteUser :execrows
+DELETE FROM users WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getAllUsers = `-- name: GetAllUsers :many
-SELECT id, created_at, updated_at, name FROM users
+SELECT id, created_at, updated_at, name, fever_api_key, password_hash, is_admin FROM users
 `
 
 func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
@@ -74,6 +207,9 @@ func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Name,
+			&i.FeverApiKey,
+			&i.PasswordHash,
+			&i.IsAdmin,
 		); err != nil {
 			return nil, err
 		}
@@ -89,7 +225,7 @@ func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, name FROM users WHERE name = $1
+SELECT id, created_at, updated_at, name, fever_api_key, password_hash, is_admin FROM users WHERE name = $1
 `
 
 func (q *Queries) GetUser(ctx context.Context, name string) (User, error) {
@@ -100,12 +236,34 @@ func (q *Queries) GetUser(ctx context.Context, name string) (User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.FeverApiKey,
+		&i.PasswordHash,
+		&i.IsAdmin,
+	)
+	return i, err
+}
+
+const getUserByFeverAPIKey = `-- name: GetUserByFeverAPIKey :one
+SELECT id, created_at, updated_at, name, fever_api_key, password_hash, is_admin FROM users WHERE fever_api_key = $1::text
+`
+
+func (q *Queries) GetUserByFeverAPIKey(ctx context.Context, feverApiKey string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByFeverAPIKey, feverApiKey)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.FeverApiKey,
+		&i.PasswordHash,
+		&i.IsAdmin,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, created_at, updated_at, name FROM users WHERE id = $1
+SELECT id, created_at, updated_at, name, fever_api_key, password_hash, is_admin FROM users WHERE id = $1
 `
 
 func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
@@ -116,6 +274,174 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.FeverApiKey,
+		&i.PasswordHash,
+		&i.IsAdmin,
 	)
 	return i, err
 }
+
+const getUsersWithDetails = `-- name: GetUsersWithDetails :many
+SELECT users.id, users.created_at, users.updated_at, users.name, users.fever_api_key, users.password_hash, users.is_admin,
+  (SELECT count(*) FROM feeds WHERE feeds.user_id = users.id) AS feeds,
+  (SELECT count(*) FROM feed_follows
+    WHERE feed_follows.user_id = users.id) AS follows,
+  (SELECT count(*) FROM api_tokens
+    WHERE api_tokens.user_id = users.id) AS api_tokens,
+  sessions.created_at AS last_login_at
+FROM users
+LEFT JOIN sessions ON sessions.id = (
+  SELECT id FROM sessions last
+  WHERE last.user_id = users.id
+  ORDER BY last.created_at DESC
+  LIMIT 1
+)
+ORDER BY users.created_at
+`
+
+type GetUsersWithDetailsRow struct {
+	User        User
+	Feeds       int64
+	Follows     int64
+	ApiTokens   int64
+	LastLoginAt sql.NullTime
+}
+
+func (q *Queries) GetUsersWithDetails(ctx context.Context) ([]GetUsersWithDetailsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersWithDetails)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersWithDetailsRow
+	for rows.Next() {
+		var i GetUsersWithDetailsRow
+		if err := rows.Scan(
+			&i.User.ID,
+			&i.User.CreatedAt,
+			&i.User.UpdatedAt,
+			&i.User.Name,
+			&i.User.FeverApiKey,
+			&i.User.PasswordHash,
+			&i.User.IsAdmin,
+			&i.Feeds,
+			&i.Follows,
+			&i.ApiTokens,
+			&i.LastLoginAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const renameUser = `-- name: RenameUser :one
+UPDATE users SET name = $2, updated_at = $3, fever_api_key = NULL
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, fever_api_key, password_hash, is_admin
+`
+
+type RenameUserParams struct {
+	ID        uuid.UUID
+	Name      string
+	UpdatedAt time.Time
+}
+
+// The Fever API key is derived from the name, so it is cleared.
+func (q *Queries) RenameUser(ctx context.Context, arg RenameUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, renameUser, arg.ID, arg.Name, arg.UpdatedAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.FeverApiKey,
+		&i.PasswordHash,
+		&i.IsAdmin,
+	)
+	return i, err
+}
+
+const setFeverAPIKey = `-- name: SetFeverAPIKey :exec
+UPDATE users SET fever_api_key = $2, updated_at = $3
+WHERE id = $1
+`
+
+type SetFeverAPIKeyParams struct {
+	ID          uuid.UUID
+	FeverApiKey sql.NullString
+	UpdatedAt   time.Time
+}
+
+func (q *Queries) SetFeverAPIKey(ctx context.Context, arg SetFeverAPIKeyParams) error {
+	_, err := q.db.ExecContext(ctx, setFeverAPIKey, arg.ID, arg.FeverApiKey, arg.UpdatedAt)
+	return err
+}
+
+const setUserAdmin = `-- name: SetUserAdmin :exec
+UPDATE users SET is_admin = $2, updated_at = $3
+WHERE id = $1
+`
+
+type SetUserAdminParams struct {
+	ID        uuid.UUID
+	IsAdmin   bool
+	UpdatedAt time.Time
+}
+
+func (q *Queries) SetUserAdmin(ctx context.Context, arg SetUserAdminParams) error {
+	_, err := q.db.ExecContext(ctx, setUserAdmin, arg.ID, arg.IsAdmin, arg.UpdatedAt)
+	return err
+}
+
+const setUserPassword = `-- name: SetUserPassword :exec
+UPDATE users SET password_hash = $2, updated_at = $3
+WHERE id = $1
+`
+
+type SetUserPasswordParams struct {
+	ID           uuid.UUID
+	PasswordHash sql.NullString
+	UpdatedAt    time.Time
+}
+
+func (q *Queries) SetUserPassword(ctx context.Context, arg SetUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, setUserPassword, arg.ID, arg.PasswordHash, arg.UpdatedAt)
+	return err
+}
+
+const transferFollowedFeeds = `-- name: TransferFollowedFeeds :execrows
+UPDATE feeds
+SET user_id = (
+  SELECT ff.user_id FROM feed_follows ff
+  WHERE ff.feed_id = feeds.id AND ff.user_id <> $1::uuid
+  ORDER BY ff.created_at
+  LIMIT 1
+), updated_at = $2::timestamp
+WHERE feeds.user_id = $1::uuid
+AND EXISTS (SELECT 1 FROM feed_follows ff
+  WHERE ff.feed_id = feeds.id AND ff.user_id <> $1::uuid)
+`
+
+type TransferFollowedFeedsParams struct {
+	UserID    uuid.UUID
+	UpdatedAt time.Time
+}
+
+// Hands the feeds a user added and others follow to their oldest
+// follower, so deleting the user doesn't delete them.
+func (q *Queries) TransferFollowedFeeds(ctx context.Context, arg TransferFollowedFeedsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, transferFollowedFeeds, arg.UserID, arg.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
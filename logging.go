@@ -0,0 +1,95 @@
+package gogator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/prchop/gogator/internal/database"
+)
+
+// Log formats accepted by --log-format and the log_format setting.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+var logFormats = []string{logFormatText, logFormatJSON}
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// logLevel is the level of the default logger, which the config file
+// can change after startup.
+var logLevel = new(slog.LevelVar)
+
+// setupLogging installs the default logger. Logs are diagnostics, so
+// they go to stderr and leave stdout to the output of commands.
+func setupLogging(level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unknown log level %q, expected one of: %s",
+			level, strings.Join(logLevels, ", "))
+	}
+
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var h slog.Handler
+	switch format {
+	case logFormatText:
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case logFormatJSON:
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown log format %q, expected one of: %s",
+			format, strings.Join(logFormats, ", "))
+	}
+	logLevel.Set(l)
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// applyLogConfig sets up logging from the config file, except for what
+// was given on the command line.
+func (s *state) applyLogConfig() error {
+	level, format := s.opts.logLevel, s.opts.logFormat
+	if level == "" {
+		level = s.cfg.LogLevel
+	}
+	if format == "" {
+		format = s.cfg.LogFormat
+	}
+	if err := setupLogging(orDefault(level, "info"), orDefault(format, logFormatText)); err != nil {
+		return fmt.Errorf("error in config: %w", err)
+	}
+	return nil
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+type loggerKey struct{}
+
+// fetchLogger returns the logger of an attempt to fetch feed, whose
+// lines carry the feed and an id telling attempts apart.
+func fetchLogger(feed database.Feed) *slog.Logger {
+	return slog.With("feed_id", feed.ID, "feed_url", feed.Url,
+		"attempt_id", uuid.NewString())
+}
+
+func withLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// loggerFrom returns the logger carried by ctx, or the default one.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
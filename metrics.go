@@ -0,0 +1,235 @@
+package gogator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prchop/gogator/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// The metrics are served in the Prometheus format by serve at /metrics
+// and by agg on --metrics-addr. Feeds, users and paths are never used
+// as labels so the number of series stays small.
+var (
+	feedFetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gogator",
+		Name:      "feed_fetches_total",
+		Help:      "Feed fetches, by result: success or failure.",
+	}, []string{"result"})
+	feedFetchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "gogator",
+		Name:      "feed_fetch_duration_seconds",
+		Help:      "Time taken to fetch a feed and store its posts.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	})
+	feedFetchesInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gogator",
+		Name:      "feed_fetches_in_flight",
+		Help:      "Feed fetches running.",
+	})
+	feedResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gogator",
+		Name:      "feed_responses_total",
+		Help:      "Responses to feed requests, by status class: 2xx, 3xx, 4xx or 5xx.",
+	}, []string{"code"})
+	feedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "gogator",
+		Name:      "feed_downloaded_bytes_total",
+		Help:      "Bytes of feeds downloaded, before they are decompressed.",
+	})
+	feedParseErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gogator",
+		Name:      "feed_parse_errors_total",
+		Help:      "Feeds that couldn't be parsed, by format: rss, rdf or unknown.",
+	}, []string{"format"})
+	postsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "gogator",
+		Name:      "posts_created_total",
+		Help:      "New posts stored, posts collected before aren't counted.",
+	})
+	postsDuplicate = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "gogator",
+		Name:      "posts_duplicate_total",
+		Help:      "Posts of fetched feeds that were already collected.",
+	})
+	feedsCollected = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "gogator",
+		Name:      "feeds_collected_total",
+		Help:      "Feeds no one follows deleted by agg.",
+	})
+	aggFeeds = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gogator",
+		Name:      "agg_feeds",
+		Help:      "Feeds in the feed set of agg.",
+	})
+	aggLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gogator",
+		Name:      "agg_lag_seconds",
+		Help:      "How overdue the least recently attempted feed was at the last turn of agg.",
+	})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gogator",
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by database queries, by query name.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"query"})
+
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gogator",
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by handler, method and status code.",
+	}, []string{"handler", "method", "code"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gogator",
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests, by handler.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"handler"})
+	httpRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gogator",
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests being served.",
+	})
+)
+
+// fetchResult is the result label of feedFetches.
+func fetchResult(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// statusClass is the code label of feedResponses.
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "other"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// isParseError reports whether err is about the content of a feed
+// rather than about receiving it.
+func isParseError(err error) bool {
+	var se *xml.SyntaxError
+	var ue xml.UnmarshalError
+	return errors.As(err, &se) || errors.As(err, &ue) || errors.Is(err, errNotAFeed)
+}
+
+// countingReader adds the bytes read from r to feedBytes.
+type countingReader struct {
+	r io.Reader
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	feedBytes.Add(float64(n))
+	return n, err
+}
+
+// timedDB times the queries run on db, labeled with the name sqlc gives
+// them.
+type timedDB struct {
+	db database.DBTX
+}
+
+// queryName returns the name of a query generated by sqlc, which starts
+// with "-- name: <name> :<kind>".
+func queryName(query string) string {
+	rest, ok := strings.CutPrefix(query, "-- name: ")
+	if !ok {
+		return "other"
+	}
+	name, _, _ := strings.Cut(rest, " ")
+	return name
+}
+
+func (t timedDB) observe(query string, start time.Time) {
+	dbQueryDuration.WithLabelValues(queryName(query)).Observe(time.Since(start).Seconds())
+}
+
+func (t timedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	defer t.observe(query, time.Now())
+	return t.db.ExecContext(ctx, query, args...)
+}
+
+func (t timedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return t.db.PrepareContext(ctx, query)
+}
+
+// QueryContext is timed until the first rows are ready, not until they
+// are all read.
+func (t timedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	defer t.observe(query, time.Now())
+	return t.db.QueryContext(ctx, query, args...)
+}
+
+func (t timedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	defer t.observe(query, time.Now())
+	return t.db.QueryRowContext(ctx, query, args...)
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// instrumentHandler counts and times the requests served by h, labeled
+// with the name of the handler.
+func instrumentHandler(name string, h http.Handler) http.Handler {
+	duration := httpRequestDuration.WithLabelValues(name)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		duration.Observe(time.Since(start).Seconds())
+		httpRequests.WithLabelValues(name, methodLabel(r.Method),
+			strconv.Itoa(sw.status)).Inc()
+	})
+}
+
+// methodLabel keeps the method label to the standard methods.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "OTHER"
+	}
+}
@@ -1,10 +1,61 @@
 package gogator
 
-import "context"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
 
+	"github.com/prchop/gogator/internal/database"
+)
+
+// MiddlewareLoggedIn runs hl as the user of the session stored in the
+// config file, or of the API token in $GOGATOR_TOKEN. The token needs
+// the write scope.
 func MiddlewareLoggedIn(hl handlerLoggedIn) handler {
+	return loggedIn(scopeWrite, hl)
+}
+
+// MiddlewareLoggedInRead is MiddlewareLoggedIn for commands that only
+// read, which read scoped tokens may run.
+func MiddlewareLoggedInRead(hl handlerLoggedIn) handler {
+	return loggedIn(scopeRead, hl)
+}
+
+func loggedIn(scope string, hl handlerLoggedIn) handler {
 	return func(s *state, c command) error {
-		u, err := s.db.GetUser(context.Background(), s.cfg.UserName)
+		if token := os.Getenv(tokenEnv); token != "" {
+			u, tokenScope, err := authenticateToken(context.Background(), s.db, token)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("the token in %s is invalid or expired: %w",
+					tokenEnv, errUnauthorized)
+			}
+			if err != nil {
+				return err
+			}
+			if !scopeAllows(tokenScope, scope) {
+				return fmt.Errorf("the token in %s is read only: %w",
+					tokenEnv, errUnauthorized)
+			}
+			return hl(s, c, u)
+		}
+
+		if s.cfg.SessionToken == "" {
+			return fmt.Errorf("not logged in, run \"gogator login <username>\": %w",
+				errUnauthorized)
+		}
+
+		u, err := s.db.GetUserBySession(context.Background(),
+			database.GetUserBySessionParams{
+				TokenHash: hashToken(s.cfg.SessionToken),
+				ExpiresAt: time.Now().UTC(),
+			})
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("session expired, run \"gogator login %s\": %w",
+				s.cfg.UserName, errUnauthorized)
+		}
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,205 @@
+package gogator
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// pathParam matches the wildcards of the route patterns, which use the
+// same {name} syntax as OpenAPI.
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// openAPI generates an OpenAPI 3 document from the route table, so the
+// description can't drift from what is actually served.
+func (a *apiServer) openAPI() map[string]any {
+	schemas := map[string]any{}
+	paths := map[string]map[string]any{}
+
+	for _, rt := range a.routes {
+		op := map[string]any{
+			"summary":     rt.summary,
+			"operationId": operationID(rt),
+		}
+
+		var params []any
+		for _, m := range pathParam.FindAllStringSubmatch(rt.path, -1) {
+			params = append(params, map[string]any{
+				"name":     m[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string", "format": "uuid"},
+			})
+		}
+		for _, p := range rt.params {
+			params = append(params, map[string]any{
+				"name":        p.name,
+				"in":          p.in,
+				"description": p.desc,
+				"schema":      map[string]any{"type": p.typ},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if rt.body != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema": schemaOf(reflect.TypeOf(rt.body), schemas),
+					},
+				},
+			}
+		}
+
+		responses := map[string]any{
+			"default": map[string]any{
+				"description": "error",
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema": schemaOf(reflect.TypeOf(apiErrorBody{}), schemas),
+					},
+				},
+			},
+		}
+		if rt.resp == nil {
+			responses["204"] = map[string]any{"description": "no content"}
+		} else {
+			status := rt.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			responses[strconv.Itoa(status)] = map[string]any{
+				"description": http.StatusText(status),
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema": schemaOf(reflect.TypeOf(rt.resp), schemas),
+					},
+				},
+			}
+		}
+		op["responses"] = responses
+
+		if paths[rt.path] == nil {
+			paths[rt.path] = map[string]any{}
+		}
+		paths[rt.path][strings.ToLower(rt.method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "gogator API",
+			"version": "1",
+		},
+		"servers": []any{map[string]any{"url": apiPrefix}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "gogator API token",
+				},
+			},
+		},
+		"security": []any{map[string]any{"bearerAuth": []any{}}},
+	}
+}
+
+func (a *apiServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.openAPI())
+}
+
+// operationID derives an operation ID such as "deletePostsIdStar" from
+// the route's method and path.
+func operationID(rt apiRoute) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(rt.method))
+	for part := range strings.FieldsFuncSeq(rt.path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '_'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+)
+
+// schemaOf returns the JSON schema of t. Named structs are added to
+// schemas and referenced.
+func schemaOf(t reflect.Type, schemas map[string]any) map[string]any {
+	nullable := false
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var s map[string]any
+	switch {
+	case t == timeType:
+		s = map[string]any{"type": "string", "format": "date-time"}
+	case t == uuidType:
+		s = map[string]any{"type": "string", "format": "uuid"}
+	case t.Kind() == reflect.String:
+		s = map[string]any{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		s = map[string]any{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		s = map[string]any{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		s = map[string]any{"type": "number"}
+	case t.Kind() == reflect.Slice:
+		s = map[string]any{
+			"type":  "array",
+			"items": schemaOf(t.Elem(), schemas),
+		}
+	case t.Kind() == reflect.Struct:
+		name := strings.TrimPrefix(t.Name(), "api")
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = structSchema(t, schemas)
+		}
+		ref := map[string]any{"$ref": "#/components/schemas/" + name}
+		if nullable {
+			return map[string]any{"allOf": []any{ref}, "nullable": true}
+		}
+		return ref
+	default:
+		s = map[string]any{}
+	}
+
+	if nullable {
+		s["nullable"] = true
+	}
+	return s
+}
+
+func structSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	props := map[string]any{}
+	var required []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		props[name] = schemaOf(f.Type, schemas)
+		required = append(required, name)
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": props,
+		"required":   required,
+	}
+}
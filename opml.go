@@ -0,0 +1,54 @@
+package gogator
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+type opmlDoc struct {
+	XMLName xml.Name `xml:"opml"`
+	Body    struct {
+		Outlines []opmlOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+// opmlOutline is a feed when it has an xmlUrl, otherwise a folder of
+// outlines.
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr"`
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlFeed struct {
+	name string
+	url  string
+}
+
+// parseOPML returns the feeds of an OPML subscription list, flattening
+// its folders.
+func parseOPML(r io.Reader) ([]opmlFeed, error) {
+	var doc opmlDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("couldn't parse opml: %w", err)
+	}
+
+	var feeds []opmlFeed
+	var walk func(outlines []opmlOutline)
+	walk = func(outlines []opmlOutline) {
+		for _, o := range outlines {
+			if o.XMLURL != "" {
+				name := o.Title
+				if name == "" {
+					name = o.Text
+				}
+				feeds = append(feeds, opmlFeed{name: name, url: o.XMLURL})
+			}
+			walk(o.Outlines)
+		}
+	}
+	walk(doc.Body.Outlines)
+	return feeds, nil
+}
@@ -0,0 +1,383 @@
+package gogator
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+)
+
+// Output formats accepted by the global --output flag.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatJSONL = "jsonl"
+	formatCSV   = "csv"
+	formatYAML  = "yaml"
+)
+
+var outputFormats = []string{
+	formatTable, formatJSON, formatJSONL, formatCSV, formatYAML,
+}
+
+// maxCellWidth caps the width of a table cell so long descriptions
+// don't wrap the whole table. Structured formats are never truncated.
+const maxCellWidth = 60
+
+// listing is the tabular result of a command. Values are plain Go
+// values (string, time.Time, uuid.UUID, numbers, bool or nil) so each
+// format can encode them natively.
+type listing struct {
+	columns []string
+	rows    [][]any
+}
+
+func newListing(columns ...string) *listing {
+	return &listing{columns: columns}
+}
+
+func (l *listing) add(values ...any) {
+	l.rows = append(l.rows, values)
+}
+
+// printer renders listings to stdout in the format chosen by the user.
+type printer struct {
+	out    io.Writer
+	errOut io.Writer
+	format string
+	fields []string
+}
+
+func newPrinter(format string, fields []string) (*printer, error) {
+	if !slices.Contains(outputFormats, format) {
+		return nil, fmt.Errorf("unknown output format %q, expected one of: %s",
+			format, strings.Join(outputFormats, ", "))
+	}
+	return &printer{
+		out:    os.Stdout,
+		errOut: os.Stderr,
+		format: format,
+		fields: fields,
+	}, nil
+}
+
+// structured reports whether the output is meant for other programs.
+func (p *printer) structured() bool {
+	return p.format != formatTable
+}
+
+// noticef prints a message meant for humans. For structured formats
+// it goes to stderr so stdout only contains the rendered data.
+func (p *printer) noticef(format string, a ...any) {
+	w := p.out
+	if p.structured() {
+		w = p.errOut
+	}
+	fmt.Fprintf(w, format, a...)
+}
+
+func (p *printer) render(l *listing) error {
+	idx, err := p.selectColumns(l.columns)
+	if err != nil {
+		return err
+	}
+
+	cols := make([]string, len(idx))
+	for i, c := range idx {
+		cols[i] = l.columns[c]
+	}
+	rows := make([][]any, len(l.rows))
+	for r, row := range l.rows {
+		rows[r] = make([]any, len(idx))
+		for i, c := range idx {
+			rows[r][i] = row[c]
+		}
+	}
+
+	switch p.format {
+	case formatJSON:
+		return renderJSON(p.out, cols, rows)
+	case formatJSONL:
+		return renderJSONL(p.out, cols, rows)
+	case formatCSV:
+		return renderCSV(p.out, cols, rows)
+	case formatYAML:
+		return renderYAML(p.out, cols, rows)
+	default:
+		return renderTable(p.out, cols, rows)
+	}
+}
+
+// selectColumns returns the indexes of the columns chosen with
+// --fields, or of every column when no fields were given.
+func (p *printer) selectColumns(columns []string) ([]int, error) {
+	if len(p.fields) == 0 {
+		idx := make([]int, len(columns))
+		for i := range columns {
+			idx[i] = i
+		}
+		return idx, nil
+	}
+
+	idx := make([]int, 0, len(p.fields))
+	for _, f := range p.fields {
+		i := slices.Index(columns, f)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown field %q, available fields: %s",
+				f, strings.Join(columns, ", "))
+		}
+		idx = append(idx, i)
+	}
+	return idx, nil
+}
+
+func renderTable(w io.Writer, cols []string, rows [][]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = strings.ToUpper(c)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	cells := make([]string, len(cols))
+	for _, row := range rows {
+		for i, v := range row {
+			cells[i] = tableCell(textValue(v))
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+func tableCell(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "" {
+		return "-"
+	}
+	if utf8.RuneCountInString(s) > maxCellWidth {
+		r := []rune(s)
+		s = string(r[:maxCellWidth-1]) + "…"
+	}
+	return s
+}
+
+func renderCSV(w io.Writer, cols []string, rows [][]any) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(cols); err != nil {
+		return err
+	}
+
+	record := make([]string, len(cols))
+	for _, row := range rows {
+		for i, v := range row {
+			record[i] = textValue(v)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func renderJSON(w io.Writer, cols []string, rows [][]any) error {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for r, row := range rows {
+		if r > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeJSONObject(&buf, cols, row); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func renderJSONL(w io.Writer, cols []string, rows [][]any) error {
+	var buf bytes.Buffer
+	for _, row := range rows {
+		if err := writeJSONObject(&buf, cols, row); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// writeJSONObject encodes a row as a JSON object, keeping the column
+// order instead of the sorted order encoding/json uses for maps.
+func writeJSONObject(buf *bytes.Buffer, cols []string, row []any) error {
+	buf.WriteByte('{')
+	for i, c := range cols {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := marshalJSON(c)
+		if err != nil {
+			return err
+		}
+		v, err := marshalJSON(row[i])
+		if err != nil {
+			return err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// renderYAML writes the rows as a YAML sequence of mappings. Scalars
+// are written as JSON values, which are valid YAML flow scalars.
+func renderYAML(w io.Writer, cols []string, rows [][]any) error {
+	if len(rows) == 0 {
+		_, err := fmt.Fprintln(w, "[]")
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, row := range rows {
+		for i, c := range cols {
+			prefix := "  "
+			if i == 0 {
+				prefix = "- "
+			}
+			v, err := marshalJSON(row[i])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&buf, "%s%s: %s\n", prefix, c, v)
+		}
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// marshalJSON is json.Marshal without HTML escaping, post titles and
+// descriptions are full of markup that should stay readable.
+func marshalJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func textValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// nullString and nullTime turn nullable columns into values that
+// render as null (or an empty cell) instead of a zero value.
+func nullString(ns sql.NullString) any {
+	if !ns.Valid {
+		return nil
+	}
+	return ns.String
+}
+
+func nullTime(nt sql.NullTime) any {
+	if !nt.Valid {
+		return nil
+	}
+	return nt.Time
+}
+
+// globalOptions holds the flags accepted by every command.
+type globalOptions struct {
+	output string
+	fields []string
+	// logLevel and logFormat are empty when not given, so the config
+	// file can set them.
+	logLevel  string
+	logFormat string
+}
+
+// bind defines the global flags in fs, defaulting to the values of o.
+func (o *globalOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.output, "o", o.output, "output format")
+	fs.StringVar(&o.output, "output", o.output, "output format")
+	fs.Func("fields", "comma separated list of columns to print", func(v string) error {
+		o.fields = nil
+		for f := range strings.SplitSeq(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				o.fields = append(o.fields, f)
+			}
+		}
+		return nil
+	})
+	fs.StringVar(&o.logLevel, "log-level", o.logLevel, "level of the logs")
+	fs.StringVar(&o.logFormat, "log-format", o.logFormat, "format of the logs")
+}
+
+// isGlobalFlag reports whether name is the name of a global flag.
+func isGlobalFlag(name string) bool {
+	switch name {
+	case "o", "output", "fields", "log-level", "log-format":
+		return true
+	}
+	return false
+}
+
+// parseGlobalFlags parses the global flags given before the command
+// name, stopping at it or at "--", and returns the arguments from the
+// command name on. The global flags given after the command name are
+// parsed along with the flags of the command, so the arguments of the
+// command are never taken for global flags.
+func parseGlobalFlags(args []string) (globalOptions, []string, error) {
+	opts := globalOptions{output: formatTable}
+	fs := flag.NewFlagSet("gogator", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	opts.bind(fs)
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return opts, []string{"help"}, nil
+	}
+	return opts, fs.Args(), err
+}
+
+// setup sets up logging and returns the printer of the output flags.
+func (o globalOptions) setup() (*printer, error) {
+	err := setupLogging(orDefault(o.logLevel, "info"),
+		orDefault(o.logFormat, logFormatText))
+	if err != nil {
+		return nil, err
+	}
+	return newPrinter(o.output, o.fields)
+}
@@ -0,0 +1,216 @@
+package gogator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prchop/gogator/internal/database"
+)
+
+// cursor is a keyset position in the posts listing. Posts are ordered
+// by their publication time (falling back to the time they were
+// stored) and then by ID, so a cursor is always unambiguous.
+type cursor struct {
+	time time.Time
+	id   uuid.UUID
+}
+
+func postCursor(p database.Post) cursor {
+	t := p.CreatedAt
+	if p.PublishedAt.Valid {
+		t = p.PublishedAt.Time
+	}
+	return cursor{time: t, id: p.ID}
+}
+
+// String encodes the cursor as "<unix microseconds>.<uuid>". Postgres
+// stores timestamps with microsecond precision, so nothing is lost.
+func (c cursor) String() string {
+	return fmt.Sprintf("%d.%s", c.time.UnixMicro(), c.id)
+}
+
+func parseCursor(s string) (cursor, error) {
+	ts, id, ok := strings.Cut(s, ".")
+	if !ok {
+		return cursor{}, fmt.Errorf("invalid cursor %q", s)
+	}
+
+	us, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return cursor{}, fmt.Errorf("invalid cursor %q: %w", s, err)
+	}
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return cursor{}, fmt.Errorf("invalid cursor %q: %w", s, err)
+	}
+	return cursor{time: time.UnixMicro(us).UTC(), id: uid}, nil
+}
+
+// parseAge parses a duration like time.ParseDuration does, but also
+// accepts a whole number of days such as "7d".
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// formatAge formats a duration the way parseAge reads it, in days
+// when it is a whole number of them.
+func formatAge(d time.Duration) string {
+	day := 24 * time.Hour
+	if d >= day && d%day == 0 {
+		return strconv.Itoa(int(d/day)) + "d"
+	}
+	return d.String()
+}
+
+// postFilter selects a page of posts. It is shared by browse and the
+// HTTP API so both page and filter the same way.
+type postFilter struct {
+	limit  int
+	before string
+	after  string
+	feed   string
+	since  string
+	order  string
+	// userID is needed by unread and starred, which are per user.
+	userID  uuid.UUID
+	unread  bool
+	starred bool
+}
+
+// params validates the filter and converts it to query parameters.
+// The feed is resolved separately since it needs the database.
+func (f postFilter) params() (database.GetPostsNewestParams, error) {
+	if f.limit <= 0 {
+		return database.GetPostsNewestParams{},
+			errors.New("limit must be greater than zero")
+	}
+	if f.limit > math.MaxInt32 {
+		return database.GetPostsNewestParams{},
+			fmt.Errorf("limit must be at most %d", math.MaxInt32)
+	}
+	if f.order != "newest" && f.order != "oldest" {
+		return database.GetPostsNewestParams{},
+			fmt.Errorf("unknown order %q, expected newest or oldest", f.order)
+	}
+
+	params := database.GetPostsNewestParams{
+		Limit:       int32(f.limit),
+		UnreadOnly:  f.unread,
+		StarredOnly: f.starred,
+	}
+	if f.userID != uuid.Nil {
+		params.UserID = uuid.NullUUID{UUID: f.userID, Valid: true}
+	}
+
+	if f.since != "" {
+		d, err := parseAge(f.since)
+		if err != nil {
+			return database.GetPostsNewestParams{}, err
+		}
+		params.Since = sql.NullTime{Time: time.Now().UTC().Add(-d), Valid: true}
+	}
+
+	if f.before != "" {
+		c, err := parseCursor(f.before)
+		if err != nil {
+			return database.GetPostsNewestParams{}, err
+		}
+		params.BeforeTime = sql.NullTime{Time: c.time, Valid: true}
+		params.BeforeID = uuid.NullUUID{UUID: c.id, Valid: true}
+	}
+
+	if f.after != "" {
+		c, err := parseCursor(f.after)
+		if err != nil {
+			return database.GetPostsNewestParams{}, err
+		}
+		params.AfterTime = sql.NullTime{Time: c.time, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: c.id, Valid: true}
+	}
+	return params, nil
+}
+
+// postStore is the part of the database used to list posts.
+type postStore interface {
+	feedFinder
+	GetPostsNewest(ctx context.Context, arg database.GetPostsNewestParams) ([]database.Post, error)
+	GetPostsOldest(ctx context.Context, arg database.GetPostsOldestParams) ([]database.Post, error)
+}
+
+// queryPosts returns a page of posts in the order asked for.
+func queryPosts(ctx context.Context, db postStore, f postFilter) ([]database.Post, error) {
+	params, err := f.params()
+	if err != nil {
+		return nil, err
+	}
+
+	if f.feed != "" {
+		feed, err := resolveFeed(ctx, db, f.feed)
+		if err != nil {
+			return nil, err
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	// Keyset pages must be read starting from the cursor, so paging
+	// towards the "wrong" end of the requested order is done by
+	// querying in the opposite direction and reversing the result.
+	newest := f.order == "newest"
+	descending := newest
+	if newest && f.after != "" && f.before == "" {
+		descending = false
+	}
+	if !newest && f.before != "" && f.after == "" {
+		descending = true
+	}
+
+	var posts []database.Post
+	if descending {
+		posts, err = db.GetPostsNewest(ctx, params)
+	} else {
+		posts, err = db.GetPostsOldest(ctx,
+			database.GetPostsOldestParams(params))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get the posts: %w", err)
+	}
+	if descending != newest {
+		slices.Reverse(posts)
+	}
+	return posts, nil
+}
+
+// pageCursors returns the cursors of the pages after and before posts,
+// in the order they were returned by queryPosts.
+func pageCursors(posts []database.Post) (next, prev string) {
+	if len(posts) == 0 {
+		return "", ""
+	}
+	first := postCursor(posts[0]).String()
+	last := postCursor(posts[len(posts)-1]).String()
+	return last, first
+}
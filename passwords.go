@@ -0,0 +1,59 @@
+package gogator
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/prchop/gogator/internal/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const minPasswordLen = 8
+
+// errBadCredentials is returned for a wrong username or password alike,
+// so the error doesn't reveal which users exist.
+var errBadCredentials = fmt.Errorf("wrong username or password: %w",
+	errUnauthorized)
+
+func validatePassword(cmd, password string) error {
+	switch {
+	case len(password) < minPasswordLen:
+		return usageErrorf(cmd, "the password must be at least %d characters",
+			minPasswordLen)
+	case len(password) > 72:
+		// bcrypt only uses the first 72 bytes.
+		return usageErrorf(cmd, "the password must be at most 72 bytes")
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("couldn't hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// dummyHash is compared against when a user has no password, so that
+// checking takes as long as for a real one.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("gogator"), bcrypt.DefaultCost)
+	return hash
+})
+
+// checkPassword verifies the password of a user. Users without a
+// password never match.
+func checkPassword(user database.User, password string) error {
+	hash := dummyHash()
+	if user.PasswordHash.Valid {
+		hash = []byte(user.PasswordHash.String)
+	}
+
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) || !user.PasswordHash.Valid {
+		return errBadCredentials
+	}
+	return err
+}
@@ -0,0 +1,303 @@
+package gogator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prchop/gogator/internal/config"
+	"golang.org/x/time/rate"
+)
+
+// The limits of a host when the config file sets none, so that many
+// feeds on a host never hammer it.
+var defaultHostLimits = hostLimits{
+	rate:        rate.Inf,
+	burst:       1,
+	concurrency: 2,
+	interval:    time.Second,
+}
+
+// hostLimits are the parsed config.HostLimits.
+type hostLimits struct {
+	rate        rate.Limit
+	burst       int
+	concurrency int
+	interval    time.Duration
+}
+
+// parseHostLimits parses l, taking what it doesn't set from def.
+func parseHostLimits(l config.HostLimits, def hostLimits) (hostLimits, error) {
+	switch {
+	case l.Rate < 0:
+		return hostLimits{}, fmt.Errorf("rate %v is negative", l.Rate)
+	case l.Burst < 0:
+		return hostLimits{}, fmt.Errorf("burst %d is negative", l.Burst)
+	case l.MaxConcurrency < 0:
+		return hostLimits{}, fmt.Errorf("max_concurrency %d is negative",
+			l.MaxConcurrency)
+	}
+
+	hl := def
+	if l.Rate > 0 {
+		hl.rate = rate.Limit(l.Rate)
+	}
+	if l.Burst > 0 {
+		hl.burst = l.Burst
+	}
+	if l.MaxConcurrency > 0 {
+		hl.concurrency = l.MaxConcurrency
+	}
+	if l.MinInterval != "" {
+		d, err := time.ParseDuration(l.MinInterval)
+		if err != nil || d < 0 {
+			return hostLimits{}, fmt.Errorf("invalid min_interval %q", l.MinInterval)
+		}
+		hl.interval = d
+	}
+	return hl, nil
+}
+
+// politeness makes fetches wait for their turn on the host they
+// request, like a well-mannered crawler: each host has a maximum of
+// requests in flight, a rate and a minimum interval between requests.
+type politeness struct {
+	mu      sync.Mutex
+	global  hostLimits
+	domains map[string]hostLimits
+	queues  map[string]*hostQueue
+}
+
+// hostQueue holds the turns of a host, or of all the hosts of a domain
+// with limits of its own.
+type hostQueue struct {
+	limiter *rate.Limiter
+
+	mu     sync.Mutex
+	limits hostLimits
+	// inFlight counts the requests holding a slot, up to the concurrency
+	// of the limits, and freed is closed when a slot may have been freed.
+	inFlight int
+	freed    chan struct{}
+	// next is the earliest time of the next request.
+	next time.Time
+}
+
+func newHostQueue(limits hostLimits) *hostQueue {
+	return &hostQueue{
+		limits:  limits,
+		limiter: rate.NewLimiter(limits.rate, limits.burst),
+		freed:   make(chan struct{}),
+	}
+}
+
+// acquire blocks until a slot is free and takes it.
+func (q *hostQueue) acquire(ctx context.Context) error {
+	for {
+		q.mu.Lock()
+		if q.inFlight < q.limits.concurrency {
+			q.inFlight++
+			q.mu.Unlock()
+			return nil
+		}
+		freed := q.freed
+		q.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (q *hostQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.inFlight--
+	q.wake()
+}
+
+// setLimits changes the limits of q, keeping its requests in flight and
+// its next turn.
+func (q *hostQueue) setLimits(limits hostLimits) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if limits == q.limits {
+		return
+	}
+	q.limits = limits
+	q.limiter.SetLimit(limits.rate)
+	q.limiter.SetBurst(limits.burst)
+	q.wake()
+}
+
+// wake lets the requests waiting for a slot check again. q.mu must be
+// held.
+func (q *hostQueue) wake() {
+	close(q.freed)
+	q.freed = make(chan struct{})
+}
+
+func newPoliteness(cfg *config.Politeness) (*politeness, error) {
+	p := &politeness{}
+	if err := p.configure(cfg); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// configure sets the limits from the config file. The queues keep the
+// requests in flight and their turns, so a host that backed off stays
+// so. A host that moves in or out of a domain gets a new queue.
+func (p *politeness) configure(cfg *config.Politeness) error {
+	if cfg == nil {
+		cfg = &config.Politeness{}
+	}
+	global, err := parseHostLimits(cfg.HostLimits, defaultHostLimits)
+	if err != nil {
+		return fmt.Errorf("error in config: politeness: %w", err)
+	}
+	domains := make(map[string]hostLimits, len(cfg.Domains))
+	for d, l := range cfg.Domains {
+		hl, err := parseHostLimits(l, global)
+		if err != nil {
+			return fmt.Errorf("error in config: politeness of %s: %w", d, err)
+		}
+		domains[strings.ToLower(strings.Trim(d, "."))] = hl
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.global = global
+	p.domains = domains
+	if p.queues == nil {
+		p.queues = make(map[string]*hostQueue)
+	}
+	for key, q := range p.queues {
+		// Requests in flight on a dropped queue still release it.
+		k, limits := p.resolve(key)
+		if k != key {
+			delete(p.queues, key)
+			continue
+		}
+		q.setLimits(limits)
+	}
+	return nil
+}
+
+// resolve returns the key of the queue of host and its limits. p.mu must
+// be held.
+func (p *politeness) resolve(host string) (string, hostLimits) {
+	key, limits, domain := host, p.global, ""
+	for d, l := range p.domains {
+		if (host == d || strings.HasSuffix(host, "."+d)) && len(d) > len(domain) {
+			key, limits, domain = d, l, d
+		}
+	}
+	return key, limits
+}
+
+// queue returns the queue of host. A host in a domain of the config
+// file shares the queue of the domain, the most specific one when
+// several match, and any other host has its own.
+func (p *politeness) queue(host string) *hostQueue {
+	host = strings.ToLower(host)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, limits := p.resolve(host)
+	q, ok := p.queues[key]
+	if !ok {
+		q = newHostQueue(limits)
+		p.queues[key] = q
+	}
+	return q
+}
+
+// backedOffError is returned by wait when the server of a host asked
+// not to be requested until after the deadline of the fetch.
+type backedOffError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e *backedOffError) Error() string {
+	return fmt.Sprintf("%s backed off until %s", e.Host,
+		e.Until.UTC().Format(time.RFC3339))
+}
+
+// backedOff returns when host may be requested again, if that is after
+// deadline.
+func (p *politeness) backedOff(host string, deadline time.Time) (time.Time, bool) {
+	q := p.queue(host)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.next, q.next.After(deadline)
+}
+
+// wait blocks until host may be requested, returning the function to
+// call once the request is done. It fails with a *backedOffError rather
+// than wait past the deadline of ctx for a host that backed off.
+func (p *politeness) wait(ctx context.Context, host string) (func(), error) {
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		if until, ok := p.backedOff(host, deadline); ok {
+			return nil, &backedOffError{Host: host, Until: until}
+		}
+	}
+	q := p.queue(host)
+
+	if err := q.acquire(ctx); err != nil {
+		return nil, err
+	}
+	release := q.release
+
+	if err := q.limiter.Wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+
+	// Take the next turn, then wait for it.
+	q.mu.Lock()
+	at := time.Now()
+	if q.next.After(at) {
+		at = q.next
+	}
+	if hasDeadline && at.After(deadline) {
+		q.mu.Unlock()
+		release()
+		return nil, &backedOffError{Host: host, Until: at}
+	}
+	q.next = at.Add(q.limits.interval)
+	q.mu.Unlock()
+
+	if d := time.Until(at); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+// maxBackoff bounds how long a server may ask not to be requested.
+const maxBackoff = time.Hour
+
+// backoff holds the requests to host for d, when its server asks to be
+// requested later.
+func (p *politeness) backoff(host string, d time.Duration) {
+	q := p.queue(host)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if at := time.Now().Add(min(d, maxBackoff)); at.After(q.next) {
+		q.next = at
+	}
+}
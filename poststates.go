@@ -0,0 +1,52 @@
+package gogator
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prchop/gogator/internal/database"
+)
+
+// postStateStore is the part of the database used to set post states.
+type postStateStore interface {
+	MarkPostRead(ctx context.Context, arg database.MarkPostReadParams) error
+	MarkPostUnread(ctx context.Context, arg database.MarkPostUnreadParams) error
+	StarPost(ctx context.Context, arg database.StarPostParams) error
+	UnstarPost(ctx context.Context, arg database.UnstarPostParams) error
+}
+
+// setPostRead marks a post read or unread for a user. It is shared by
+// the server APIs, which all map their own flags onto it.
+func setPostRead(ctx context.Context, db postStateStore,
+	userID, postID uuid.UUID, read bool,
+) error {
+	if read {
+		return db.MarkPostRead(ctx, database.MarkPostReadParams{
+			UserID: userID,
+			PostID: postID,
+			ReadAt: time.Now().UTC(),
+		})
+	}
+	return db.MarkPostUnread(ctx, database.MarkPostUnreadParams{
+		UserID: userID,
+		PostID: postID,
+	})
+}
+
+// setPostStarred stars or unstars a post for a user.
+func setPostStarred(ctx context.Context, db postStateStore,
+	userID, postID uuid.UUID, star bool,
+) error {
+	if star {
+		return db.StarPost(ctx, database.StarPostParams{
+			UserID:    userID,
+			PostID:    postID,
+			StarredAt: time.Now().UTC(),
+		})
+	}
+	return db.UnstarPost(ctx, database.UnstarPostParams{
+		UserID: userID,
+		PostID: postID,
+	})
+}
@@ -0,0 +1,89 @@
+package gogator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// stdin is shared by the prompts so that the lines piped to successive
+// prompts aren't lost in a discarded buffer.
+var stdin = bufio.NewReader(os.Stdin)
+
+// readPassword prompts for a password on stderr and reads it from
+// stdin without echoing it. When stdin isn't a terminal, the password
+// is read from the next line, so it can be piped in by scripts.
+func readPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := stdin.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("couldn't read password: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("couldn't read password: %w", err)
+	}
+	return string(b), nil
+}
+
+// readNewPassword reads a password to set. On a terminal it must be
+// typed twice.
+func readNewPassword(cmd string, prompt string) (string, error) {
+	password, err := readPassword(prompt)
+	if err != nil {
+		return "", err
+	}
+	if err := validatePassword(cmd, password); err != nil {
+		return "", err
+	}
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		again, err := readPassword("Confirm password: ")
+		if err != nil {
+			return "", err
+		}
+		if again != password {
+			return "", usageErrorf(cmd, "the passwords don't match")
+		}
+	}
+	return password, nil
+}
+
+// errAborted is returned when the user doesn't confirm an action.
+var errAborted = errors.New("aborted")
+
+// confirm asks before a destructive action, unless --yes was given.
+// Without a terminal to ask on, --yes is required.
+func confirm(cmd command, question string) error {
+	if cmd.flagBool("yes") {
+		return nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return usageErrorf(cmd.name,
+			"%s needs confirmation, pass --yes to run it without a terminal",
+			cmd.name)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	line, err := stdin.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("couldn't read answer: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return nil
+	default:
+		return errAborted
+	}
+}
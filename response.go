@@ -0,0 +1,158 @@
+package gogator
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// acceptEncoding lists the encodings decodeContent supports. Setting it
+// stops the transport from decoding gzip by itself.
+const acceptEncoding = "gzip, deflate, br"
+
+// acceptFeeds prefers the media types of feeds.
+const acceptFeeds = "application/rss+xml, application/rdf+xml;q=0.9, " +
+	"application/xml;q=0.8, text/xml;q=0.8, */*;q=0.1"
+
+var (
+	// errBodyTooLarge is returned when a response is larger than the
+	// max_body_size setting.
+	errBodyTooLarge = errors.New("response body too large")
+	// errNotAFeed is returned when a response isn't XML, such as the
+	// HTML page of a moved feed.
+	errNotAFeed = errors.New("response is not a feed")
+)
+
+// statusError is returned for a response whose status isn't a success.
+type statusError struct {
+	Code   int
+	Status string
+	// RetryAfter is when the server asks to be requested again, zero
+	// when it doesn't say.
+	RetryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	msg := "unexpected status " + e.Status
+	if e.RetryAfter > 0 {
+		msg += ", retry after " + e.RetryAfter.String()
+	}
+	return msg
+}
+
+// Temporary reports whether the request may succeed later, which is
+// the case of rate limits and server errors.
+func (e *statusError) Temporary() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+// checkStatus returns a *statusError unless res is a success.
+func checkStatus(res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	status := res.Status
+	if status == "" {
+		status = strconv.Itoa(res.StatusCode)
+	}
+	return &statusError{
+		Code:       res.StatusCode,
+		Status:     status,
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter parses a Retry-After header, in seconds or a date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now).Round(time.Second)
+	}
+	return 0
+}
+
+// decodeContent undoes the Content-Encoding of a response.
+func decodeContent(r io.Reader, encoding string) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return r, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		// Deflate should be wrapped in zlib, but some servers send it
+		// raw. A zlib header is 2 bytes whose value is a multiple of 31.
+		br := bufio.NewReader(r)
+		h, err := br.Peek(2)
+		if err == nil && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	case "br":
+		return brotli.NewReader(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// limitedReader fails with errBodyTooLarge once more than limit bytes
+// are read.
+type limitedReader struct {
+	r     io.Reader
+	read  int64
+	limit int64
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+	if r.read > r.limit {
+		return 0, fmt.Errorf("%w: over %d bytes", errBodyTooLarge, r.limit)
+	}
+	return n, err
+}
+
+// checkFeedType fails unless the body in r is likely a feed. Feeds
+// are often served as text/html, text/plain or application/octet-stream,
+// so a body of another type is sniffed and accepted when it starts like
+// an XML document.
+func checkFeedType(r *bufio.Reader, contentType string) error {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/xml" || mediaType == "text/xml" ||
+		strings.HasSuffix(mediaType, "+xml") {
+		return nil
+	}
+
+	// Peek fails at the end of short bodies, which are still sniffed.
+	head, err := r.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	head = bytes.TrimLeft(head, " \t\r\n")
+	for _, prefix := range []string{"<?xml", "<rss", "<rdf:RDF", "<!--"} {
+		if bytes.HasPrefix(head, []byte(prefix)) {
+			return nil
+		}
+	}
+	if contentType == "" {
+		contentType = "no content type"
+	}
+	return fmt.Errorf("%w: %s", errNotAFeed, contentType)
+}
@@ -0,0 +1,231 @@
+package gogator
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+const testFeedXML = `<?xml version="1.0"?><rss version="2.0"><channel>` +
+	`<title>Test</title><item><title>Post</title><link>https://example.com/1</link></item>` +
+	`</channel></rss>`
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	case "flate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		t.Fatalf("unknown encoding %q", encoding)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeContent(t *testing.T) {
+	plain := []byte(testFeedXML)
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		wantErr  bool
+	}{
+		{name: "none", encoding: "", body: plain},
+		{name: "identity", encoding: "identity", body: plain},
+		{name: "gzip", encoding: "gzip", body: compress(t, "gzip", plain)},
+		{name: "x-gzip", encoding: "x-gzip", body: compress(t, "gzip", plain)},
+		{name: "zlib deflate", encoding: "deflate", body: compress(t, "zlib", plain)},
+		{name: "raw deflate", encoding: "deflate", body: compress(t, "flate", plain)},
+		{name: "brotli", encoding: "br", body: compress(t, "br", plain)},
+		{name: "case and spaces", encoding: " GZip ", body: compress(t, "gzip", plain)},
+		{name: "unsupported", encoding: "compress", body: plain, wantErr: true},
+		{name: "corrupt gzip", encoding: "gzip", body: plain, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := decodeContent(bytes.NewReader(tt.body), tt.encoding)
+			if tt.wantErr {
+				if err == nil {
+					_, err = io.ReadAll(r)
+				}
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("got %q, want %q", got, plain)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"0", 0},
+		{"-5", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{"Mon, 19 Oct 2026 12:30:00 GMT", 30 * time.Minute},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0},
+		{now.Add(time.Hour).Format(time.RFC850), time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+	tests := []struct {
+		code       int
+		retryAfter string
+		wantErr    bool
+		temporary  bool
+		wantRetry  time.Duration
+	}{
+		{code: http.StatusOK},
+		{code: http.StatusNoContent},
+		{code: http.StatusNotFound, wantErr: true},
+		{code: http.StatusTooManyRequests, retryAfter: "30", wantErr: true,
+			temporary: true, wantRetry: 30 * time.Second},
+		{code: http.StatusServiceUnavailable, wantErr: true, temporary: true},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.code), func(t *testing.T) {
+			res := &http.Response{StatusCode: tt.code, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				res.Header.Set("Retry-After", tt.retryAfter)
+			}
+			err := checkStatus(res)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("got %v, want no error", err)
+				}
+				return
+			}
+
+			var se *statusError
+			if !errors.As(err, &se) {
+				t.Fatalf("got %v, want a *statusError", err)
+			}
+			if se.Code != tt.code || se.Temporary() != tt.temporary || se.RetryAfter != tt.wantRetry {
+				t.Errorf("got %+v, temporary %v, want code %d, temporary %v, retry after %v",
+					se, se.Temporary(), tt.code, tt.temporary, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestCheckFeedType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantErr     bool
+	}{
+		{name: "rss type", contentType: "application/rss+xml", body: "anything"},
+		{name: "xml type", contentType: "text/xml; charset=utf-8", body: "anything"},
+		{name: "html with xml", contentType: "text/html", body: testFeedXML},
+		{name: "no type with rss", contentType: "", body: "\n  <rss version=\"2.0\">"},
+		{name: "octet-stream with bom", contentType: "application/octet-stream",
+			body: "\xef\xbb\xbf<?xml version=\"1.0\"?><rss/>"},
+		{name: "rdf", contentType: "text/plain", body: "<rdf:RDF>"},
+		{name: "html page", contentType: "text/html", body: "<!doctype html><html>",
+			wantErr: true},
+		{name: "empty", contentType: "text/plain", body: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkFeedType(bufio.NewReader(strings.NewReader(tt.body)), tt.contentType)
+			if tt.wantErr != errors.Is(err, errNotAFeed) {
+				t.Errorf("got %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseFeedBodyLimit(t *testing.T) {
+	// A feed padded with a comment compresses far below its size.
+	padded := []byte(strings.Replace(testFeedXML, "<channel>",
+		"<!--"+strings.Repeat(" ", 64<<10)+"--><channel>", 1))
+	gzipped := compress(t, "gzip", padded)
+	if len(gzipped) > 1<<10 {
+		t.Fatalf("the compressed feed is %d bytes, want it under 1KiB", len(gzipped))
+	}
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		limit    int64
+		wantErr  bool
+	}{
+		{name: "plain under the limit", body: padded, limit: 128 << 10},
+		{name: "plain over the limit", body: padded, limit: 32 << 10, wantErr: true},
+		{name: "gzip under the limit", encoding: "gzip", body: gzipped, limit: 128 << 10},
+		// The limit applies to the decompressed body, not to what is
+		// received.
+		{name: "gzip over the limit", encoding: "gzip", body: gzipped, limit: 32 << 10,
+			wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			h.Set("Content-Type", "application/rss+xml")
+			h.Set("Content-Encoding", tt.encoding)
+			feed, err := parseFeed(t.Context(), bytes.NewReader(tt.body), h, tt.limit)
+			if tt.wantErr {
+				if !errors.Is(err, errBodyTooLarge) {
+					t.Fatalf("got %v, want errBodyTooLarge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(feed.Channel.Item) != 1 {
+				t.Errorf("got %d items, want 1", len(feed.Channel.Item))
+			}
+		})
+	}
+}
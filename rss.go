@@ -1,16 +1,28 @@
 package gogator
 
 import (
+	"bufio"
 	"context"
+	"crypto/cipher"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"html"
 	"io"
-	"log"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/prchop/gogator/internal/config"
 	"github.com/prchop/gogator/internal/database"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/httptrace/otelhttptrace"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/html/charset"
 )
 
 type RSSFeed struct {
@@ -31,7 +43,132 @@ type RSSItem struct {
 	PubDate string `xml:"pubDate"`
 }
 
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
+// fetcher downloads feeds, shared by the fetches of a command.
+type fetcher struct {
+	hosts   *politeness
+	clients *httpClients
+
+	mu sync.Mutex
+	// aead decrypts the credentials of the feeds, unless aeadErr says why
+	// there is no key.
+	aead    cipher.AEAD
+	aeadErr error
+}
+
+func newFetcher(cfg *config.Settings) (*fetcher, error) {
+	hosts, err := newPoliteness(cfg.Politeness)
+	if err != nil {
+		return nil, err
+	}
+	clients, err := newHTTPClients(cfg.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	f := &fetcher{hosts: hosts, clients: clients}
+	f.aead, f.aeadErr = newCredentialsCipher(cfg.CredentialsKey)
+	return f, nil
+}
+
+// configure applies the config file reloaded by agg.
+func (f *fetcher) configure(cfg *config.Settings) error {
+	if err := f.hosts.configure(cfg.Politeness); err != nil {
+		return err
+	}
+	if err := f.clients.configure(cfg.HTTP); err != nil {
+		return err
+	}
+	aead, aeadErr := newCredentialsCipher(cfg.CredentialsKey)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aead, f.aeadErr = aead, aeadErr
+	return nil
+}
+
+// credentialsCipher returns the cipher of the credentials, or why there
+// is none.
+func (f *fetcher) credentialsCipher() (cipher.AEAD, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.aead, f.aeadErr
+}
+
+// fetchFeed downloads and parses a feed. The body is decoded as it is
+// received rather than buffered, within the max_body_size setting. creds
+// authenticate the request when not nil.
+func (f *fetcher) fetchFeed(ctx context.Context, feedURL string, creds *feedCredentials,
+) (*RSSFeed, error) {
+	release, err := f.waitHost(ctx, feedURL)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	client, cs := f.clients.client(feedURL)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	res, err := f.get(ctx, client, cs, feedURL, creds)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body := newIdleReader(countingReader{res.Body}, cs.readTimeout,
+		func() { cancel(errReadTimeout) })
+	defer body.stop()
+	feed, err := parseFeed(ctx, body, res.Header, cs.maxBodySize)
+	if err != nil {
+		return nil, readTimeoutCause(ctx, err, cs.readTimeout)
+	}
+	return feed, nil
+}
+
+// waitHost waits for the turn of the host of feedURL, returning the
+// function to call once the request is done.
+func (f *fetcher) waitHost(ctx context.Context, feedURL string) (_ func(), err error) {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, err
+	}
+	ctx, span := tracer.Start(ctx, "wait for host",
+		trace.WithAttributes(semconv.ServerAddress(u.Hostname())))
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	release, err := f.hosts.wait(ctx, u.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("couldn't wait for %s: %w", u.Hostname(), err)
+	}
+	if waited := time.Since(start); waited > time.Millisecond {
+		loggerFrom(ctx).Debug("waited for host", "host", u.Hostname(),
+			"waited", waited.Round(time.Millisecond))
+	}
+	return release, nil
+}
+
+// backedOff reports whether the host of feedURL can't be requested
+// before deadline, having asked to be requested later.
+func (f *fetcher) backedOff(feedURL string, deadline time.Time) bool {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return false
+	}
+	_, ok := f.hosts.backedOff(u.Hostname(), deadline)
+	return ok
+}
+
+// get requests feedURL, returning the response when it is a success.
+// The phases of the request, such as the DNS lookup, the connection and
+// the wait for the first byte, are traced as child spans.
+func (f *fetcher) get(ctx context.Context, client *http.Client, cs clientSettings,
+	feedURL string, creds *feedCredentials,
+) (_ *http.Response, err error) {
+	ctx, span := tracer.Start(ctx, "http get", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPRequestMethodGet, semconv.URLFull(feedURL)))
+	defer func() { endSpan(span, err) }()
+
+	ctx = withCredentials(ctx, creds)
+	ctx = httptrace.WithClientTrace(ctx,
+		otelhttptrace.NewClientTrace(ctx, otelhttptrace.WithoutHeaders()))
 	req, err := http.NewRequestWithContext(ctx,
 		http.MethodGet,
 		html.EscapeString(feedURL),
@@ -41,26 +178,71 @@ func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
 		return nil, err
 	}
 
-	req.Header.Set("User-Agent", "gogator")
+	req.Header.Set("User-Agent", cs.userAgent)
+	req.Header.Set("Accept", acceptFeeds)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	if creds != nil {
+		creds.apply(req)
+	}
 
-	client := http.Client{Timeout: 10 * time.Second}
 	res, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
+	feedResponses.WithLabelValues(statusClass(res.StatusCode)).Inc()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode),
+		semconv.NetworkProtocolVersion(fmt.Sprintf("%d.%d", res.ProtoMajor, res.ProtoMinor)),
+		attribute.String("http.response.header.content-type", res.Header.Get("Content-Type")),
+		attribute.String("http.response.header.content-encoding",
+			res.Header.Get("Content-Encoding")))
 
-	b, err := io.ReadAll(res.Body)
+	err = checkStatus(res)
+	if err == nil && res.ContentLength > cs.maxBodySize {
+		err = fmt.Errorf("%w: %d bytes, over %d", errBodyTooLarge,
+			res.ContentLength, cs.maxBodySize)
+	}
 	if err != nil {
+		var se *statusError
+		if errors.As(err, &se) && se.RetryAfter > 0 {
+			f.hosts.backoff(req.URL.Hostname(), se.RetryAfter)
+		}
+		res.Body.Close()
 		return nil, err
 	}
+	return res, nil
+}
 
-	var feed RSSFeed
-	if err := xml.Unmarshal(b, &feed); err != nil {
+// parseFeed decodes the feed in body as it is read, after undoing its
+// Content-Encoding and checking that it looks like a feed. Decoding
+// fails once more than maxSize bytes are decoded.
+func parseFeed(ctx context.Context, body io.Reader, h http.Header, maxSize int64,
+) (_ *RSSFeed, err error) {
+	_, span := tracer.Start(ctx, "parse feed")
+	format := feedFormatUnknown
+	defer func() {
+		if isParseError(err) {
+			feedParseErrors.WithLabelValues(format).Inc()
+		}
+		endSpan(span, err)
+	}()
+
+	decoded, err := decodeContent(body, h.Get("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	limited := &limitedReader{r: decoded, limit: maxSize}
+	r := bufio.NewReader(limited)
+	if err := checkFeedType(r, h.Get("Content-Type")); err != nil {
 		return nil, err
 	}
 
-	fc := feed.Channel
+	feed, format, err := decodeFeed(r)
+	span.SetAttributes(semconv.HTTPResponseBodySize(int(limited.read)))
+	if err != nil {
+		return nil, err
+	}
+
+	fc := &feed.Channel
 	fc.Title = html.UnescapeString(fc.Title)
 	fc.Desc = html.UnescapeString(fc.Desc)
 
@@ -68,49 +250,204 @@ func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
 		fc.Item[i].Title = html.UnescapeString(fc.Item[i].Title)
 		fc.Item[i].Desc = html.UnescapeString(fc.Item[i].Desc)
 	}
+	span.SetAttributes(attribute.Int("feed.items", len(fc.Item)))
 
-	return &feed, nil
+	return feed, nil
 }
 
-func scrapeFeeds(s *state) {
-	ctx := context.Background()
-	dbFeed, err := s.db.GetNextFeedToFetch(ctx)
-	if err != nil {
-		log.Printf("couldn't get feed: %v\n", err)
-		return
+// Formats of the feeds decoded, besides feedFormatRSS, which label the
+// parse errors.
+const (
+	feedFormatRDF     = "rdf"
+	feedFormatUnknown = "unknown"
+)
+
+// rssNamespaces are the namespaces of the elements of RSS 2.0, which has
+// none, and RSS 1.0 and 0.90. The links of other namespaces, such as the
+// self link of Atom, aren't the link of the channel.
+var rssNamespaces = map[string]bool{
+	"":                                       true,
+	"http://purl.org/rss/1.0/":               true,
+	"http://my.netscape.com/rdf/simple/0.9/": true,
+}
+
+// decodeFeed decodes an RSS 2.0 or RSS 1.0 feed token by token, keeping
+// only the fields of the channel and its items. RSS 1.0 puts the items
+// next to the channel rather than in it. It returns the format of the
+// feed, as far as it got, even when it fails.
+func decodeFeed(r io.Reader) (_ *RSSFeed, format string, err error) {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = charset.NewReaderLabel
+
+	var feed RSSFeed
+	var stack []string
+	format = feedFormatUnknown
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, format, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			if format == feedFormatUnknown {
+				switch name {
+				case "rss":
+					format = feedFormatRSS
+				case "RDF":
+					format = feedFormatRDF
+				default:
+					return nil, format, fmt.Errorf("%w: <%s> documents aren't supported",
+						errNotAFeed, name)
+				}
+			}
+			inChannel := len(stack) > 0 && stack[len(stack)-1] == "channel"
+
+			var err error
+			switch {
+			case name == "item":
+				var item RSSItem
+				if err = d.DecodeElement(&item, &t); err == nil {
+					feed.Channel.Item = append(feed.Channel.Item, item)
+				}
+			case inChannel && name == "title":
+				err = d.DecodeElement(&feed.Channel.Title, &t)
+			case inChannel && name == "link" && rssNamespaces[t.Name.Space]:
+				err = d.DecodeElement(&feed.Channel.Link, &t)
+			case inChannel && name == "description":
+				err = d.DecodeElement(&feed.Channel.Desc, &t)
+			default:
+				stack = append(stack, name)
+			}
+			if err != nil {
+				return nil, format, err
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if format == feedFormatUnknown {
+		return nil, format, fmt.Errorf("%w: empty document", errNotAFeed)
 	}
+	return &feed, format, nil
+}
 
-	err = s.db.MarkFeedFetched(ctx,
-		database.MarkFeedFetchedParams{
-			UpdatedAt: time.Now().UTC(),
-			UserID:    dbFeed.UserID,
-		},
-	)
+// collectFeed fetches a feed and stores its posts, returning the
+// number of items the feed contained and of new posts among them. A
+// success is recorded along with the posts, so a feed is never marked
+// fetched without its posts.
+func collectFeed(ctx context.Context, s *state, feed database.Feed) (found, created int, err error) {
+	ctx, span := tracer.Start(ctx, "collect feed", trace.WithAttributes(
+		attribute.String("feed.id", feed.ID.String()),
+		attribute.String("feed.url", feed.Url)))
+	feedFetchesInFlight.Inc()
+	start := time.Now()
+	defer func() {
+		endSpan(span, err)
+		feedFetchesInFlight.Dec()
+		feedFetchDuration.Observe(time.Since(start).Seconds())
+		feedFetches.WithLabelValues(fetchResult(err)).Inc()
+	}()
+
+	// The attempt is recorded once its outcome is known: with the posts
+	// when it succeeds, and on its own when it fails.
+	attempted := time.Now().UTC()
+	defer func() {
+		if err != nil {
+			markAttempted(ctx, s, feed.ID, attempted)
+		}
+	}()
+
+	creds, err := loadCredentials(ctx, s, feed.ID)
 	if err != nil {
-		log.Printf("couldn't mark feed to fetched: %v\n", err)
-		return
+		return 0, 0, err
 	}
+	logger := loggerFrom(ctx)
+	rss, err := s.fetcher.fetchFeed(ctx, feed.Url, creds)
+	if err != nil {
+		return 0, 0, err
+	}
+	logger.Debug("feed parsed", "items", len(rss.Channel.Item))
 
-	rss, err := fetchFeed(ctx, dbFeed.Url)
+	n, err := storePosts(ctx, s, feed, attempted, rss.Channel.Item)
 	if err != nil {
-		log.Printf("couldn't fetch feed: %v\n", err)
-		return
+		return 0, 0, err
 	}
+	postsCreated.Add(float64(n))
+	postsDuplicate.Add(float64(int64(len(rss.Channel.Item)) - n))
+	logger.Debug("posts saved", "new", n)
+	return len(rss.Channel.Item), int(n), nil
+}
 
-	for _, ri := range rss.Channel.Item {
-		savePost(ctx, s, ri, dbFeed.ID)
+// markAttempted records a failed attempt at fetching a feed, even when
+// ctx ended, so that the feed waits for its next turn.
+func markAttempted(ctx context.Context, s *state, feedID uuid.UUID, at time.Time) {
+	err := s.db.MarkFeedAttempted(context.WithoutCancel(ctx),
+		database.MarkFeedAttemptedParams{ID: feedID, AttemptedAt: at})
+	if err != nil {
+		loggerFrom(ctx).Error("couldn't mark feed attempted", "err", err)
 	}
+}
 
-	log.Printf("feed %q collected, %v posts found",
-		dbFeed.Name, len(rss.Channel.Item))
+// storePosts saves the items of feed and marks it fetched by the attempt
+// started at attempted, returning the number of new posts.
+func storePosts(ctx context.Context, s *state, feed database.Feed, attempted time.Time,
+	items []RSSItem,
+) (created int64, err error) {
+	ctx, span := tracer.Start(ctx, "store posts")
+	defer func() {
+		span.SetAttributes(attribute.Int64("posts.created", created))
+		endSpan(span, err)
+	}()
+
+	err = s.inTx(ctx, func(q *database.Queries) error {
+		for _, ri := range items {
+			n, err := savePost(ctx, q, ri, feed.ID)
+			if err != nil {
+				return fmt.Errorf("couldn't save post %q: %w", ri.Link, err)
+			}
+			created += n
+		}
+
+		err := q.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
+			ID:          feed.ID,
+			FetchedAt:   time.Now().UTC(),
+			AttemptedAt: attempted,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't mark feed fetched: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return created, nil
 }
 
-func savePost(ctx context.Context, s *state, ri RSSItem,
+// savePost stores a post, returning 1 when it is new and 0 when it was
+// already collected.
+func savePost(ctx context.Context, q *database.Queries, ri RSSItem,
 	feedID uuid.UUID,
-) error {
+) (n int64, err error) {
+	ctx, span := tracer.Start(ctx, "CreatePost",
+		trace.WithAttributes(attribute.String("post.url", ri.Link)))
+	defer func() {
+		span.SetAttributes(attribute.Bool("post.new", n > 0))
+		endSpan(span, err)
+	}()
+
 	desc := database.ToNullString(ri.Desc)
 	pubdate := database.ToNullTime(ri.PubDate)
-	err := s.db.CreatePost(ctx, database.CreatePostParams{
+	if !pubdate.Valid && ri.PubDate != "" {
+		loggerFrom(ctx).Warn("couldn't parse publication date",
+			"post_url", ri.Link, "pub_date", ri.PubDate)
+	}
+	return q.CreatePost(ctx, database.CreatePostParams{
 		ID:          uuid.New(),
 		CreatedAt:   time.Now().UTC(),
 		UpdatedAt:   time.Now().UTC(),
@@ -120,8 +457,4 @@ func savePost(ctx context.Context, s *state, ri RSSItem,
 		PublishedAt: pubdate,
 		FeedID:      feedID,
 	})
-	if err != nil {
-		return err
-	}
-	return nil
 }
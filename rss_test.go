@@ -0,0 +1,144 @@
+package gogator
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeFeed(t *testing.T) {
+	tests := []struct {
+		name       string
+		xml        string
+		wantFormat string
+		want       RSSChannel
+		wantErr    error
+	}{
+		{
+			name: "rss 2.0",
+			xml: `<?xml version="1.0"?>
+<rss version="2.0"><channel>
+  <title>Blog</title><link>https://example.com/</link><description>Posts</description>
+  <item><title>One</title><link>https://example.com/1</link>
+    <description>First</description><pubDate>Mon, 19 Oct 2026 12:00:00 +0000</pubDate></item>
+  <item><title>Two</title><link>https://example.com/2</link></item>
+</channel></rss>`,
+			wantFormat: feedFormatRSS,
+			want: RSSChannel{Title: "Blog", Link: "https://example.com/", Desc: "Posts",
+				Item: []RSSItem{
+					{Title: "One", Link: "https://example.com/1", Desc: "First",
+						PubDate: "Mon, 19 Oct 2026 12:00:00 +0000"},
+					{Title: "Two", Link: "https://example.com/2"},
+				}},
+		},
+		{
+			// RSS 1.0 puts the items next to the channel.
+			name: "rss 1.0 items outside the channel",
+			xml: `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">
+  <channel rdf:about="https://example.com/"><title>Blog</title>
+    <link>https://example.com/</link><description>Posts</description>
+    <items><rdf:Seq><rdf:li rdf:resource="https://example.com/1"/></rdf:Seq></items>
+  </channel>
+  <item rdf:about="https://example.com/1"><title>One</title><link>https://example.com/1</link></item>
+  <item rdf:about="https://example.com/2"><title>Two</title><link>https://example.com/2</link></item>
+</rdf:RDF>`,
+			wantFormat: feedFormatRDF,
+			want: RSSChannel{Title: "Blog", Link: "https://example.com/", Desc: "Posts",
+				Item: []RSSItem{
+					{Title: "One", Link: "https://example.com/1"},
+					{Title: "Two", Link: "https://example.com/2"},
+				}},
+		},
+		{
+			// The titles of images and items aren't the channel's.
+			name: "nested titles",
+			xml: `<rss><channel><image><title>Logo</title><link>https://example.com/logo</link></image>
+  <item><title>One</title></item><title>Blog</title></channel></rss>`,
+			wantFormat: feedFormatRSS,
+			want:       RSSChannel{Title: "Blog", Item: []RSSItem{{Title: "One"}}},
+		},
+		{
+			name: "atom link in the channel",
+			xml: `<rss xmlns:atom="http://www.w3.org/2005/Atom"><channel>
+  <atom:link href="https://example.com/feed" rel="self"/><link>https://example.com/</link>
+</channel></rss>`,
+			wantFormat: feedFormatRSS,
+			want:       RSSChannel{Link: "https://example.com/"},
+		},
+		{
+			name:       "latin1",
+			xml:        "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><rss><channel><title>Caf\xe9</title></channel></rss>",
+			wantFormat: feedFormatRSS,
+			want:       RSSChannel{Title: "Café"},
+		},
+		{
+			name:       "no items",
+			xml:        `<rss><channel><title>Empty</title></channel></rss>`,
+			wantFormat: feedFormatRSS,
+			want:       RSSChannel{Title: "Empty"},
+		},
+		{
+			name:       "atom",
+			xml:        `<feed xmlns="http://www.w3.org/2005/Atom"><title>Blog</title></feed>`,
+			wantFormat: feedFormatUnknown,
+			wantErr:    errNotAFeed,
+		},
+		{
+			name:       "html",
+			xml:        `<html><body>Moved</body></html>`,
+			wantFormat: feedFormatUnknown,
+			wantErr:    errNotAFeed,
+		},
+		{
+			name:       "empty",
+			xml:        ``,
+			wantFormat: feedFormatUnknown,
+			wantErr:    errNotAFeed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed, format, err := decodeFeed(strings.NewReader(tt.xml))
+			if format != tt.wantFormat {
+				t.Errorf("got format %q, want %q", format, tt.wantFormat)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(feed.Channel, tt.want) {
+				t.Errorf("got %+v, want %+v", feed.Channel, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeFeedMalformed(t *testing.T) {
+	tests := []struct {
+		name       string
+		xml        string
+		wantFormat string
+	}{
+		{"unclosed item", `<rss><channel><item><title>One</item></channel></rss>`, feedFormatRSS},
+		{"truncated rdf", `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><item>`, feedFormatRDF},
+		{"not xml", `{"items": []}`, feedFormatUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, format, err := decodeFeed(strings.NewReader(tt.xml))
+			if !isParseError(err) {
+				t.Errorf("got %v, want a parse error", err)
+			}
+			if format != tt.wantFormat {
+				t.Errorf("got format %q, want %q", format, tt.wantFormat)
+			}
+		})
+	}
+}
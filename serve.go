@@ -0,0 +1,73 @@
+package gogator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// shutdownTimeout bounds how long in-flight requests may take to finish
+// once the server is asked to stop.
+const shutdownTimeout = 10 * time.Second
+
+// newServerHandler returns the root handler of the server, mounting the
+// JSON API under apiPrefix next to the client compatibility APIs, with
+// the web reader at the root and the metrics at /metrics.
+func newServerHandler(s *state) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(apiPrefix+"/", instrumentHandler("api", newAPIHandler(s)))
+
+	greader := instrumentHandler("greader", newGReaderHandler(s))
+	mux.Handle("/accounts/ClientLogin", greader)
+	mux.Handle(greaderPrefix+"/", greader)
+	mux.Handle(feverPrefix, instrumentHandler("fever", newFeverHandler(s)))
+	mux.Handle("GET "+publishedPrefix+"{file}",
+		instrumentHandler("published", handlePublished(s)))
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.Handle("/", instrumentHandler("web", newWebHandler(s)))
+	return mux
+}
+
+func handlerServe(s *state, cmd command) error {
+	addr := cmd.flagString("addr")
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           newServerHandler(s),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(),
+		os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	slog.Info("serving", "url", "http://"+addr+"/")
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("couldn't serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(),
+		shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil &&
+		!errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("couldn't shut down: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+-- name: CreateAPIToken :one
+INSERT INTO api_tokens (id, created_at, user_id, name, token_hash, scope, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: GetAPIToken :one
+SELECT sqlc.embed(users), sqlc.embed(api_tokens)
+FROM api_tokens
+INNER JOIN users
+ON users.id = api_tokens.user_id
+WHERE api_tokens.token_hash = $1
+AND (api_tokens.expires_at IS NULL
+  OR api_tokens.expires_at > sqlc.arg('now')::timestamp);
+
+-- name: TouchAPIToken :exec
+-- Last use is recorded with a minute's precision to spare a write per
+-- request.
+UPDATE api_tokens
+SET last_used_at = sqlc.arg('used_at')::timestamp
+WHERE id = $1
+AND (last_used_at IS NULL
+  OR last_used_at < sqlc.arg('used_at')::timestamp - INTERVAL '1 minute');
+
+-- name: GetAPITokensForUser :many
+SELECT * FROM api_tokens
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: DeleteAPIToken :execrows
+DELETE FROM api_tokens
+WHERE id = $1 AND user_id = $2;
@@ -0,0 +1,25 @@
+-- name: SetFeedCredentials :exec
+INSERT INTO feed_credentials (feed_id, created_at, updated_at, kinds, secret)
+VALUES ($1, $2, $2, $3, $4)
+ON CONFLICT (feed_id) DO UPDATE
+SET updated_at = EXCLUDED.updated_at,
+  kinds = EXCLUDED.kinds,
+  secret = EXCLUDED.secret;
+
+-- name: GetFeedCredentials :one
+SELECT * FROM feed_credentials
+WHERE feed_id = $1;
+
+-- name: GetFeedsWithCredentials :many
+-- Feeds whose credentials the user can change, every feed for admins.
+SELECT sqlc.embed(feeds), feed_credentials.kinds, feed_credentials.updated_at AS credentials_updated_at
+FROM feed_credentials
+INNER JOIN feeds
+ON feeds.id = feed_credentials.feed_id
+WHERE sqlc.arg('all')::boolean
+OR feeds.user_id = sqlc.arg('user_id')::uuid
+ORDER BY feeds.name;
+
+-- name: DeleteFeedCredentials :execrows
+DELETE FROM feed_credentials
+WHERE feed_id = $1;
@@ -25,6 +25,7 @@ ON users.id = iff.user_id;
 SELECT
   ff.*,
   feeds.name AS feed_name,
+  feeds.url AS feed_url,
   users.name AS user_name
 FROM feed_follows ff
 INNER JOIN feeds
@@ -36,3 +37,11 @@ WHERE ff.user_id = $1;
 -- name: DeleteFeedFollow :exec
 DELETE FROM feed_follows
 WHERE user_id = $1 AND feed_id = $2;
+
+-- name: GetFollowedFeeds :many
+SELECT feeds.*
+FROM feed_follows ff
+INNER JOIN feeds
+ON feeds.id = ff.feed_id
+WHERE ff.user_id = $1
+ORDER BY feeds.name;
@@ -25,14 +25,86 @@ FROM feeds
 RIGHT JOIN users
 ON users.id = feeds.user_id;
 
+-- name: MarkFeedAttempted :exec
+UPDATE feeds SET last_attempted_at = sqlc.arg('attempted_at')::timestamp
+WHERE id = $1;
+
 -- name: MarkFeedFetched :exec
-UPDATE feeds SET (
-  updated_at,
-  last_fetched_at
-) = ($1, NOW())
-WHERE user_id = $2 ;
+UPDATE feeds
+SET updated_at = sqlc.arg('fetched_at')::timestamp,
+  last_fetched_at = sqlc.arg('fetched_at')::timestamp,
+  last_attempted_at = sqlc.arg('attempted_at')::timestamp
+WHERE id = $1;
 
 -- name: GetNextFeedToFetch :one
+-- Feeds are fetched in turn, so one that keeps failing doesn't hold up
+-- the others. Feeds being fetched are skipped.
 SELECT * FROM feeds
-ORDER BY last_fetched_at NULLS FIRST
+WHERE orphaned_at IS NULL
+AND id <> ALL(sqlc.arg('fetching')::uuid[])
+ORDER BY last_attempted_at NULLS FIRST
 LIMIT 1;
+
+-- name: CountDueFeeds :one
+-- Feeds not attempted since due_before are due, as are those never
+-- attempted.
+SELECT count(*) FROM feeds
+WHERE orphaned_at IS NULL
+AND (last_attempted_at IS NULL
+  OR last_attempted_at < sqlc.arg('due_before')::timestamp);
+
+-- name: GetFeedsByName :many
+SELECT * FROM feeds WHERE name = $1;
+
+-- name: GetFeedByID :one
+SELECT * FROM feeds WHERE id = $1;
+
+-- name: GetFeedBySeq :one
+SELECT * FROM feeds WHERE seq = $1;
+
+-- name: TransferFeed :exec
+UPDATE feeds SET user_id = $2, updated_at = $3
+WHERE id = $1;
+
+-- name: MarkOrphanedFeeds :execrows
+-- Starts the grace period of feeds no one follows.
+UPDATE feeds SET orphaned_at = sqlc.arg('now')::timestamp
+WHERE orphaned_at IS NULL
+AND NOT EXISTS (SELECT 1 FROM feed_follows ff WHERE ff.feed_id = feeds.id);
+
+-- name: ClearAdoptedFeeds :execrows
+-- Ends the grace period of orphaned feeds that were followed again.
+UPDATE feeds SET orphaned_at = NULL
+WHERE orphaned_at IS NOT NULL
+AND EXISTS (SELECT 1 FROM feed_follows ff WHERE ff.feed_id = feeds.id);
+
+-- name: GetOrphanedFeeds :many
+SELECT feeds.*,
+  (SELECT count(*) FROM posts WHERE posts.feed_id = feeds.id) AS posts
+FROM feeds
+WHERE orphaned_at < sqlc.arg('orphaned_before')::timestamp
+ORDER BY orphaned_at;
+
+-- name: DeleteOrphanedFeeds :execrows
+DELETE FROM feeds
+WHERE orphaned_at < sqlc.arg('orphaned_before')::timestamp
+AND NOT EXISTS (SELECT 1 FROM feed_follows ff WHERE ff.feed_id = feeds.id);
+
+-- name: DeleteAllFeeds :exec
+DELETE FROM feeds;
+
+-- name: GetUnorphanedFeeds :many
+-- Returns the feeds not waiting to be collected by gc, least recently
+-- fetched first.
+SELECT * FROM feeds
+WHERE orphaned_at IS NULL
+ORDER BY last_fetched_at NULLS FIRST;
+
+-- name: GetStaleFeeds :many
+-- Returns the followed feeds not successfully fetched since a time,
+-- least recently fetched first.
+SELECT * FROM feeds
+WHERE orphaned_at IS NULL
+AND (last_fetched_at IS NULL
+  OR last_fetched_at < sqlc.arg('fetched_before')::timestamp)
+ORDER BY last_fetched_at NULLS FIRST;
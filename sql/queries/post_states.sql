@@ -0,0 +1,180 @@
+-- name: MarkPostRead :exec
+INSERT INTO post_reads (user_id, post_id, read_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: MarkPostUnread :exec
+DELETE FROM post_reads
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: StarPost :exec
+INSERT INTO post_stars (user_id, post_id, starred_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: UnstarPost :exec
+DELETE FROM post_stars
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: GetFollowedFeedsWithUnread :many
+SELECT
+  feeds.id,
+  feeds.name,
+  feeds.url,
+  COUNT(posts.id) FILTER (WHERE post_reads.post_id IS NULL) AS unread_count
+FROM feed_follows ff
+INNER JOIN feeds
+ON feeds.id = ff.feed_id
+LEFT JOIN posts
+ON posts.feed_id = feeds.id
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = ff.user_id
+WHERE ff.user_id = $1
+GROUP BY feeds.id
+ORDER BY feeds.name;
+
+-- name: GetFeedPostsForUser :many
+SELECT
+  sqlc.embed(posts),
+  (post_reads.post_id IS NOT NULL)::boolean AS read,
+  (post_stars.post_id IS NOT NULL)::boolean AS starred
+FROM posts
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = sqlc.arg('user_id')
+LEFT JOIN post_stars
+ON post_stars.post_id = posts.id AND post_stars.user_id = sqlc.arg('user_id')
+WHERE posts.feed_id = sqlc.arg('feed_id')
+ORDER BY COALESCE(posts.published_at, posts.created_at) DESC, posts.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetStarredPostsForUser :many
+SELECT
+  sqlc.embed(posts),
+  (post_reads.post_id IS NOT NULL)::boolean AS read,
+  TRUE AS starred
+FROM post_stars
+INNER JOIN posts
+ON posts.id = post_stars.post_id
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = post_stars.user_id
+WHERE post_stars.user_id = sqlc.arg('user_id')
+ORDER BY post_stars.starred_at DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetPostStates :many
+SELECT
+  posts.id,
+  (post_reads.post_id IS NOT NULL)::boolean AS read,
+  (post_stars.post_id IS NOT NULL)::boolean AS starred
+FROM posts
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = sqlc.arg('user_id')
+LEFT JOIN post_stars
+ON post_stars.post_id = posts.id AND post_stars.user_id = sqlc.arg('user_id')
+WHERE posts.id = ANY(sqlc.arg('post_ids')::uuid[]);
+
+-- Streams of the Google Reader API are ordered and continued by the
+-- posts' seq. Starred posts stay visible after an unfollow.
+
+-- name: GetStreamItems :many
+SELECT
+  sqlc.embed(posts),
+  feeds.name AS feed_name,
+  feeds.url AS feed_url,
+  feeds.seq AS feed_seq,
+  (post_reads.post_id IS NOT NULL)::boolean AS read,
+  (post_stars.post_id IS NOT NULL)::boolean AS starred
+FROM posts
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = sqlc.arg('user_id')
+LEFT JOIN post_stars
+ON post_stars.post_id = posts.id AND post_stars.user_id = sqlc.arg('user_id')
+WHERE
+  (sqlc.arg('starred_only')::boolean OR posts.feed_id IN (
+    SELECT feed_id FROM feed_follows WHERE user_id = sqlc.arg('user_id')))
+  AND (NOT sqlc.arg('starred_only')::boolean OR post_stars.post_id IS NOT NULL)
+  AND (NOT sqlc.arg('unread_only')::boolean OR post_reads.post_id IS NULL)
+  AND (sqlc.narg('feed_id')::uuid IS NULL OR posts.feed_id = sqlc.narg('feed_id'))
+  AND (sqlc.narg('newer_than')::timestamp IS NULL
+    OR posts.created_at >= sqlc.narg('newer_than'))
+  AND (sqlc.narg('older_than')::timestamp IS NULL
+    OR posts.created_at <= sqlc.narg('older_than'))
+  AND (sqlc.narg('continuation')::bigint IS NULL
+    OR (sqlc.arg('oldest_first')::boolean AND posts.seq > sqlc.narg('continuation'))
+    OR (NOT sqlc.arg('oldest_first')::boolean AND posts.seq < sqlc.narg('continuation')))
+ORDER BY
+  CASE WHEN sqlc.arg('oldest_first')::boolean THEN posts.seq END ASC,
+  posts.seq DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetStreamItemsBySeq :many
+SELECT
+  sqlc.embed(posts),
+  feeds.name AS feed_name,
+  feeds.url AS feed_url,
+  feeds.seq AS feed_seq,
+  (post_reads.post_id IS NOT NULL)::boolean AS read,
+  (post_stars.post_id IS NOT NULL)::boolean AS starred
+FROM posts
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = sqlc.arg('user_id')
+LEFT JOIN post_stars
+ON post_stars.post_id = posts.id AND post_stars.user_id = sqlc.arg('user_id')
+WHERE posts.seq = ANY(sqlc.arg('seqs')::bigint[])
+ORDER BY posts.seq DESC;
+
+-- name: GetUnreadCounts :many
+SELECT
+  feeds.id,
+  feeds.url,
+  COUNT(posts.id) AS unread_count,
+  MAX(posts.created_at)::timestamp AS newest_at
+FROM feed_follows ff
+INNER JOIN feeds
+ON feeds.id = ff.feed_id
+INNER JOIN posts
+ON posts.feed_id = feeds.id
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = ff.user_id
+WHERE ff.user_id = $1 AND post_reads.post_id IS NULL
+GROUP BY feeds.id;
+
+-- name: MarkStreamRead :execrows
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT sqlc.arg('user_id')::uuid, posts.id, sqlc.arg('read_at')::timestamp
+FROM posts
+WHERE
+  posts.feed_id IN (
+    SELECT feed_id FROM feed_follows WHERE user_id = sqlc.arg('user_id'))
+  AND (sqlc.narg('feed_id')::uuid IS NULL OR posts.feed_id = sqlc.narg('feed_id'))
+  AND posts.created_at <= sqlc.arg('older_than')
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: CountFollowedPosts :one
+SELECT COUNT(*)
+FROM posts
+WHERE posts.feed_id IN (
+  SELECT feed_id FROM feed_follows WHERE user_id = $1);
+
+-- name: GetUnreadSeqs :many
+SELECT posts.seq
+FROM posts
+LEFT JOIN post_reads
+ON post_reads.post_id = posts.id AND post_reads.user_id = sqlc.arg('user_id')
+WHERE
+  posts.feed_id IN (
+    SELECT feed_id FROM feed_follows WHERE user_id = sqlc.arg('user_id'))
+  AND post_reads.post_id IS NULL
+ORDER BY posts.seq;
+
+-- name: GetStarredSeqs :many
+SELECT posts.seq
+FROM post_stars
+INNER JOIN posts
+ON posts.id = post_stars.post_id
+WHERE post_stars.user_id = $1
+ORDER BY posts.seq;
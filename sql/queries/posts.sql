@@ -1,4 +1,5 @@
--- name: CreatePost :exec
+-- name: CreatePost :execrows
+-- Posts already collected are skipped.
 INSERT INTO posts (
     id,
     created_at,
@@ -9,9 +10,57 @@ INSERT INTO posts (
     published_at,
     feed_id
 )
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (url) DO NOTHING;
 
--- name: GetPosts :many
+-- Posts are paged by (COALESCE(published_at, created_at), id) so that
+-- posts without a publication date still get a stable position.
+
+-- name: GetPostsNewest :many
+SELECT * FROM posts
+WHERE
+  (sqlc.narg('feed_id')::uuid IS NULL OR feed_id = sqlc.narg('feed_id'))
+  AND (sqlc.narg('since')::timestamp IS NULL
+    OR COALESCE(published_at, created_at) >= sqlc.narg('since'))
+  AND (sqlc.narg('before_time')::timestamp IS NULL
+    OR (COALESCE(published_at, created_at), id)
+      < (sqlc.narg('before_time'), sqlc.narg('before_id')::uuid))
+  AND (sqlc.narg('after_time')::timestamp IS NULL
+    OR (COALESCE(published_at, created_at), id)
+      > (sqlc.narg('after_time'), sqlc.narg('after_id')::uuid))
+  AND (NOT sqlc.arg('unread_only')::boolean OR NOT EXISTS (
+    SELECT 1 FROM post_reads
+    WHERE post_reads.post_id = posts.id
+      AND post_reads.user_id = sqlc.narg('user_id')))
+  AND (NOT sqlc.arg('starred_only')::boolean OR EXISTS (
+    SELECT 1 FROM post_stars
+    WHERE post_stars.post_id = posts.id
+      AND post_stars.user_id = sqlc.narg('user_id')))
+ORDER BY COALESCE(published_at, created_at) DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetPostsOldest :many
 SELECT * FROM posts
-ORDER BY updated_at DESC
-LIMIT $1;
+WHERE
+  (sqlc.narg('feed_id')::uuid IS NULL OR feed_id = sqlc.narg('feed_id'))
+  AND (sqlc.narg('since')::timestamp IS NULL
+    OR COALESCE(published_at, created_at) >= sqlc.narg('since'))
+  AND (sqlc.narg('before_time')::timestamp IS NULL
+    OR (COALESCE(published_at, created_at), id)
+      < (sqlc.narg('before_time'), sqlc.narg('before_id')::uuid))
+  AND (sqlc.narg('after_time')::timestamp IS NULL
+    OR (COALESCE(published_at, created_at), id)
+      > (sqlc.narg('after_time'), sqlc.narg('after_id')::uuid))
+  AND (NOT sqlc.arg('unread_only')::boolean OR NOT EXISTS (
+    SELECT 1 FROM post_reads
+    WHERE post_reads.post_id = posts.id
+      AND post_reads.user_id = sqlc.narg('user_id')))
+  AND (NOT sqlc.arg('starred_only')::boolean OR EXISTS (
+    SELECT 1 FROM post_stars
+    WHERE post_stars.post_id = posts.id
+      AND post_stars.user_id = sqlc.narg('user_id')))
+ORDER BY COALESCE(published_at, created_at) ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: GetPostByID :one
+SELECT * FROM posts WHERE id = $1;
@@ -0,0 +1,44 @@
+-- name: CreatePublishedFeed :one
+INSERT INTO published_feeds (
+  id,
+  created_at,
+  updated_at,
+  user_id,
+  name,
+  title,
+  feed_ids,
+  search,
+  token
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING *;
+
+-- name: GetPublishedFeedsForUser :many
+SELECT * FROM published_feeds
+WHERE user_id = $1
+ORDER BY name;
+
+-- name: GetPublishedFeedByToken :one
+SELECT * FROM published_feeds WHERE token = $1;
+
+-- name: DeletePublishedFeed :execrows
+DELETE FROM published_feeds
+WHERE user_id = $1 AND name = $2;
+
+-- name: GetTimelinePosts :many
+SELECT
+  sqlc.embed(posts),
+  feeds.name AS feed_name,
+  feeds.url AS feed_url
+FROM posts
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+WHERE
+  ((cardinality(sqlc.arg('feed_ids')::uuid[]) = 0 AND posts.feed_id IN (
+      SELECT ff.feed_id FROM feed_follows ff WHERE ff.user_id = sqlc.arg('user_id')::uuid))
+    OR posts.feed_id = ANY(sqlc.arg('feed_ids')::uuid[]))
+  AND (sqlc.narg('search')::text IS NULL
+    OR strpos(lower(posts.title), lower(sqlc.narg('search'))) > 0
+    OR strpos(lower(COALESCE(posts.description, '')), lower(sqlc.narg('search'))) > 0)
+ORDER BY COALESCE(posts.published_at, posts.created_at) DESC, posts.id DESC
+LIMIT sqlc.arg('limit');
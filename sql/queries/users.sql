@@ -1,10 +1,13 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, name)
+-- The first user administers the install.
+INSERT INTO users (id, created_at, updated_at, name, password_hash, is_admin)
 VALUES (
   $1,
   $2,
   $3,
-  $4
+  $4,
+  $5,
+  NOT EXISTS (SELECT 1 FROM users)
 )
 RETURNING *;
 
@@ -19,3 +22,94 @@ SELECT * FROM users;
 
 -- name: DeleteAllUsers :exec
 DELETE FROM users;
+
+-- name: SetFeverAPIKey :exec
+UPDATE users SET fever_api_key = $2, updated_at = $3
+WHERE id = $1;
+
+-- name: GetUserByFeverAPIKey :one
+SELECT * FROM users WHERE fever_api_key = sqlc.arg('fever_api_key')::text;
+
+-- name: SetUserPassword :exec
+UPDATE users SET password_hash = $2, updated_at = $3
+WHERE id = $1;
+
+-- name: SetUserAdmin :exec
+UPDATE users SET is_admin = $2, updated_at = $3
+WHERE id = $1;
+
+-- name: CountAdmins :one
+SELECT count(*) FROM users WHERE is_admin;
+
+-- name: CountAdminsWithPassword :one
+SELECT count(*) FROM users WHERE is_admin AND password_hash IS NOT NULL;
+
+-- name: CountAllRows :one
+SELECT
+  (SELECT count(*) FROM users) AS users,
+  (SELECT count(*) FROM feeds) AS feeds,
+  (SELECT count(*) FROM feed_credentials) AS feed_credentials,
+  (SELECT count(*) FROM feed_follows) AS feed_follows,
+  (SELECT count(*) FROM posts) AS posts,
+  (SELECT count(*) FROM post_reads) AS post_reads,
+  (SELECT count(*) FROM post_stars) AS post_stars,
+  (SELECT count(*) FROM published_feeds) AS published_feeds,
+  (SELECT count(*) FROM api_tokens) AS api_tokens,
+  (SELECT count(*) FROM sessions) AS sessions;
+
+-- name: GetUsersWithDetails :many
+SELECT sqlc.embed(users),
+  (SELECT count(*) FROM feeds WHERE feeds.user_id = users.id) AS feeds,
+  (SELECT count(*) FROM feed_follows
+    WHERE feed_follows.user_id = users.id) AS follows,
+  (SELECT count(*) FROM api_tokens
+    WHERE api_tokens.user_id = users.id) AS api_tokens,
+  sessions.created_at AS last_login_at
+FROM users
+LEFT JOIN sessions ON sessions.id = (
+  SELECT id FROM sessions last
+  WHERE last.user_id = users.id
+  ORDER BY last.created_at DESC
+  LIMIT 1
+)
+ORDER BY users.created_at;
+
+-- name: RenameUser :one
+-- The Fever API key is derived from the name, so it is cleared.
+UPDATE users SET name = $2, updated_at = $3, fever_api_key = NULL
+WHERE id = $1
+RETURNING *;
+
+-- name: CountUserRows :one
+-- Counts what deleting a user deletes. Feeds other users follow are
+-- transferred, the others lose their attribution.
+SELECT
+  (SELECT count(*) FROM feeds f WHERE f.user_id = sqlc.arg('user_id')::uuid
+    AND NOT EXISTS (SELECT 1 FROM feed_follows ff
+      WHERE ff.feed_id = f.id AND ff.user_id <> sqlc.arg('user_id')::uuid)) AS unattributed_feeds,
+  (SELECT count(*) FROM feeds f WHERE f.user_id = sqlc.arg('user_id')::uuid
+    AND EXISTS (SELECT 1 FROM feed_follows ff
+      WHERE ff.feed_id = f.id AND ff.user_id <> sqlc.arg('user_id')::uuid)) AS transferred_feeds,
+  (SELECT count(*) FROM feed_follows ff WHERE ff.user_id = sqlc.arg('user_id')::uuid) AS feed_follows,
+  (SELECT count(*) FROM post_reads pr WHERE pr.user_id = sqlc.arg('user_id')::uuid) AS post_reads,
+  (SELECT count(*) FROM post_stars ps WHERE ps.user_id = sqlc.arg('user_id')::uuid) AS post_stars,
+  (SELECT count(*) FROM published_feeds pf WHERE pf.user_id = sqlc.arg('user_id')::uuid) AS published_feeds,
+  (SELECT count(*) FROM api_tokens t WHERE t.user_id = sqlc.arg('user_id')::uuid) AS api_tokens,
+  (SELECT count(*) FROM sessions se WHERE se.user_id = sqlc.arg('user_id')::uuid) AS sessions;
+
+-- name: TransferFollowedFeeds :execrows
+-- Hands the feeds a user added and others follow to their oldest
+-- follower, so deleting the user doesn't delete them.
+UPDATE feeds
+SET user_id = (
+  SELECT ff.user_id FROM feed_follows ff
+  WHERE ff.feed_id = feeds.id AND ff.user_id <> sqlc.arg('user_id')::uuid
+  ORDER BY ff.created_at
+  LIMIT 1
+), updated_at = sqlc.arg('updated_at')::timestamp
+WHERE feeds.user_id = sqlc.arg('user_id')::uuid
+AND EXISTS (SELECT 1 FROM feed_follows ff
+  WHERE ff.feed_id = feeds.id AND ff.user_id <> sqlc.arg('user_id')::uuid);
+
+-- name: DeleteUser :execrows
+DELETE FROM users WHERE id = $1;
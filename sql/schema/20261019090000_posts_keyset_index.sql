@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE INDEX posts_sort_key_idx
+ON posts ((COALESCE(published_at, created_at)), id);
+
+CREATE INDEX posts_feed_sort_key_idx
+ON posts (feed_id, (COALESCE(published_at, created_at)), id);
+
+-- +goose Down
+DROP INDEX IF EXISTS posts_feed_sort_key_idx;
+DROP INDEX IF EXISTS posts_sort_key_idx;
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE api_tokens (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  token_hash TEXT UNIQUE NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS api_tokens;
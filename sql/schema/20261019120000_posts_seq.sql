@@ -0,0 +1,9 @@
+-- +goose Up
+-- seq gives posts a compact integer ID for the client APIs that need
+-- one, such as the Google Reader API. It also follows insertion order.
+ALTER TABLE posts ADD COLUMN seq BIGSERIAL NOT NULL;
+CREATE UNIQUE INDEX posts_seq_idx ON posts (seq);
+
+-- +goose Down
+DROP INDEX IF EXISTS posts_seq_idx;
+ALTER TABLE posts DROP COLUMN IF EXISTS seq;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- fever_api_key is md5("<name>:<password>") as defined by the Fever
+-- API, which also identifies feeds by integer.
+ALTER TABLE users ADD COLUMN fever_api_key TEXT UNIQUE;
+ALTER TABLE feeds ADD COLUMN seq BIGSERIAL NOT NULL;
+CREATE UNIQUE INDEX feeds_seq_idx ON feeds (seq);
+
+-- +goose Down
+DROP INDEX IF EXISTS feeds_seq_idx;
+ALTER TABLE feeds DROP COLUMN IF EXISTS seq;
+ALTER TABLE users DROP COLUMN IF EXISTS fever_api_key;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- A published feed is a timeline of a user's posts served at a secret
+-- URL. An empty feed_ids means every feed the user follows.
+CREATE TABLE published_feeds (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  title TEXT NOT NULL,
+  feed_ids UUID[] NOT NULL DEFAULT '{}',
+  search TEXT,
+  token TEXT UNIQUE NOT NULL,
+  UNIQUE (user_id, name)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS published_feeds;
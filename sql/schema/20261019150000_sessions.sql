@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE sessions (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash TEXT UNIQUE NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS sessions;
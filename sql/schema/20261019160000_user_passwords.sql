@@ -0,0 +1,8 @@
+-- +goose Up
+-- password_hash is a bcrypt hash. It is NULL for the users created
+-- before passwords were introduced, who can't log in until an admin
+-- sets one with "gogator admin password".
+ALTER TABLE users ADD COLUMN password_hash TEXT;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS password_hash;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Tokens created before scopes existed keep full access.
+ALTER TABLE api_tokens
+ADD COLUMN scope TEXT NOT NULL DEFAULT 'write',
+ADD COLUMN expires_at TIMESTAMP,
+ADD COLUMN last_used_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE api_tokens
+DROP COLUMN last_used_at,
+DROP COLUMN expires_at,
+DROP COLUMN scope;
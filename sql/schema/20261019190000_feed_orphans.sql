@@ -0,0 +1,20 @@
+-- +goose Up
+-- Feeds outlive the user who added them: the attribution is cleared
+-- and feeds no one follows are garbage collected after a grace period,
+-- counted from orphaned_at.
+ALTER TABLE feeds
+ALTER COLUMN user_id DROP NOT NULL,
+DROP CONSTRAINT feeds_user_id_fkey,
+ADD CONSTRAINT feeds_user_id_fkey
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+ADD COLUMN orphaned_at TIMESTAMP;
+
+-- +goose Down
+DELETE FROM feeds WHERE user_id IS NULL;
+
+ALTER TABLE feeds
+DROP COLUMN orphaned_at,
+DROP CONSTRAINT feeds_user_id_fkey,
+ADD CONSTRAINT feeds_user_id_fkey
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+ALTER COLUMN user_id SET NOT NULL;
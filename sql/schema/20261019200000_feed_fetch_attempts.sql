@@ -0,0 +1,11 @@
+-- +goose Up
+-- last_fetched_at is the last successful fetch, last_attempted_at the
+-- last try, successful or not.
+ALTER TABLE feeds
+ADD COLUMN last_attempted_at TIMESTAMP;
+
+UPDATE feeds SET last_attempted_at = last_fetched_at;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN last_attempted_at;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- secret is the encrypted JSON of the credentials, kinds lists what
+-- they hold (basic, bearer, headers, cookies) so they can be described
+-- without the key.
+CREATE TABLE feed_credentials (
+  feed_id UUID PRIMARY KEY REFERENCES feeds (id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  kinds TEXT NOT NULL,
+  secret BYTEA NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS feed_credentials;
@@ -0,0 +1,526 @@
+package gogator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prchop/gogator/internal/database"
+)
+
+// Formats timelines can be published in.
+const (
+	feedFormatRSS  = "rss"
+	feedFormatAtom = "atom"
+	feedFormatJSON = "json"
+)
+
+var feedFormats = []string{feedFormatRSS, feedFormatAtom, feedFormatJSON}
+
+const (
+	timelineDefaultLimit = 50
+	timelineMaxLimit     = 500
+	// publishedPrefix is where the server serves published feeds.
+	publishedPrefix = "/published/"
+)
+
+// timeline is a merged feed of posts: everything a user follows, or a
+// group of feeds, optionally narrowed by a search.
+type timeline struct {
+	// id identifies the timeline in the generated feeds and must not
+	// change between renderings.
+	id      string
+	title   string
+	selfURL string
+	userID  uuid.UUID
+	// feedIDs is the group of feeds, empty for every followed feed.
+	feedIDs []uuid.UUID
+	search  string
+	limit   int
+}
+
+func (t timeline) posts(ctx context.Context, s *state) ([]database.GetTimelinePostsRow, error) {
+	// A nil slice would be sent as NULL rather than an empty array.
+	feedIDs := t.feedIDs
+	if feedIDs == nil {
+		feedIDs = []uuid.UUID{}
+	}
+
+	rows, err := s.db.GetTimelinePosts(ctx, database.GetTimelinePostsParams{
+		FeedIds: feedIDs,
+		UserID:  t.userID,
+		Search:  database.ToNullString(t.search),
+		Limit:   int32(t.limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get the timeline: %w", err)
+	}
+	return rows, nil
+}
+
+func postTime(p database.Post) time.Time {
+	if p.PublishedAt.Valid {
+		return p.PublishedAt.Time
+	}
+	return p.CreatedAt
+}
+
+func feedContentType(format string) string {
+	switch format {
+	case feedFormatRSS:
+		return "application/rss+xml; charset=utf-8"
+	case feedFormatJSON:
+		return "application/feed+json; charset=utf-8"
+	default:
+		return "application/atom+xml; charset=utf-8"
+	}
+}
+
+// writeTimeline renders the posts of a timeline as a feed.
+func writeTimeline(w io.Writer, format string, t timeline,
+	rows []database.GetTimelinePostsRow,
+) error {
+	updated := time.Now().UTC()
+	if len(rows) > 0 {
+		updated = postTime(rows[0].Post)
+	}
+
+	switch format {
+	case feedFormatRSS:
+		return writeRSS(w, t, rows, updated)
+	case feedFormatAtom:
+		return writeAtom(w, t, rows, updated)
+	case feedFormatJSON:
+		return writeJSONFeed(w, t, rows)
+	default:
+		return fmt.Errorf("unknown feed format %q, expected one of: %s",
+			format, strings.Join(feedFormats, ", "))
+	}
+}
+
+type (
+	rssDoc struct {
+		XMLName xml.Name      `xml:"rss"`
+		Version string        `xml:"version,attr"`
+		Atom    string        `xml:"xmlns:atom,attr"`
+		Channel rssDocChannel `xml:"channel"`
+	}
+
+	rssDocChannel struct {
+		Title         string       `xml:"title"`
+		Link          string       `xml:"link"`
+		Desc          string       `xml:"description"`
+		LastBuildDate string       `xml:"lastBuildDate"`
+		Self          *atomLink    `xml:"atom:link,omitempty"`
+		Items         []rssDocItem `xml:"item"`
+	}
+
+	rssDocGUID struct {
+		IsPermaLink bool   `xml:"isPermaLink,attr"`
+		Value       string `xml:",chardata"`
+	}
+
+	rssDocSource struct {
+		URL   string `xml:"url,attr"`
+		Value string `xml:",chardata"`
+	}
+
+	rssDocItem struct {
+		Title   string       `xml:"title"`
+		Link    string       `xml:"link"`
+		GUID    rssDocGUID   `xml:"guid"`
+		Desc    string       `xml:"description,omitempty"`
+		PubDate string       `xml:"pubDate"`
+		Source  rssDocSource `xml:"source"`
+	}
+)
+
+func writeRSS(w io.Writer, t timeline, rows []database.GetTimelinePostsRow,
+	updated time.Time,
+) error {
+	doc := rssDoc{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssDocChannel{
+			Title:         t.title,
+			Link:          t.selfURL,
+			Desc:          t.title,
+			LastBuildDate: updated.Format(time.RFC1123Z),
+		},
+	}
+	if t.selfURL != "" {
+		doc.Channel.Self = &atomLink{Href: t.selfURL, Rel: "self",
+			Type: "application/rss+xml"}
+	}
+
+	for _, row := range rows {
+		p := row.Post
+		doc.Channel.Items = append(doc.Channel.Items, rssDocItem{
+			Title:   p.Title,
+			Link:    p.Url,
+			GUID:    rssDocGUID{Value: "urn:uuid:" + p.ID.String()},
+			Desc:    p.Description.String,
+			PubDate: postTime(p).Format(time.RFC1123Z),
+			Source:  rssDocSource{URL: row.FeedUrl, Value: row.FeedName},
+		})
+	}
+	return writeXML(w, doc)
+}
+
+type (
+	atomDoc struct {
+		XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+		Title   string      `xml:"title"`
+		ID      string      `xml:"id"`
+		Updated string      `xml:"updated"`
+		Links   []atomLink  `xml:"link"`
+		Author  atomPerson  `xml:"author"`
+		Entries []atomEntry `xml:"entry"`
+	}
+
+	atomLink struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr,omitempty"`
+		Type string `xml:"type,attr,omitempty"`
+	}
+
+	atomPerson struct {
+		Name string `xml:"name"`
+	}
+
+	atomText struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	}
+
+	atomSource struct {
+		ID    string   `xml:"id"`
+		Title string   `xml:"title"`
+		Link  atomLink `xml:"link"`
+	}
+
+	atomEntry struct {
+		Title     string     `xml:"title"`
+		ID        string     `xml:"id"`
+		Link      atomLink   `xml:"link"`
+		Published string     `xml:"published"`
+		Updated   string     `xml:"updated"`
+		Summary   *atomText  `xml:"summary,omitempty"`
+		Source    atomSource `xml:"source"`
+	}
+)
+
+func writeAtom(w io.Writer, t timeline, rows []database.GetTimelinePostsRow,
+	updated time.Time,
+) error {
+	doc := atomDoc{
+		Title:   t.title,
+		ID:      t.id,
+		Updated: updated.Format(time.RFC3339),
+		Author:  atomPerson{Name: "gogator"},
+	}
+	if t.selfURL != "" {
+		doc.Links = append(doc.Links, atomLink{Href: t.selfURL, Rel: "self",
+			Type: "application/atom+xml"})
+	}
+
+	for _, row := range rows {
+		p := row.Post
+		e := atomEntry{
+			Title:     p.Title,
+			ID:        "urn:uuid:" + p.ID.String(),
+			Link:      atomLink{Href: p.Url, Rel: "alternate"},
+			Published: postTime(p).Format(time.RFC3339),
+			Updated:   p.UpdatedAt.Format(time.RFC3339),
+			Source: atomSource{
+				ID:    row.FeedUrl,
+				Title: row.FeedName,
+				Link:  atomLink{Href: row.FeedUrl, Rel: "self"},
+			},
+		}
+		if p.Description.Valid {
+			e.Summary = &atomText{Type: "html", Value: p.Description.String}
+		}
+		doc.Entries = append(doc.Entries, e)
+	}
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type (
+	jsonFeed struct {
+		Version string         `json:"version"`
+		Title   string         `json:"title"`
+		FeedURL string         `json:"feed_url,omitempty"`
+		Items   []jsonFeedItem `json:"items"`
+	}
+
+	jsonFeedItem struct {
+		ID            string `json:"id"`
+		URL           string `json:"url"`
+		Title         string `json:"title"`
+		ContentHTML   string `json:"content_html"`
+		DatePublished string `json:"date_published"`
+		DateModified  string `json:"date_modified"`
+	}
+)
+
+func writeJSONFeed(w io.Writer, t timeline, rows []database.GetTimelinePostsRow) error {
+	doc := jsonFeed{
+		Version: "https://jsonfeed.org/version/1.1",
+		Title:   t.title,
+		FeedURL: t.selfURL,
+		Items:   make([]jsonFeedItem, 0, len(rows)),
+	}
+	for _, row := range rows {
+		p := row.Post
+		doc.Items = append(doc.Items, jsonFeedItem{
+			ID:            p.ID.String(),
+			URL:           p.Url,
+			Title:         p.Title,
+			ContentHTML:   p.Description.String,
+			DatePublished: postTime(p).Format(time.RFC3339),
+			DateModified:  p.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// timelineFeeds resolves the --feed flags of a command to feed IDs.
+func timelineFeeds(ctx context.Context, s *state, refs []string) ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+	for _, ref := range refs {
+		feed, err := resolveFeed(ctx, s.db, ref)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(ids, feed.ID) {
+			ids = append(ids, feed.ID)
+		}
+	}
+	return ids, nil
+}
+
+func timelineTitle(cmd command, user database.User) string {
+	if title := cmd.flagString("title"); title != "" {
+		return title
+	}
+	title := user.Name + "'s reading list"
+	if search := cmd.flagString("search"); search != "" {
+		title += fmt.Sprintf(" matching %q", search)
+	}
+	return title
+}
+
+func handlerExportFeed(s *state, cmd command, user database.User) error {
+	format := cmd.flagString("format")
+	if !slices.Contains(feedFormats, format) {
+		return usageErrorf(cmd.name, "unknown format %q, expected one of: %s",
+			format, strings.Join(feedFormats, ", "))
+	}
+	limit := cmd.flagInt("limit")
+	if limit <= 0 || limit > timelineMaxLimit {
+		return usageErrorf(cmd.name, "limit must be between 1 and %d",
+			timelineMaxLimit)
+	}
+
+	ctx := context.Background()
+	feedIDs, err := timelineFeeds(ctx, s, cmd.flagStrings("feed"))
+	if err != nil {
+		return err
+	}
+
+	t := timeline{
+		id:      "urn:uuid:" + user.ID.String(),
+		title:   timelineTitle(cmd, user),
+		userID:  user.ID,
+		feedIDs: feedIDs,
+		search:  cmd.flagString("search"),
+		limit:   limit,
+	}
+	rows, err := t.posts(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	file := cmd.args[0]
+	if file == "-" {
+		return writeTimeline(os.Stdout, format, t, rows)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("couldn't create %s: %w", file, err)
+	}
+	if err := writeTimeline(f, format, t, rows); err != nil {
+		f.Close()
+		return fmt.Errorf("couldn't write %s: %w", file, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("couldn't write %s: %w", file, err)
+	}
+
+	s.out.noticef("Exported %d posts to %s\n", len(rows), file)
+	return nil
+}
+
+func handlerPublish(s *state, cmd command, user database.User) error {
+	ctx := context.Background()
+	feedIDs, err := timelineFeeds(ctx, s, cmd.flagStrings("feed"))
+	if err != nil {
+		return err
+	}
+
+	pf, err := s.db.CreatePublishedFeed(ctx, database.CreatePublishedFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		Name:      cmd.args[0],
+		Title:     timelineTitle(cmd, user),
+		FeedIds:   feedIDs,
+		Search:    database.ToNullString(cmd.flagString("search")),
+		Token:     newToken(),
+	})
+	if isUniqueViolation(err) {
+		return usageErrorf(cmd.name, "a published feed named %q already exists",
+			cmd.args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't publish feed: %w", err)
+	}
+
+	s.out.noticef("Feed %q published, anyone with its URL can read it:\n",
+		pf.Name)
+	l := publishedFeedListing()
+	addPublishedFeed(l, pf)
+	return s.out.render(l)
+}
+
+func handlerListPublished(s *state, cmd command, user database.User) error {
+	pfs, err := s.db.GetPublishedFeedsForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get published feeds: %w", err)
+	}
+
+	if len(pfs) == 0 {
+		s.out.noticef("No published feeds found.\n")
+	}
+	l := publishedFeedListing()
+	for _, pf := range pfs {
+		addPublishedFeed(l, pf)
+	}
+	return s.out.render(l)
+}
+
+func handlerUnpublish(s *state, cmd command, user database.User) error {
+	name := cmd.args[0]
+	n, err := s.db.DeletePublishedFeed(context.Background(),
+		database.DeletePublishedFeedParams{UserID: user.ID, Name: name})
+	if err != nil {
+		return fmt.Errorf("couldn't unpublish feed: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("couldn't find published feed %q: %w", name, errNotFound)
+	}
+
+	s.out.noticef("Feed %q unpublished, its URL no longer works.\n", name)
+	return nil
+}
+
+func publishedFeedListing() *listing {
+	return newListing("name", "title", "feeds", "search", "path")
+}
+
+// addPublishedFeed lists a published feed. The path serves Atom, RSS
+// and JSON Feed with the .atom, .rss and .json extensions.
+func addPublishedFeed(l *listing, pf database.PublishedFeed) {
+	feeds := "all followed"
+	if len(pf.FeedIds) > 0 {
+		feeds = fmt.Sprintf("%d", len(pf.FeedIds))
+	}
+	l.add(pf.Name, pf.Title, feeds, nullString(pf.Search),
+		publishedPrefix+pf.Token+".{atom,rss,json}")
+}
+
+// handlePublished serves published feeds at
+// /published/<token>.<format>, in Atom when there is no extension.
+func handlePublished(s *state) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		file := r.PathValue("file")
+		format := strings.TrimPrefix(path.Ext(file), ".")
+		token := strings.TrimSuffix(file, path.Ext(file))
+		if format == "" {
+			format = feedFormatAtom
+		}
+		if !slices.Contains(feedFormats, format) {
+			http.NotFound(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		pf, err := s.db.GetPublishedFeedByToken(ctx, token)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			slog.Error("published feed request failed", "err", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		t := timeline{
+			id:      "urn:uuid:" + pf.ID.String(),
+			title:   pf.Title,
+			selfURL: scheme + "://" + r.Host + r.URL.Path,
+			userID:  pf.UserID,
+			feedIDs: pf.FeedIds,
+			search:  pf.Search.String,
+			limit:   timelineDefaultLimit,
+		}
+		rows, err := t.posts(ctx, s)
+		if err != nil {
+			slog.Error("published feed request failed", "err", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", feedContentType(format))
+		if err := writeTimeline(w, format, t, rows); err != nil {
+			slog.Error("couldn't write published feed", "err", err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package gogator
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prchop/gogator/internal/database"
+)
+
+// tokenPrefix makes gogator tokens easy to recognize, e.g. by secret
+// scanners.
+const tokenPrefix = "gg_"
+
+// newToken returns a random API token. Only its hash is stored.
+func newToken() string {
+	return tokenPrefix + rand.Text()
+}
+
+// hashToken hashes a token for storage and lookup. Tokens are random
+// and long, so a fast unsalted hash is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Token scopes. Read tokens can only read, write tokens can do anything
+// the user can except manage tokens. Sessions have the write scope.
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+)
+
+var tokenScopes = []string{scopeRead, scopeWrite}
+
+// tokenEnv holds an API token the CLI authenticates with instead of
+// the session of the logged in user.
+const tokenEnv = "GOGATOR_TOKEN"
+
+// scopeAllows reports whether a token of scope can be used where need
+// is required.
+func scopeAllows(scope, need string) bool {
+	return scope == scopeWrite || need == scopeRead
+}
+
+// tokenStore is the part of the database used to authenticate tokens.
+type tokenStore interface {
+	GetAPIToken(ctx context.Context, arg database.GetAPITokenParams) (database.GetAPITokenRow, error)
+	TouchAPIToken(ctx context.Context, arg database.TouchAPITokenParams) error
+	GetUserBySession(ctx context.Context, arg database.GetUserBySessionParams) (database.User, error)
+}
+
+// authenticateToken returns the user of an API token or of a session
+// token, and the scope it grants. It returns sql.ErrNoRows for unknown
+// and expired tokens.
+func authenticateToken(ctx context.Context, db tokenStore, token string) (database.User, string, error) {
+	now := time.Now().UTC()
+	row, err := db.GetAPIToken(ctx, database.GetAPITokenParams{
+		TokenHash: hashToken(token),
+		Now:       now,
+	})
+	if err == nil {
+		err = db.TouchAPIToken(ctx, database.TouchAPITokenParams{
+			ID:     row.ApiToken.ID,
+			UsedAt: now,
+		})
+		return row.User, row.ApiToken.Scope, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, "", err
+	}
+
+	user, err := db.GetUserBySession(ctx, database.GetUserBySessionParams{
+		TokenHash: hashToken(token),
+		ExpiresAt: now,
+	})
+	return user, scopeWrite, err
+}
+
+func handlerToken(s *state, cmd command, user database.User) error {
+	action, args := cmd.args[0], cmd.args[1:]
+	if action != "list" && os.Getenv(tokenEnv) != "" {
+		return fmt.Errorf("tokens can only be created and revoked after \"gogator login\", unset %s: %w",
+			tokenEnv, errUnauthorized)
+	}
+	if action != "create" && (cmd.flagSet("scope") || cmd.flagSet("expires")) {
+		return usageErrorf(cmd.name, "--scope and --expires only apply to create")
+	}
+
+	switch {
+	case action == "create" && len(args) <= 1:
+		return createToken(s, cmd, user, args)
+	case action == "list" && len(args) == 0:
+		return listTokens(s, user)
+	case action == "revoke" && len(args) == 1:
+		return revokeToken(s, user, args[0])
+	case slices.Contains(tokenActions, action):
+		return usageErrorf(cmd.name, "wrong number of arguments for %s", action)
+	default:
+		return usageErrorf(cmd.name, "unknown action %q, expected one of: %s",
+			action, strings.Join(tokenActions, ", "))
+	}
+}
+
+var tokenActions = []string{"create", "list", "revoke"}
+
+func createToken(s *state, cmd command, user database.User, args []string) error {
+	name := "default"
+	if len(args) == 1 {
+		name = args[0]
+	}
+
+	scope := cmd.flagString("scope")
+	if !slices.Contains(tokenScopes, scope) {
+		return usageErrorf(cmd.name, "unknown scope %q, expected one of: %s",
+			scope, strings.Join(tokenScopes, ", "))
+	}
+
+	now := time.Now().UTC()
+	var expiresAt sql.NullTime
+	if v := cmd.flagString("expires"); v != "" {
+		d, err := parseAge(v)
+		if err != nil || d == 0 {
+			return usageErrorf(cmd.name,
+				"couldn't parse the expiry %q, expected e.g. 12h or 90d", v)
+		}
+		expiresAt = sql.NullTime{Time: now.Add(d), Valid: true}
+	}
+
+	token := newToken()
+	t, err := s.db.CreateAPIToken(context.Background(),
+		database.CreateAPITokenParams{
+			ID:        uuid.New(),
+			CreatedAt: now,
+			UserID:    user.ID,
+			Name:      name,
+			TokenHash: hashToken(token),
+			Scope:     scope,
+			ExpiresAt: expiresAt,
+		})
+	if err != nil {
+		return fmt.Errorf("couldn't create api token: %w", err)
+	}
+
+	s.out.noticef("API token %q (%s) created with the %s scope, it won't be shown again:\n",
+		name, t.ID, scope)
+	fmt.Fprintln(s.out.out, token)
+	return nil
+}
+
+func listTokens(s *state, user database.User) error {
+	tokens, err := s.db.GetAPITokensForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get api tokens: %w", err)
+	}
+
+	l := newListing("id", "name", "scope", "created_at", "expires_at", "last_used_at")
+	for _, t := range tokens {
+		l.add(t.ID, t.Name, t.Scope, t.CreatedAt, nullTime(t.ExpiresAt),
+			nullTime(t.LastUsedAt))
+	}
+	return s.out.render(l)
+}
+
+// revokeToken deletes a token by id, or by name when it is the only
+// token with that name.
+func revokeToken(s *state, user database.User, ref string) error {
+	ctx := context.Background()
+	tokens, err := s.db.GetAPITokensForUser(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get api tokens: %w", err)
+	}
+
+	var matches []database.ApiToken
+	for _, t := range tokens {
+		if t.ID.String() == ref || t.Name == ref {
+			matches = append(matches, t)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return fmt.Errorf("no api token %q: %w", ref, errNotFound)
+	case 1:
+	default:
+		return fmt.Errorf("%d api tokens are named %q, revoke one by id",
+			len(matches), ref)
+	}
+
+	_, err = s.db.DeleteAPIToken(ctx, database.DeleteAPITokenParams{
+		ID:     matches[0].ID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't revoke api token: %w", err)
+	}
+	s.out.noticef("API token %q revoked.\n", matches[0].Name)
+	return nil
+}
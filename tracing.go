@@ -0,0 +1,96 @@
+package gogator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace exporters accepted by the trace_exporter setting. Tracing is
+// disabled when none is set.
+const (
+	traceExporterOTLP   = "otlp"
+	traceExporterStderr = "stderr"
+)
+
+var traceExporters = []string{traceExporterOTLP, traceExporterStderr}
+
+// traceFlushTimeout bounds how long exiting waits for the last spans to
+// be exported.
+const traceFlushTimeout = 5 * time.Second
+
+// tracer starts the spans of gogator. Until setupTracing installs a
+// provider, they are not recorded.
+var tracer = otel.Tracer("github.com/prchop/gogator")
+
+// setupTracing installs the tracer provider chosen in the config file.
+// The OTLP exporter sends spans over HTTP to trace_endpoint, or to the
+// endpoint of the usual OTEL_EXPORTER_OTLP_* variables, which default
+// to a collector on localhost.
+func (s *state) setupTracing() error {
+	var exp sdktrace.SpanExporter
+	var err error
+	switch s.cfg.TraceExporter {
+	case "":
+		return nil
+	case traceExporterOTLP:
+		var opts []otlptracehttp.Option
+		if s.cfg.TraceEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(s.cfg.TraceEndpoint))
+		}
+		exp, err = otlptracehttp.New(context.Background(), opts...)
+	case traceExporterStderr:
+		// Spans are diagnostics, so they stay out of the output of
+		// commands like the logs do.
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr),
+			stdouttrace.WithPrettyPrint())
+	default:
+		return fmt.Errorf("error in config: unknown trace exporter %q, expected one of: %s",
+			s.cfg.TraceExporter, strings.Join(traceExporters, ", "))
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't create trace exporter: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName("gogator"))),
+	)
+	otel.SetTracerProvider(tp)
+	s.tracing = tp
+	return nil
+}
+
+// stopTracing exports the spans still buffered.
+func (s *state) stopTracing() {
+	if s.tracing == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), traceFlushTimeout)
+	defer cancel()
+	if err := s.tracing.Shutdown(ctx); err != nil {
+		slog.Error("couldn't export traces", "err", err)
+	}
+}
+
+// endSpan ends span, marking it failed when err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
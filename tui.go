@@ -0,0 +1,745 @@
+package gogator
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/google/uuid"
+	"github.com/mattn/go-runewidth"
+	"github.com/prchop/gogator/internal/database"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// tuiPostLimit is the number of posts loaded for the selected feed.
+const tuiPostLimit = 200
+
+type tuiPane int
+
+const (
+	paneFeeds tuiPane = iota
+	panePosts
+	paneReader
+)
+
+type tuiFeed struct {
+	id     uuid.UUID
+	name   string
+	url    string
+	unread int64
+	// starred marks the pseudo-feed listing the user's starred posts.
+	starred bool
+}
+
+type tuiPost struct {
+	post    database.Post
+	read    bool
+	starred bool
+}
+
+// reader is the state of the full-screen terminal reader.
+type reader struct {
+	s      *state
+	user   database.User
+	screen tcell.Screen
+
+	feeds   []tuiFeed
+	feedSel int
+	feedTop int
+
+	posts   []tuiPost
+	postSel int
+	postTop int
+
+	// lines is the rendered content of the open post.
+	lines  []string
+	scroll int
+	opened uuid.UUID
+
+	focus    tuiPane
+	status   string
+	showHelp bool
+}
+
+var (
+	styleDefault  = tcell.StyleDefault
+	styleTitle    = tcell.StyleDefault.Bold(true)
+	styleBar      = tcell.StyleDefault.Reverse(true)
+	styleSelected = tcell.StyleDefault.Reverse(true)
+	styleInactive = tcell.StyleDefault.Underline(true)
+	styleUnread   = tcell.StyleDefault.Bold(true)
+	styleDim      = tcell.StyleDefault.Dim(true)
+	styleAccent   = tcell.StyleDefault.Foreground(tcell.ColorYellow)
+)
+
+const tuiHelp = "j/k move  h/l pane  enter open  n/p next/prev  " +
+	"space/b page  m read  s star  o browser  r reload  R fetch  q quit"
+
+func handlerTUI(s *state, cmd command, user database.User) error {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return fmt.Errorf("couldn't open the terminal: %w", err)
+	}
+	if err := screen.Init(); err != nil {
+		return fmt.Errorf("couldn't open the terminal: %w", err)
+	}
+	defer screen.Fini()
+
+	r := &reader{s: s, user: user, screen: screen}
+	if err := r.loadFeeds(); err != nil {
+		return err
+	}
+	r.loadPosts()
+	r.status = "Press ? for help"
+
+	for {
+		r.draw()
+		switch ev := screen.PollEvent().(type) {
+		case *tcell.EventResize:
+			screen.Sync()
+		case *tcell.EventKey:
+			if r.handleKey(ev) {
+				return nil
+			}
+		}
+	}
+}
+
+func (r *reader) loadFeeds() error {
+	ctx := context.Background()
+	rows, err := r.s.db.GetFollowedFeedsWithUnread(ctx, r.user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get feeds: %w", err)
+	}
+
+	feeds := []tuiFeed{{name: "★ Starred", starred: true}}
+	for _, f := range rows {
+		feeds = append(feeds, tuiFeed{
+			id:     f.ID,
+			name:   f.Name,
+			url:    f.Url,
+			unread: f.UnreadCount,
+		})
+	}
+	r.feeds = feeds
+	r.feedSel = min(r.feedSel, len(r.feeds)-1)
+	return nil
+}
+
+// loadPosts loads the posts of the selected feed, keeping the selected
+// post when it is still part of the list.
+func (r *reader) loadPosts() {
+	var selected uuid.UUID
+	if r.postSel < len(r.posts) {
+		selected = r.posts[r.postSel].post.ID
+	}
+
+	feed := r.feeds[r.feedSel]
+	ctx := context.Background()
+
+	var (
+		rows []database.GetFeedPostsForUserRow
+		err  error
+	)
+	if feed.starred {
+		var starred []database.GetStarredPostsForUserRow
+		starred, err = r.s.db.GetStarredPostsForUser(ctx,
+			database.GetStarredPostsForUserParams{
+				UserID: r.user.ID,
+				Limit:  tuiPostLimit,
+			})
+		for _, row := range starred {
+			rows = append(rows, database.GetFeedPostsForUserRow(row))
+		}
+	} else {
+		rows, err = r.s.db.GetFeedPostsForUser(ctx,
+			database.GetFeedPostsForUserParams{
+				UserID: r.user.ID,
+				FeedID: feed.id,
+				Limit:  tuiPostLimit,
+			})
+	}
+	if err != nil {
+		r.status = fmt.Sprintf("couldn't get posts: %v", err)
+		return
+	}
+
+	r.posts = r.posts[:0]
+	r.postSel, r.postTop = 0, 0
+	for i, row := range rows {
+		r.posts = append(r.posts, tuiPost{
+			post:    row.Post,
+			read:    row.Read,
+			starred: row.Starred,
+		})
+		if row.Post.ID == selected {
+			r.postSel = i
+		}
+	}
+}
+
+func (r *reader) selectedPost() (*tuiPost, bool) {
+	if r.postSel >= len(r.posts) {
+		return nil, false
+	}
+	return &r.posts[r.postSel], true
+}
+
+// handleKey applies a key press and reports whether to quit.
+func (r *reader) handleKey(ev *tcell.EventKey) bool {
+	r.status = ""
+	_, height := r.screen.Size()
+	page := max(1, height/2)
+
+	switch ev.Key() {
+	case tcell.KeyCtrlC, tcell.KeyEscape:
+		return true
+	case tcell.KeyUp:
+		r.move(-1)
+	case tcell.KeyDown:
+		r.move(1)
+	case tcell.KeyLeft:
+		r.focus = max(paneFeeds, r.focus-1)
+	case tcell.KeyRight:
+		r.focus = min(paneReader, r.focus+1)
+	case tcell.KeyTab:
+		r.focus = (r.focus + 1) % 3
+	case tcell.KeyBacktab:
+		r.focus = (r.focus + 2) % 3
+	case tcell.KeyHome:
+		r.move(-len(r.feeds) - len(r.posts) - len(r.lines))
+	case tcell.KeyEnd:
+		r.move(len(r.feeds) + len(r.posts) + len(r.lines))
+	case tcell.KeyPgDn, tcell.KeyCtrlD:
+		r.scrollReader(page)
+	case tcell.KeyPgUp, tcell.KeyCtrlU:
+		r.scrollReader(-page)
+	case tcell.KeyEnter:
+		r.enter()
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'q':
+			return true
+		case 'j':
+			r.move(1)
+		case 'k':
+			r.move(-1)
+		case 'h':
+			r.focus = max(paneFeeds, r.focus-1)
+		case 'l':
+			r.focus = min(paneReader, r.focus+1)
+		case 'g':
+			r.move(-len(r.feeds) - len(r.posts) - len(r.lines))
+		case 'G':
+			r.move(len(r.feeds) + len(r.posts) + len(r.lines))
+		case ' ':
+			r.scrollReader(page)
+		case 'b':
+			r.scrollReader(-page)
+		case 'n':
+			r.step(1)
+		case 'p':
+			r.step(-1)
+		case 'm':
+			r.toggleRead()
+		case 's':
+			r.toggleStar()
+		case 'o':
+			r.openInBrowser()
+		case 'r':
+			r.reload()
+		case 'R':
+			r.fetch()
+		case '?':
+			r.showHelp = !r.showHelp
+		}
+	}
+	return false
+}
+
+func (r *reader) move(delta int) {
+	switch r.focus {
+	case paneFeeds:
+		sel := clamp(r.feedSel+delta, 0, len(r.feeds)-1)
+		if sel != r.feedSel {
+			r.feedSel = sel
+			r.posts = nil
+			r.loadPosts()
+		}
+	case panePosts:
+		r.postSel = clamp(r.postSel+delta, 0, max(0, len(r.posts)-1))
+	case paneReader:
+		r.scrollReader(delta)
+	}
+}
+
+func (r *reader) scrollReader(delta int) {
+	r.scroll = clamp(r.scroll+delta, 0, max(0, len(r.lines)-1))
+}
+
+func (r *reader) enter() {
+	switch r.focus {
+	case paneFeeds:
+		r.focus = panePosts
+	case panePosts:
+		r.openPost()
+		r.focus = paneReader
+	}
+}
+
+// step opens the next or previous post of the list.
+func (r *reader) step(delta int) {
+	if len(r.posts) == 0 {
+		return
+	}
+	r.postSel = clamp(r.postSel+delta, 0, len(r.posts)-1)
+	r.openPost()
+}
+
+func (r *reader) openPost() {
+	p, ok := r.selectedPost()
+	if !ok {
+		return
+	}
+	r.opened = p.post.ID
+	r.scroll = 0
+	r.lines = nil
+	if !p.read {
+		r.setRead(p, true)
+	}
+}
+
+func (r *reader) toggleRead() {
+	if p, ok := r.selectedPost(); ok {
+		r.setRead(p, !p.read)
+	}
+}
+
+func (r *reader) setRead(p *tuiPost, read bool) {
+	ctx := context.Background()
+	var err error
+	if read {
+		err = r.s.db.MarkPostRead(ctx, database.MarkPostReadParams{
+			UserID: r.user.ID,
+			PostID: p.post.ID,
+			ReadAt: time.Now().UTC(),
+		})
+	} else {
+		err = r.s.db.MarkPostUnread(ctx, database.MarkPostUnreadParams{
+			UserID: r.user.ID,
+			PostID: p.post.ID,
+		})
+	}
+	if err != nil {
+		r.status = fmt.Sprintf("couldn't update post: %v", err)
+		return
+	}
+
+	p.read = read
+	for i := range r.feeds {
+		if r.feeds[i].id == p.post.FeedID {
+			if read {
+				r.feeds[i].unread--
+			} else {
+				r.feeds[i].unread++
+			}
+		}
+	}
+}
+
+func (r *reader) toggleStar() {
+	p, ok := r.selectedPost()
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	var err error
+	if p.starred {
+		err = r.s.db.UnstarPost(ctx, database.UnstarPostParams{
+			UserID: r.user.ID,
+			PostID: p.post.ID,
+		})
+	} else {
+		err = r.s.db.StarPost(ctx, database.StarPostParams{
+			UserID:    r.user.ID,
+			PostID:    p.post.ID,
+			StarredAt: time.Now().UTC(),
+		})
+	}
+	if err != nil {
+		r.status = fmt.Sprintf("couldn't update post: %v", err)
+		return
+	}
+	p.starred = !p.starred
+}
+
+func (r *reader) openInBrowser() {
+	p, ok := r.selectedPost()
+	if !ok {
+		return
+	}
+	u, err := browserURL(p.post.Url)
+	if err != nil {
+		r.status = err.Error()
+		return
+	}
+	if err := openBrowser(u); err != nil {
+		r.status = fmt.Sprintf("couldn't open browser: %v", err)
+		return
+	}
+	r.status = "Opened " + u
+}
+
+func (r *reader) reload() {
+	if err := r.loadFeeds(); err != nil {
+		r.status = err.Error()
+		return
+	}
+	r.loadPosts()
+	r.status = "Reloaded"
+}
+
+// fetch collects the selected feed right away and reloads it.
+func (r *reader) fetch() {
+	feed := r.feeds[r.feedSel]
+	if feed.starred {
+		return
+	}
+
+	r.status = fmt.Sprintf("Fetching %s…", feed.name)
+	r.draw()
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	_, created, err := collectFeed(ctx, r.s, database.Feed{
+		ID:   feed.id,
+		Name: feed.name,
+		Url:  feed.url,
+	})
+	if err != nil {
+		r.status = fmt.Sprintf("couldn't fetch %s: %v", feed.name, err)
+		return
+	}
+
+	r.reload()
+	r.status = fmt.Sprintf("Fetched %s, %d new posts", feed.name, created)
+}
+
+func (r *reader) draw() {
+	r.screen.Clear()
+	width, height := r.screen.Size()
+	if width < 20 || height < 6 {
+		drawText(r.screen, 0, 0, width, styleDefault, "terminal too small")
+		r.screen.Show()
+		return
+	}
+
+	header := fmt.Sprintf(" gogator — %s", r.user.Name)
+	fillRow(r.screen, 0, width, styleBar)
+	drawText(r.screen, 0, 0, width, styleBar, header)
+
+	bodyTop, bodyBottom := 1, height-1
+	feedsWidth := min(32, width/3)
+	for y := bodyTop; y < bodyBottom; y++ {
+		r.screen.SetContent(feedsWidth, y, '│', nil, styleDim)
+	}
+
+	right := feedsWidth + 1
+	rightWidth := width - right
+	postsHeight := max(3, (bodyBottom-bodyTop)*2/5)
+	sepRow := bodyTop + postsHeight
+	for x := right; x < width; x++ {
+		r.screen.SetContent(x, sepRow, '─', nil, styleDim)
+	}
+
+	r.drawFeeds(0, bodyTop, feedsWidth, postsHeight+(bodyBottom-sepRow))
+	r.drawPosts(right, bodyTop, rightWidth, postsHeight)
+	r.drawReader(right, sepRow+1, rightWidth, bodyBottom-sepRow-1)
+
+	status := r.status
+	if r.showHelp || status == "" {
+		status = tuiHelp
+	}
+	fillRow(r.screen, height-1, width, styleBar)
+	drawText(r.screen, 0, height-1, width, styleBar, " "+status)
+	r.screen.Show()
+}
+
+func (r *reader) rowStyle(pane tuiPane, selected bool) tcell.Style {
+	if !selected {
+		return styleDefault
+	}
+	if r.focus == pane {
+		return styleSelected
+	}
+	return styleInactive
+}
+
+func (r *reader) drawFeeds(x, y, width, height int) {
+	r.feedTop = scrollTop(r.feedTop, r.feedSel, height)
+	for i := r.feedTop; i < len(r.feeds) && i-r.feedTop < height; i++ {
+		f := r.feeds[i]
+		row := y + i - r.feedTop
+		style := r.rowStyle(paneFeeds, i == r.feedSel)
+		if f.unread > 0 && i != r.feedSel {
+			style = styleUnread
+		}
+
+		count := ""
+		if f.unread > 0 {
+			count = fmt.Sprintf(" %d", f.unread)
+		}
+		name := truncate(f.name, width-runewidth.StringWidth(count)-1)
+		line := name + strings.Repeat(" ",
+			max(0, width-runewidth.StringWidth(name)-runewidth.StringWidth(count)-1)) + count
+		fillRow(r.screen, row, width-1, style)
+		drawText(r.screen, x, row, width-1, style, line)
+	}
+}
+
+func (r *reader) drawPosts(x, y, width, height int) {
+	if len(r.posts) == 0 {
+		drawText(r.screen, x+1, y, width-1, styleDim, "No posts.")
+		return
+	}
+
+	r.postTop = scrollTop(r.postTop, r.postSel, height)
+	for i := r.postTop; i < len(r.posts) && i-r.postTop < height; i++ {
+		p := r.posts[i]
+		row := y + i - r.postTop
+		style := r.rowStyle(panePosts, i == r.postSel)
+		if !p.read && i != r.postSel {
+			style = styleUnread
+		}
+
+		marker := "  "
+		if !p.read {
+			marker = "● "
+		}
+		star := "  "
+		if p.starred {
+			star = "★ "
+		}
+		date := postCursor(p.post).time.Local().Format("Jan 02")
+		line := marker + star + date + "  " + p.post.Title
+
+		for cx := x; cx < x+width; cx++ {
+			r.screen.SetContent(cx, row, ' ', nil, style)
+		}
+		drawText(r.screen, x, row, width, style, line)
+		if p.starred {
+			drawText(r.screen, x+2, row, 1, style.Foreground(tcell.ColorYellow), "★")
+		}
+	}
+}
+
+func (r *reader) drawReader(x, y, width, height int) {
+	p, ok := r.selectedPost()
+	if !ok || p.post.ID != r.opened {
+		drawText(r.screen, x+1, y, width-1, styleDim,
+			"Press enter to read the selected post.")
+		return
+	}
+
+	if r.lines == nil {
+		r.lines = renderPost(p.post, width-2)
+	}
+	for i := 0; i < height && r.scroll+i < len(r.lines); i++ {
+		style := styleDefault
+		if r.scroll+i == 0 {
+			style = styleTitle
+		}
+		drawText(r.screen, x+1, y+i, width-2, style, r.lines[r.scroll+i])
+	}
+
+	if r.focus == paneReader && len(r.lines) > height {
+		pct := 100 * min(r.scroll+height, len(r.lines)) / len(r.lines)
+		mark := fmt.Sprintf(" %d%% ", pct)
+		drawText(r.screen, x+width-len(mark), y+height-1, len(mark), styleAccent, mark)
+	}
+}
+
+// renderPost turns a post into lines of text wrapped to width.
+func renderPost(p database.Post, width int) []string {
+	width = max(10, width)
+	lines := wrapText(p.Title, width)
+	lines = append(lines, p.Url)
+	if p.PublishedAt.Valid {
+		lines = append(lines, p.PublishedAt.Time.Local().Format(time.RFC1123))
+	}
+	lines = append(lines, "")
+	for _, para := range strings.Split(htmlToText(p.Description.String), "\n") {
+		lines = append(lines, wrapText(para, width)...)
+	}
+	return lines
+}
+
+// htmlToText converts the HTML of a post description to plain text,
+// keeping paragraphs and list items on their own lines.
+func htmlToText(s string) string {
+	var b strings.Builder
+	z := html.NewTokenizer(strings.NewReader(s))
+	skip := 0
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return tidyText(b.String())
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+			}
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Script, atom.Style:
+				if tt == html.StartTagToken {
+					skip++
+				} else if tt == html.EndTagToken && skip > 0 {
+					skip--
+				}
+			case atom.Li:
+				if tt == html.StartTagToken {
+					b.WriteString("\n • ")
+				}
+			case atom.Br, atom.P, atom.Div, atom.Blockquote, atom.Pre,
+				atom.Ul, atom.Ol, atom.Tr, atom.H1, atom.H2, atom.H3,
+				atom.H4, atom.H5, atom.H6:
+				b.WriteString("\n")
+			}
+		}
+	}
+}
+
+// tidyText collapses runs of spaces and blank lines.
+func tidyText(s string) string {
+	var lines []string
+	blank := true
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.Join(strings.Fields(l), " ")
+		if l == "" {
+			if !blank {
+				lines = append(lines, "")
+			}
+			blank = true
+			continue
+		}
+		if strings.HasPrefix(l, "•") {
+			l = " " + l
+		}
+		lines = append(lines, l)
+		blank = false
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func wrapText(s string, width int) []string {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return []string{""}
+	}
+
+	var (
+		lines []string
+		line  string
+	)
+	for _, w := range words {
+		switch {
+		case line == "":
+			line = w
+		case runewidth.StringWidth(line)+1+runewidth.StringWidth(w) <= width:
+			line += " " + w
+		default:
+			lines = append(lines, line)
+			line = w
+		}
+		for runewidth.StringWidth(line) > width {
+			head := runewidth.Truncate(line, width, "")
+			lines = append(lines, head)
+			line = line[len(head):]
+		}
+	}
+	return append(lines, line)
+}
+
+func drawText(screen tcell.Screen, x, y, width int, style tcell.Style, s string) {
+	limit := x + width
+	for _, ch := range s {
+		w := runewidth.RuneWidth(ch)
+		if x+w > limit {
+			return
+		}
+		screen.SetContent(x, y, ch, nil, style)
+		x += w
+	}
+}
+
+func fillRow(screen tcell.Screen, y, width int, style tcell.Style) {
+	for x := 0; x < width; x++ {
+		screen.SetContent(x, y, ' ', nil, style)
+	}
+}
+
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	return runewidth.Truncate(s, width, "…")
+}
+
+// scrollTop returns the first visible row that keeps sel on screen.
+func scrollTop(top, sel, height int) int {
+	if sel < top {
+		return sel
+	}
+	if sel >= top+height {
+		return sel - height + 1
+	}
+	return top
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+// browserURL returns the link of a post if it is an absolute http or
+// https URL. Links come from the feeds, which must not be able to make
+// the reader open local files, other scheme handlers or pass options
+// to the opener.
+func browserURL(link string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("won't open %q, only http and https links are opened", link)
+	}
+	return u.String(), nil
+}
+
+// openBrowser opens url with $BROWSER or the platform's URL opener.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch browser := strings.TrimSpace(os.Getenv("BROWSER")); {
+	case browser != "":
+		cmd = exec.Command(browser, url)
+	case runtime.GOOS == "darwin":
+		cmd = exec.Command("open", url)
+	case runtime.GOOS == "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
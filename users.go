@@ -0,0 +1,157 @@
+package gogator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prchop/gogator/internal/database"
+)
+
+// getUser returns the user with a name, wrapping errNotFound when
+// there's none.
+func getUser(ctx context.Context, s *state, name string) (database.User, error) {
+	user, err := s.db.GetUser(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, fmt.Errorf("user %q doesn't exist: %w", name, errNotFound)
+	}
+	if err != nil {
+		return database.User{}, fmt.Errorf("couldn't get user: %w", err)
+	}
+	return user, nil
+}
+
+// checkNotLastAdmin refuses to demote or delete the last admin, so the
+// install is never left without one.
+func checkNotLastAdmin(ctx context.Context, s *state, user database.User) error {
+	if !user.IsAdmin {
+		return nil
+	}
+	n, err := s.db.CountAdmins(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't count admins: %w", err)
+	}
+	if n <= 1 {
+		return fmt.Errorf("%q is the last admin, grant the role to someone else first",
+			user.Name)
+	}
+	return nil
+}
+
+func handlerWhoami(s *state, cmd command, user database.User) error {
+	l := userListing()
+	addUser(l, user, true)
+	return s.out.render(l)
+}
+
+// handlerDeleteUser deletes a user along with everything they own,
+// after showing what will be deleted. Feeds the user added that others
+// follow are handed to their oldest follower, the others lose their
+// attribution and are garbage collected.
+func handlerDeleteUser(s *state, cmd command, current database.User) error {
+	ctx := context.Background()
+	user, err := getUser(ctx, s, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	if err := checkNotLastAdmin(ctx, s, user); err != nil {
+		return err
+	}
+
+	c, err := s.db.CountUserRows(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't count rows: %w", err)
+	}
+	if cmd.flagBool("dry-run") {
+		s.out.noticef("Dry run, deleting %q would delete:\n", user.Name)
+	} else {
+		s.out.noticef("Deleting %q deletes:\n", user.Name)
+	}
+	l := rowCounts()
+	l.add("users", 1)
+	l.add("feed_follows", c.FeedFollows)
+	l.add("post_reads", c.PostReads)
+	l.add("post_stars", c.PostStars)
+	l.add("published_feeds", c.PublishedFeeds)
+	l.add("api_tokens", c.ApiTokens)
+	l.add("sessions", c.Sessions)
+	if err := s.out.render(l); err != nil {
+		return err
+	}
+	if c.TransferredFeeds > 0 {
+		s.out.noticef("%d feed(s) other users follow will be transferred to their oldest follower.\n",
+			c.TransferredFeeds)
+	}
+	if c.UnattributedFeeds > 0 {
+		s.out.noticef("%d feed(s) no one else follows will be garbage collected after %s.\n",
+			c.UnattributedFeeds, formatAge(feedGCGrace))
+	}
+	if cmd.flagBool("dry-run") {
+		return nil
+	}
+
+	if err := confirm(cmd, fmt.Sprintf("Delete user %q?", user.Name)); err != nil {
+		return err
+	}
+	err = s.inTx(ctx, func(q *database.Queries) error {
+		_, err := q.TransferFollowedFeeds(ctx, database.TransferFollowedFeedsParams{
+			UserID:    user.ID,
+			UpdatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't transfer feeds: %w", err)
+		}
+		if _, err := q.DeleteUser(ctx, user.ID); err != nil {
+			return fmt.Errorf("couldn't delete user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if user.ID == current.ID {
+		if err := s.cfg.ClearSession(); err != nil {
+			return fmt.Errorf("couldn't clear current user: %w", err)
+		}
+	}
+	s.out.noticef("User %q deleted.\n", user.Name)
+	return nil
+}
+
+func handlerRenameUser(s *state, cmd command, current database.User) error {
+	ctx := context.Background()
+	user, err := getUser(ctx, s, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	name := cmd.args[1]
+	if name == "" {
+		return usageErrorf(cmd.name, "the new name can't be empty")
+	}
+
+	renamed, err := s.db.RenameUser(ctx, database.RenameUserParams{
+		ID:        user.ID,
+		Name:      name,
+		UpdatedAt: time.Now().UTC(),
+	})
+	if isUniqueViolation(err) {
+		return fmt.Errorf("user %q already exists", name)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't rename user: %w", err)
+	}
+
+	if user.ID == current.ID && s.cfg.UserName == user.Name {
+		if err := s.cfg.SetSession(name, s.cfg.SessionToken); err != nil {
+			return fmt.Errorf("couldn't set current user: %w", err)
+		}
+	}
+	s.out.noticef("User %q renamed to %q.\n", user.Name, renamed.Name)
+	if user.FeverApiKey.Valid {
+		s.out.noticef("Their Fever password was cleared, set it again with \"gogator feverkey\".\n")
+	}
+	return nil
+}
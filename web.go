@@ -0,0 +1,504 @@
+package gogator
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prchop/gogator/internal/database"
+)
+
+//go:embed web/*.html
+var webFS embed.FS
+
+const (
+	sessionCookie = "gogator_session"
+	flashCookie   = "gogator_flash"
+	sessionTTL    = 30 * 24 * time.Hour
+	webPostsLimit = 100
+	// maxOPMLSize caps the size of imported OPML files.
+	maxOPMLSize = 5 << 20
+)
+
+var webFuncs = template.FuncMap{
+	"date": func(t time.Time) string {
+		return t.Local().Format("Mon, 02 Jan 2006 15:04")
+	},
+}
+
+// webTemplates holds a template set per page, each made of the layout,
+// the shared partials and the page's content.
+var webTemplates = func() map[string]*template.Template {
+	pages := map[string]*template.Template{}
+	for _, page := range []string{"login", "feeds", "posts", "post", "error"} {
+		pages[page] = template.Must(template.New("").Funcs(webFuncs).ParseFS(
+			webFS, "web/layout.html", "web/actions.html", "web/"+page+".html"))
+	}
+	return pages
+}()
+
+// webPage is the data of every page. Fields a page doesn't use stay
+// empty.
+type webPage struct {
+	User     *database.User
+	Title    string
+	Flash    string
+	Error    string
+	Username string
+	Feeds    []database.GetFollowedFeedsWithUnreadRow
+	Feed     *database.Feed
+	Posts    []webPost
+	Post     *webPost
+}
+
+type webPost struct {
+	database.Post
+	Read       bool
+	Starred    bool
+	Paragraphs []string
+}
+
+func (p webPost) Time() time.Time {
+	return postTime(p.Post)
+}
+
+type webHandler func(w http.ResponseWriter, r *http.Request, user database.User) error
+
+type webServer struct {
+	s *state
+}
+
+// newWebHandler returns the handler of the web reader, ready to be
+// mounted on the root of the server. Forms are protected against
+// cross-site requests.
+func newWebHandler(s *state) http.Handler {
+	ws := &webServer{s: s}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /login", ws.handleLoginPage)
+	mux.HandleFunc("POST /login", ws.handleLogin)
+	mux.HandleFunc("POST /logout", ws.handleLogout)
+	mux.Handle("GET /{$}", ws.wrap(ws.handleFeeds))
+	mux.Handle("GET /starred", ws.wrap(ws.handleStarred))
+	mux.Handle("GET /feeds/{id}", ws.wrap(ws.handleFeed))
+	mux.Handle("POST /feeds", ws.wrap(ws.handleAddFeed))
+	mux.Handle("POST /follow", ws.wrap(ws.handleFollow))
+	mux.Handle("POST /feeds/{id}/unfollow", ws.wrap(ws.handleUnfollow))
+	mux.Handle("POST /feeds/{id}/read", ws.wrap(ws.handleMarkFeedRead))
+	mux.Handle("POST /import", ws.wrap(ws.handleImport))
+	mux.Handle("GET /posts/{id}", ws.wrap(ws.handlePost))
+	mux.Handle("POST /posts/{id}/{action}", ws.wrap(ws.handlePostAction))
+	return http.NewCrossOriginProtection().Handler(mux)
+}
+
+func (ws *webServer) wrap(h webHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := ws.sessionUser(r)
+		if errors.Is(err, errUnauthorized) {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err == nil {
+			err = h(w, r, user)
+		}
+		if err != nil {
+			ws.renderError(w, r, user, err)
+		}
+	})
+}
+
+func (ws *webServer) sessionUser(r *http.Request) (database.User, error) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return database.User{}, errUnauthorized
+	}
+
+	user, err := ws.s.db.GetUserBySession(r.Context(),
+		database.GetUserBySessionParams{
+			TokenHash: hashToken(c.Value),
+			ExpiresAt: time.Now().UTC(),
+		})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, errUnauthorized
+	}
+	return user, err
+}
+
+func (ws *webServer) render(w http.ResponseWriter, r *http.Request, status int,
+	page string, data webPage,
+) {
+	if c, err := r.Cookie(flashCookie); err == nil {
+		data.Flash, _ = url.QueryUnescape(c.Value)
+		http.SetCookie(w, &http.Cookie{Name: flashCookie, Path: "/", MaxAge: -1})
+	}
+
+	var b strings.Builder
+	if err := webTemplates[page].ExecuteTemplate(&b, "layout", data); err != nil {
+		slog.Error("couldn't render page", "page", page, "err", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprint(w, b.String())
+}
+
+func (ws *webServer) renderError(w http.ResponseWriter, r *http.Request,
+	user database.User, err error,
+) {
+	status, msg := http.StatusInternalServerError, "Something went wrong."
+	var ae *apiError
+	switch {
+	case errors.As(err, &ae):
+		status, msg = ae.status, ae.msg
+	case errors.Is(err, errNotFound), errors.Is(err, sql.ErrNoRows):
+		status, msg = http.StatusNotFound, "Not found."
+	case isUniqueViolation(err):
+		status, msg = http.StatusConflict, "It already exists."
+	default:
+		slog.Error("web request failed", "err", err)
+	}
+	data := webPage{Title: "Error", Error: msg}
+	if user.ID != uuid.Nil {
+		data.User = &user
+	}
+	ws.render(w, r, status, "error", data)
+}
+
+// redirect sends the browser back to the page the form was posted
+// from, or to fallback, with a message shown on the next page.
+func redirect(w http.ResponseWriter, r *http.Request, fallback, flash string) {
+	to := fallback
+	if ref, err := url.Parse(r.Referer()); err == nil && ref.Host == r.Host &&
+		strings.HasPrefix(ref.Path, "/") && ref.Path != "/login" {
+		to = ref.RequestURI()
+	}
+	if flash != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     flashCookie,
+			Value:    url.QueryEscape(flash),
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	http.Redirect(w, r, to, http.StatusSeeOther)
+}
+
+func (ws *webServer) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	ws.render(w, r, http.StatusOK, "login", webPage{Title: "Log in"})
+}
+
+// handleLogin starts a session for a username and password.
+func (ws *webServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name, password := r.PostFormValue("username"), r.PostFormValue("password")
+
+	user, err := ws.s.db.GetUser(ctx, name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		ws.renderError(w, r, database.User{}, err)
+		return
+	}
+	if err := checkPassword(user, password); err != nil {
+		ws.render(w, r, http.StatusUnauthorized, "login", webPage{
+			Title:    "Log in",
+			Error:    "Wrong username or password.",
+			Username: name,
+		})
+		return
+	}
+
+	token, err := startSession(ctx, ws.s, user)
+	if err != nil {
+		ws.renderError(w, r, user, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// startSession creates a session for user and returns its token.
+// Expired sessions are cleaned up on the way.
+func startSession(ctx context.Context, s *state, user database.User) (string, error) {
+	now := time.Now().UTC()
+	if err := s.db.DeleteExpiredSessions(ctx, now); err != nil {
+		return "", fmt.Errorf("couldn't delete expired sessions: %w", err)
+	}
+
+	token := newToken()
+	_, err := s.db.CreateSession(ctx, database.CreateSessionParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(sessionTTL),
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't create session: %w", err)
+	}
+	return token, nil
+}
+
+func (ws *webServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if err := ws.s.db.DeleteSession(r.Context(), hashToken(c.Value)); err != nil {
+			slog.Error("couldn't delete session", "err", err)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (ws *webServer) handleFeeds(w http.ResponseWriter, r *http.Request, user database.User) error {
+	feeds, err := ws.s.db.GetFollowedFeedsWithUnread(r.Context(), user.ID)
+	if err != nil {
+		return err
+	}
+	ws.render(w, r, http.StatusOK, "feeds", webPage{User: &user, Feeds: feeds})
+	return nil
+}
+
+func (ws *webServer) handleFeed(w http.ResponseWriter, r *http.Request, user database.User) error {
+	id, err := pathUUID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	ctx := r.Context()
+	feed, err := ws.s.db.GetFeedByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	rows, err := ws.s.db.GetFeedPostsForUser(ctx, database.GetFeedPostsForUserParams{
+		UserID: user.ID,
+		FeedID: feed.ID,
+		Limit:  webPostsLimit,
+	})
+	if err != nil {
+		return err
+	}
+
+	posts := make([]webPost, 0, len(rows))
+	for _, row := range rows {
+		posts = append(posts, webPost{Post: row.Post, Read: row.Read, Starred: row.Starred})
+	}
+	ws.render(w, r, http.StatusOK, "posts", webPage{
+		User:  &user,
+		Title: feed.Name,
+		Feed:  &feed,
+		Posts: posts,
+	})
+	return nil
+}
+
+func (ws *webServer) handleStarred(w http.ResponseWriter, r *http.Request, user database.User) error {
+	rows, err := ws.s.db.GetStarredPostsForUser(r.Context(),
+		database.GetStarredPostsForUserParams{UserID: user.ID, Limit: webPostsLimit})
+	if err != nil {
+		return err
+	}
+
+	posts := make([]webPost, 0, len(rows))
+	for _, row := range rows {
+		posts = append(posts, webPost{Post: row.Post, Read: row.Read, Starred: row.Starred})
+	}
+	ws.render(w, r, http.StatusOK, "posts", webPage{
+		User:  &user,
+		Title: "Starred",
+		Posts: posts,
+	})
+	return nil
+}
+
+// handlePost shows a post and marks it read.
+func (ws *webServer) handlePost(w http.ResponseWriter, r *http.Request, user database.User) error {
+	id, err := pathUUID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	ctx := r.Context()
+	post, err := ws.s.db.GetPostByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	states, err := ws.s.db.GetPostStates(ctx, database.GetPostStatesParams{
+		UserID:  user.ID,
+		PostIds: []uuid.UUID{id},
+	})
+	if err != nil {
+		return err
+	}
+	if err := setPostRead(ctx, ws.s.db, user.ID, id, true); err != nil {
+		return err
+	}
+
+	wp := webPost{
+		Post:       post,
+		Read:       true,
+		Paragraphs: strings.Split(htmlToText(post.Description.String), "\n\n"),
+	}
+	if len(states) == 1 {
+		wp.Starred = states[0].Starred
+	}
+	ws.render(w, r, http.StatusOK, "post", webPage{
+		User:  &user,
+		Title: post.Title,
+		Post:  &wp,
+	})
+	return nil
+}
+
+func (ws *webServer) handlePostAction(w http.ResponseWriter, r *http.Request, user database.User) error {
+	id, err := pathUUID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	ctx := r.Context()
+	if _, err := ws.s.db.GetPostByID(ctx, id); err != nil {
+		return err
+	}
+
+	switch action := r.PathValue("action"); action {
+	case "read", "unread":
+		err = setPostRead(ctx, ws.s.db, user.ID, id, action == "read")
+	case "star", "unstar":
+		err = setPostStarred(ctx, ws.s.db, user.ID, id, action == "star")
+	default:
+		return apiErrorf(http.StatusNotFound, "Not found.")
+	}
+	if err != nil {
+		return err
+	}
+	redirect(w, r, "/posts/"+id.String(), "")
+	return nil
+}
+
+func (ws *webServer) handleAddFeed(w http.ResponseWriter, r *http.Request, user database.User) error {
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	feedURL := strings.TrimSpace(r.PostFormValue("url"))
+	if name == "" || feedURL == "" {
+		return apiErrorf(http.StatusBadRequest, "A name and a URL are required.")
+	}
+
+	ctx := r.Context()
+	if _, err := ws.s.db.GetFeedByUrl(ctx, feedURL); err == nil {
+		return apiErrorf(http.StatusConflict,
+			"That feed already exists, follow it instead.")
+	}
+	feed, err := subscribe(ctx, ws.s, user, feedURL, name)
+	if err != nil {
+		return err
+	}
+	redirect(w, r, "/", fmt.Sprintf("Added and followed %s.", feed.Name))
+	return nil
+}
+
+func (ws *webServer) handleFollow(w http.ResponseWriter, r *http.Request, user database.User) error {
+	ctx := r.Context()
+	feed, err := ws.s.db.GetFeedByUrl(ctx, strings.TrimSpace(r.PostFormValue("url")))
+	if errors.Is(err, sql.ErrNoRows) {
+		return apiErrorf(http.StatusNotFound,
+			"No feed has that URL, add it instead.")
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := subscribe(ctx, ws.s, user, feed.Url, feed.Name); err != nil {
+		return err
+	}
+	redirect(w, r, "/", fmt.Sprintf("Followed %s.", feed.Name))
+	return nil
+}
+
+func (ws *webServer) handleUnfollow(w http.ResponseWriter, r *http.Request, user database.User) error {
+	id, err := pathUUID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	ctx := r.Context()
+	feed, err := ws.s.db.GetFeedByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = ws.s.db.DeleteFeedFollow(ctx, database.DeleteFeedFollowParams{
+		UserID: user.ID,
+		FeedID: feed.ID,
+	})
+	if err != nil {
+		return err
+	}
+	redirect(w, r, "/", fmt.Sprintf("Unfollowed %s.", feed.Name))
+	return nil
+}
+
+func (ws *webServer) handleMarkFeedRead(w http.ResponseWriter, r *http.Request, user database.User) error {
+	id, err := pathUUID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	n, err := ws.s.db.MarkStreamRead(r.Context(), database.MarkStreamReadParams{
+		UserID:    user.ID,
+		ReadAt:    time.Now().UTC(),
+		FeedID:    uuid.NullUUID{UUID: id, Valid: true},
+		OlderThan: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	redirect(w, r, "/feeds/"+id.String(), fmt.Sprintf("Marked %d posts read.", n))
+	return nil
+}
+
+// handleImport follows every feed of an uploaded OPML file, adding the
+// feeds that don't exist yet.
+func (ws *webServer) handleImport(w http.ResponseWriter, r *http.Request, user database.User) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxOPMLSize)
+	file, _, err := r.FormFile("opml")
+	if err != nil {
+		return apiErrorf(http.StatusBadRequest, "Choose an OPML file to import.")
+	}
+	defer file.Close()
+
+	feeds, err := parseOPML(file)
+	if err != nil {
+		return apiErrorf(http.StatusBadRequest, "That isn't a valid OPML file.")
+	}
+
+	ctx := r.Context()
+	var failed []string
+	for _, f := range feeds {
+		if _, err := subscribe(ctx, ws.s, user, f.url, f.name); err != nil {
+			slog.Error("couldn't import feed", "feed_url", f.url, "err", err)
+			failed = append(failed, f.url)
+		}
+	}
+
+	msg := fmt.Sprintf("Imported %d feeds.", len(feeds)-len(failed))
+	if len(failed) > 0 {
+		msg += fmt.Sprintf(" Couldn't import: %s.", strings.Join(failed, ", "))
+	}
+	redirect(w, r, "/", msg)
+	return nil
+}